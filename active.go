@@ -0,0 +1,124 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// ActivePlayback describes a song currently playing on the server.
+type ActivePlayback struct {
+	// ID is the ID of the playback, which StopPlayback stops. It is 0 for DJ booths.
+	ID int
+	// Player is the handle of the player the song is played to. It is nil for DJ booths.
+	Player *world.EntityHandle
+	// PlayerName is the name of the player, or the name of the DJ booth.
+	PlayerName string
+	// Song is the song playing.
+	Song *Song
+	// Tick is the tick the song is at. It is 0 for DJ booths.
+	Tick int
+	// Elapsed is how long the song has been playing, based on Tick and the playback tempo.
+	Elapsed time.Duration
+	// Total is how long the whole song plays at the playback tempo.
+	Total time.Duration
+	// Paused is true if the song is paused.
+	Paused bool
+	// Source describes what started the song, see PlaybackOptions.Source. DJ booths have the source "booth".
+	Source string
+	// Channel is the channel the song plays on, see PlaybackOptions.Channel. It is empty for the music channel.
+	Channel string
+	// Listeners are the handles of the players hearing the song: the player and the members of their
+	// listening party. It is nil for DJ booths, which are heard by everyone in range.
+	Listeners []*world.EntityHandle
+}
+
+// ActivePlaybacks returns all songs currently playing on the server, sorted by player name: the songs of
+// all players, followed by those of all DJ booths.
+func ActivePlaybacks() []ActivePlayback {
+	playbacksMtx.Lock()
+	all := make([]*playback, 0, len(playbacks))
+	for _, pb := range playbacks {
+		all = append(all, pb)
+	}
+	playbacksMtx.Unlock()
+
+	active := make([]ActivePlayback, 0, len(all))
+	for _, pb := range all {
+		tick, tempo := int(pb.tick.Load()), newTempoCurve(pb.song, pb.opts)
+		source := pb.opts.Source
+		if source == "" {
+			source = "api"
+		}
+		active = append(active, ActivePlayback{
+			ID:         pb.id,
+			Player:     pb.eh,
+			PlayerName: pb.playerName,
+			Song:       pb.song,
+			Tick:       tick,
+			Elapsed:    tempo.elapsed(tick),
+			Total:      tempo.elapsed(pb.song.Length),
+			Paused:     pb.paused.Load(),
+			Source:     source,
+			Channel:    pb.opts.Channel,
+			Listeners:  append([]*world.EntityHandle{pb.eh}, partyMembers(pb.eh)...),
+		})
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].PlayerName != active[j].PlayerName {
+			return active[i].PlayerName < active[j].PlayerName
+		}
+		return active[i].Channel < active[j].Channel
+	})
+
+	boothsMtx.Lock()
+	open := make([]*DJBooth, 0, len(booths))
+	for _, b := range booths {
+		open = append(open, b)
+	}
+	boothsMtx.Unlock()
+	sort.Slice(open, func(i, j int) bool { return open[i].name < open[j].name })
+	for _, b := range open {
+		if song, ok := b.Playing(); ok {
+			active = append(active, ActivePlayback{PlayerName: b.name, Song: song, Source: "booth"})
+		}
+	}
+	return active
+}
+
+// ActiveCmd is the admin command listing all songs currently playing on the server.
+type ActiveCmd struct{}
+
+// AllowConsole allows this command from the server console.
+func (ActiveCmd) AllowConsole() bool { return true }
+
+// Allow only allows admins to run the command. See SetAdminChecker.
+func (ActiveCmd) Allow(src cmd.Source) bool { return isAdmin(src) }
+
+// Run lists all active playbacks with their listeners, elapsed time and source.
+func (c ActiveCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	active := ActivePlaybacks()
+	if len(active) == 0 {
+		output.Print("No songs are playing")
+		return
+	}
+	output.Printf("%d songs playing:", len(active))
+	for _, a := range active {
+		if a.Player == nil {
+			output.Printf("Booth %s: %s (%s)", a.PlayerName, a.Song.displayName(), a.Source)
+			continue
+		}
+		line := fmt.Sprintf("%d. %s: %s [%s / %s] (%s, %d listeners", a.ID, a.PlayerName, a.Song.displayName(),
+			formatDuration(a.Elapsed), formatDuration(a.Total), a.Source, len(a.Listeners))
+		if a.Channel != "" {
+			line += ", channel " + a.Channel
+		}
+		if a.Paused {
+			line += ", paused"
+		}
+		output.Print(line + ")")
+	}
+}
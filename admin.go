@@ -0,0 +1,175 @@
+package noteblockplayer
+
+import (
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// adminChecker holds the function set with SetAdminChecker.
+var adminChecker atomic.Pointer[func(src cmd.Source) bool]
+
+// SetAdminChecker sets the function deciding who may run admin commands, such as /stopallnb. Dragonfly has
+// no concept of operators, so by default only the server console may run them.
+//
+// Example usage:
+//
+//	noteblockplayer.SetAdminChecker(func(src cmd.Source) bool {
+//	    p, ok := src.(*player.Player)
+//	    return !ok || admins[p.Name()]
+//	})
+func SetAdminChecker(f func(src cmd.Source) bool) {
+	if f == nil {
+		adminChecker.Store(nil)
+		return
+	}
+	adminChecker.Store(&f)
+}
+
+// isAdmin reports whether the source may run admin commands.
+func isAdmin(src cmd.Source) bool {
+	if f := adminChecker.Load(); f != nil {
+		return (*f)(src)
+	}
+	_, isPlayer := src.(*player.Player)
+	return !isPlayer
+}
+
+// musicPaused is set by StopAll and cleared by ResumeAll. While it is set, ambient schedulers, scheduled
+// broadcasts and ambience zones start no songs.
+var musicPaused atomic.Bool
+
+// StopAllReport holds what StopAll stopped.
+type StopAllReport struct {
+	// Playbacks is the number of songs stopped that players were listening to, not counting ambience loops.
+	Playbacks int
+	// Booths is the number of DJ booths whose song was stopped.
+	Booths int
+	// Ambience is the number of ambience loops stopped.
+	Ambience int
+	// Broadcasts is the number of scheduled broadcasts paused.
+	Broadcasts int
+}
+
+// StopAll stops every song playing server-wide: the songs of all players on all channels, whose queues are
+// cleared, the songs of all DJ booths and the ambience loops. Ambient schedulers, scheduled broadcasts and
+// ambience zones are paused until ResumeAll is called, so they don't start new songs right away. It returns
+// what was stopped.
+func StopAll() StopAllReport {
+	musicPaused.Store(true)
+
+	playbacksMtx.Lock()
+	keys := make([]playbackKey, 0, len(playbacks))
+	for key := range playbacks {
+		keys = append(keys, key)
+	}
+	playbacksMtx.Unlock()
+
+	var report StopAllReport
+	for _, key := range keys {
+		if key.channel == "" {
+			clearQueue(key.eh)
+		}
+		if !stopPlayback(key) {
+			continue
+		}
+		if key.channel == AmbienceChannel {
+			report.Ambience++
+		} else {
+			report.Playbacks++
+		}
+	}
+
+	boothsMtx.Lock()
+	all := make([]*DJBooth, 0, len(booths))
+	for _, b := range booths {
+		all = append(all, b)
+	}
+	boothsMtx.Unlock()
+	for _, b := range all {
+		if _, ok := b.Playing(); ok {
+			b.Stop()
+			report.Booths++
+		}
+	}
+	report.Broadcasts = len(Broadcasts())
+	return report
+}
+
+// ResumeAll resumes the ambient schedulers, scheduled broadcasts and ambience zones paused by StopAll.
+// Returns false if they were not paused.
+func ResumeAll() bool {
+	return musicPaused.Swap(false)
+}
+
+// StopPlayback stops the playback with the ID passed, as listed by ActivePlaybacks and /nbactive, without
+// stopping the songs playing on the other channels of the player or clearing their queue. Returns true if
+// the playback was still playing.
+func StopPlayback(id int) bool {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	for key, pb := range playbacks {
+		if pb.id == id {
+			pb.send(control{kind: controlStop})
+			delete(playbacks, key)
+			return true
+		}
+	}
+	return false
+}
+
+// StopPlaybackCmd is the admin command to stop a single playback by its ID.
+type StopPlaybackCmd struct {
+	ID int `cmd:"id"`
+}
+
+// AllowConsole allows this command from the server console.
+func (StopPlaybackCmd) AllowConsole() bool { return true }
+
+// Allow only allows admins to run the command. See SetAdminChecker.
+func (StopPlaybackCmd) Allow(src cmd.Source) bool { return isAdmin(src) }
+
+// Run stops the playback with the ID passed.
+func (c StopPlaybackCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if !StopPlayback(c.ID) {
+		output.Errorf("No playback with ID %d is playing", c.ID)
+		return
+	}
+	output.Printf("Stopped playback %d", c.ID)
+}
+
+// StopAllCmd is the admin command to stop every song playing server-wide.
+type StopAllCmd struct{}
+
+// AllowConsole allows this command from the server console.
+func (StopAllCmd) AllowConsole() bool { return true }
+
+// Allow only allows admins to run the command. See SetAdminChecker.
+func (StopAllCmd) Allow(src cmd.Source) bool { return isAdmin(src) }
+
+// Run stops all playbacks and reports what was stopped.
+func (c StopAllCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	report := StopAll()
+	output.Printf("Stopped %d playbacks, %d DJ booths and %d ambience loops", report.Playbacks, report.Booths, report.Ambience)
+	output.Printf("Ambient music, ambience and %d scheduled broadcasts are paused until /resumeallnb", report.Broadcasts)
+}
+
+// ResumeAllCmd is the admin command to resume the music paused by /stopallnb.
+type ResumeAllCmd struct{}
+
+// AllowConsole allows this command from the server console.
+func (ResumeAllCmd) AllowConsole() bool { return true }
+
+// Allow only allows admins to run the command. See SetAdminChecker.
+func (ResumeAllCmd) Allow(src cmd.Source) bool { return isAdmin(src) }
+
+// Run resumes the ambient music, ambience and scheduled broadcasts.
+func (c ResumeAllCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if !ResumeAll() {
+		output.Error("Nothing is paused")
+		return
+	}
+	output.Print("Ambient music, ambience and scheduled broadcasts resumed")
+}
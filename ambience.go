@@ -0,0 +1,160 @@
+package noteblockplayer
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// AmbienceChannel is the channel ambience loops are played on, independently of the music. Its volume is 0.5
+// by default and can be changed with SetChannelVolume.
+const AmbienceChannel = "ambience"
+
+// defaultAmbienceVolume is the volume of the AmbienceChannel if none was set with SetChannelVolume.
+const defaultAmbienceVolume = 0.5
+
+// AmbienceZone is a looping background sound, such as wind, a crowd or the hum of machines authored as a
+// song, played to the players within a zone of a world for as long as they stay in it.
+type AmbienceZone struct {
+	// Name identifies the ambience zone.
+	Name string
+	// Song is the name of the song looped.
+	Song string
+	// World is the name of the world of the zone. If empty, the zone is in every world passed to
+	// SetAmbienceWorlds.
+	World string
+	// Zone, if set, limits the ambience to the players within it. If nil, it plays in the whole world.
+	Zone *Zone
+}
+
+// ambienceZones holds the zones added with AddAmbienceZone, ambienceWorlds the worlds set with
+// SetAmbienceWorlds and ambienceListeners the ambience playing to every player. ambienceMtx protects access
+// to all of them.
+var (
+	ambienceZones     []AmbienceZone
+	ambienceWorlds    []*world.World
+	ambienceListeners = make(map[*world.EntityHandle]ambienceListener)
+	ambienceMtx       sync.Mutex
+
+	ambienceOnce sync.Once
+)
+
+// ambienceListener is the ambience zone a player is in, and the playback of its song.
+type ambienceListener struct {
+	zone     string
+	playback *Playback
+}
+
+// SetAmbienceWorlds sets the worlds the players of are checked for being in an ambience zone.
+func SetAmbienceWorlds(worlds ...*world.World) {
+	ambienceMtx.Lock()
+	defer ambienceMtx.Unlock()
+	ambienceWorlds = slices.Clone(worlds)
+	ambienceOnce.Do(func() {
+		go runAmbience()
+	})
+}
+
+// AddAmbienceZone adds the ambience zone passed, replacing any zone with the same name. Players are checked
+// every second: those in the zone hear its song looping on the AmbienceChannel, and it stops once they leave.
+// If zones overlap, the zone added first is played.
+//
+// Example usage:
+//
+//	noteblockplayer.SetAmbienceWorlds(srv.World())
+//	_ = noteblockplayer.AddAmbienceZone(noteblockplayer.AmbienceZone{
+//	    Name: "factory",
+//	    Song: "machine_hum",
+//	    Zone: &noteblockplayer.Zone{Min: mgl64.Vec3{100, 60, 100}, Max: mgl64.Vec3{150, 90, 150}},
+//	})
+func AddAmbienceZone(z AmbienceZone) error {
+	if z.Name == "" || z.Song == "" {
+		return errors.New("ambience zones need a name and a song")
+	}
+	ambienceMtx.Lock()
+	defer ambienceMtx.Unlock()
+	if i := slices.IndexFunc(ambienceZones, func(other AmbienceZone) bool { return other.Name == z.Name }); i >= 0 {
+		ambienceZones[i] = z
+		return nil
+	}
+	ambienceZones = append(ambienceZones, z)
+	return nil
+}
+
+// RemoveAmbienceZone removes the ambience zone with the name passed. Players in it stop hearing its song
+// within a second. Returns false if no zone with the name exists.
+func RemoveAmbienceZone(name string) bool {
+	ambienceMtx.Lock()
+	defer ambienceMtx.Unlock()
+	n := len(ambienceZones)
+	ambienceZones = slices.DeleteFunc(ambienceZones, func(z AmbienceZone) bool { return z.Name == name })
+	return len(ambienceZones) < n
+}
+
+// AmbienceZones returns all ambience zones, in the order they were added.
+func AmbienceZones() []AmbienceZone {
+	ambienceMtx.Lock()
+	defer ambienceMtx.Unlock()
+	return slices.Clone(ambienceZones)
+}
+
+// runAmbience checks every second which ambience zone every player is in, and starts or stops the ambience
+// playing to them accordingly.
+func runAmbience() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		ambienceMtx.Lock()
+		zones, worlds := slices.Clone(ambienceZones), slices.Clone(ambienceWorlds)
+		ambienceMtx.Unlock()
+
+		in := make(map[*world.EntityHandle]AmbienceZone)
+		if musicPaused.Load() {
+			// All music was stopped with StopAll: every player is treated as being outside of all zones.
+			worlds = nil
+		}
+		for _, w := range worlds {
+			<-w.Exec(func(tx *world.Tx) {
+				for e := range tx.Players() {
+					for _, z := range zones {
+						if (z.World == "" || z.World == w.Name()) && (z.Zone == nil || z.Zone.Contains(e.Position())) {
+							in[e.H()] = z
+							break
+						}
+					}
+				}
+			})
+		}
+		updateAmbience(in)
+	}
+}
+
+// updateAmbience plays the song of the ambience zone every player of the map passed is in, and stops the
+// ambience of players who are no longer in any zone.
+func updateAmbience(in map[*world.EntityHandle]AmbienceZone) {
+	ambienceMtx.Lock()
+	defer ambienceMtx.Unlock()
+	for eh, l := range ambienceListeners {
+		if z, ok := in[eh]; !ok || z.Name != l.zone || !l.playback.Playing() {
+			l.playback.Stop()
+			delete(ambienceListeners, eh)
+		}
+	}
+	for eh, z := range in {
+		if _, ok := ambienceListeners[eh]; ok {
+			continue
+		}
+		song, err := flexSongLoader(z.Song)
+		if err != nil {
+			continue
+		}
+		pb, err := PlaySong(eh, song, PlaybackOptions{Channel: AmbienceChannel, Loop: LoopForever, Source: "ambience"})
+		if err != nil {
+			continue
+		}
+		ambienceListeners[eh] = ambienceListener{zone: z.Name, playback: pb}
+	}
+}
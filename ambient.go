@@ -0,0 +1,251 @@
+package noteblockplayer
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// AmbientScheduler plays background music to players, like the vanilla game does: after a random delay, a
+// random song with the configured tag is played, and once it ends the next one follows after another delay.
+// While a player listens to a song started any other way, for example with /playnoteblock, or muted
+// broadcast music with /nbmute, no ambient songs are played to them.
+type AmbientScheduler struct {
+	tag                string
+	minDelay, maxDelay time.Duration
+	opts               PlaybackOptions
+
+	mu        sync.Mutex
+	listeners map[*world.EntityHandle]chan struct{}
+	timeTags  map[TimeOfDay]string
+	biomeTags map[string]string
+}
+
+// TimeOfDay is a part of the in-game day.
+type TimeOfDay int
+
+const (
+	// Dawn is the sunrise, from 23000 to 1000 ticks of world time.
+	Dawn TimeOfDay = iota
+	// Day is from 1000 to 12000 ticks of world time.
+	Day
+	// Dusk is the sunset, from 12000 to 13000 ticks of world time.
+	Dusk
+	// Night is from 13000 to 23000 ticks of world time.
+	Night
+)
+
+// timeOfDay returns the part of the day of the world time passed.
+func timeOfDay(time int) TimeOfDay {
+	switch t := time % 24000; {
+	case t < 0:
+		return timeOfDay(t + 24000)
+	case t < 1000 || t >= 23000:
+		return Dawn
+	case t < 12000:
+		return Day
+	case t < 13000:
+		return Dusk
+	default:
+		return Night
+	}
+}
+
+// NewAmbientScheduler returns an AmbientScheduler playing songs with the tag passed (see TagSongs) after a
+// random delay between minDelay and maxDelay. The songs are played with the PlaybackOptions passed.
+//
+// Example usage:
+//
+//	ambient := noteblockplayer.NewAmbientScheduler("calm", 5*time.Minute, 20*time.Minute, noteblockplayer.PlaybackOptions{})
+//	ambient.Add(p.H())
+func NewAmbientScheduler(tag string, minDelay, maxDelay time.Duration, opts PlaybackOptions) *AmbientScheduler {
+	if opts.Source == "" {
+		opts.Source = "ambient"
+	}
+	return &AmbientScheduler{
+		tag:       tag,
+		minDelay:  minDelay,
+		maxDelay:  max(minDelay, maxDelay),
+		opts:      opts,
+		listeners: make(map[*world.EntityHandle]chan struct{}),
+	}
+}
+
+// Add starts playing ambient songs to the player behind the handle passed. Players are removed
+// automatically once they disconnect.
+func (a *AmbientScheduler) Add(eh *world.EntityHandle) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.listeners[eh]; ok {
+		return
+	}
+	stop := make(chan struct{})
+	a.listeners[eh] = stop
+	go a.run(eh, stop)
+}
+
+// Remove stops playing ambient songs to the player. An ambient song that is playing is stopped as well.
+func (a *AmbientScheduler) Remove(eh *world.EntityHandle) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if stop, ok := a.listeners[eh]; ok {
+		close(stop)
+		delete(a.listeners, eh)
+	}
+}
+
+// remove removes the player from the scheduler if stop is still the stop channel of the player.
+func (a *AmbientScheduler) remove(eh *world.EntityHandle, stop chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listeners[eh] == stop {
+		close(stop)
+		delete(a.listeners, eh)
+	}
+}
+
+// Close removes all players from the scheduler.
+func (a *AmbientScheduler) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for eh, stop := range a.listeners {
+		close(stop)
+		delete(a.listeners, eh)
+	}
+}
+
+// SetTimeTag makes the scheduler pick songs with the tag passed during the part of the day passed, instead of
+// songs with its own tag. The time of day is checked in the player's world whenever a new song is picked,
+// so a song that started at dusk keeps playing into the night. Passing an empty tag removes the tag of the
+// part of the day.
+//
+// Example usage:
+//
+//	ambient.SetTimeTag(noteblockplayer.Night, "night")
+//	ambient.SetTimeTag(noteblockplayer.Dawn, "morning")
+func (a *AmbientScheduler) SetTimeTag(t TimeOfDay, tag string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if tag == "" {
+		delete(a.timeTags, t)
+		return
+	}
+	if a.timeTags == nil {
+		a.timeTags = make(map[TimeOfDay]string)
+	}
+	a.timeTags[t] = tag
+}
+
+// SetBiomeTag makes the scheduler pick songs with the tag passed while the player stands in the biome with
+// the name passed (as returned by world.Biome.String(), for example "plains"). The biome is checked
+// whenever a new song is picked. Biome tags take precedence over time tags set with SetTimeTag. Passing an
+// empty tag removes the tag of the biome.
+//
+// Example usage:
+//
+//	ambient.SetBiomeTag("desert", "desert")
+//	ambient.SetBiomeTag(biome.Ocean{}.String(), "sea")
+func (a *AmbientScheduler) SetBiomeTag(biome, tag string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if tag == "" {
+		delete(a.biomeTags, biome)
+		return
+	}
+	if a.biomeTags == nil {
+		a.biomeTags = make(map[string]string)
+	}
+	a.biomeTags[biome] = tag
+}
+
+// tagFor returns the tag of the songs to pick from for the player next, based on the biome they are in and
+// the time of day of their world.
+func (a *AmbientScheduler) tagFor(eh *world.EntityHandle) string {
+	a.mu.Lock()
+	conditional := len(a.timeTags) > 0 || len(a.biomeTags) > 0
+	a.mu.Unlock()
+	if !conditional {
+		return a.tag
+	}
+	var (
+		t     TimeOfDay
+		biome string
+	)
+	_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		t = timeOfDay(tx.World().Time())
+		biome = tx.Biome(cube.PosFromVec3(ent.Position())).String()
+	})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if tag, ok := a.biomeTags[biome]; ok {
+		return tag
+	}
+	if tag, ok := a.timeTags[t]; ok {
+		return tag
+	}
+	return a.tag
+}
+
+// delay returns a random delay between the minimum and maximum delay of the scheduler.
+func (a *AmbientScheduler) delay() time.Duration {
+	if a.maxDelay <= a.minDelay {
+		return a.minDelay
+	}
+	return a.minDelay + rand.N(a.maxDelay-a.minDelay)
+}
+
+// pick returns a random song to play next to the player.
+func (a *AmbientScheduler) pick(eh *world.EntityHandle) (*Song, bool) {
+	names := SongsWithTag(a.tagFor(eh))
+	for len(names) > 0 {
+		i := rand.N(len(names))
+		song, err := flexSongLoader(names[i])
+		if err == nil {
+			return song, true
+		}
+		// Skip songs that can't be loaded, so a single broken file doesn't stop the ambient music.
+		names = append(names[:i], names[i+1:]...)
+	}
+	return nil, false
+}
+
+// run plays ambient songs to the player until the stop channel is closed or the player disconnects.
+func (a *AmbientScheduler) run(eh *world.EntityHandle, stop chan struct{}) {
+	defer a.remove(eh, stop)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(a.delay()):
+		}
+		if !eh.ExecWorld(func(*world.Tx, world.Entity) {}) {
+			// The player disconnected.
+			return
+		}
+		if isPlaying(eh) || IsMuted(eh) || musicPaused.Load() {
+			// The player is listening to another song or muted broadcast music, or all music was stopped with
+			// StopAll: try again after the next delay.
+			continue
+		}
+		song, ok := a.pick(eh)
+		if !ok {
+			continue
+		}
+		done := make(chan struct{})
+		go func() {
+			playSong(eh, song, a.opts)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-stop:
+			if pb, ok := currentPlayback(eh); ok && pb.song == song {
+				pb.send(control{kind: controlStop})
+			}
+			return
+		}
+	}
+}
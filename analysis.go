@@ -0,0 +1,137 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// SongInfo holds statistics about a song, as computed by AnalyzeSong.
+type SongInfo struct {
+	Title          string
+	Author         string
+	OriginalAuthor string
+	Description    string
+	Version        int     // NBS file version, 0 if unknown
+	Tempo          float64 // Ticks per second
+	Length         int     // Length in ticks
+	Duration       float64 // Duration in seconds
+
+	NoteCount  int
+	LayersUsed int
+	// Instruments maps instrument indices to the number of notes played with them.
+	Instruments map[int]int
+	// PeakNotesPerSecond is the highest number of notes played within any one second of the song.
+	PeakNotesPerSecond int
+}
+
+// AnalyzeSong computes statistics about the song: the header fields, plus a scan over all notes for note
+// count, layers, instrument breakdown and peak note density.
+func AnalyzeSong(song *Song) SongInfo {
+	info := SongInfo{
+		Title:          song.Title,
+		Author:         song.Author,
+		OriginalAuthor: song.OriginalAuthor,
+		Description:    song.Description,
+		Version:        song.Version,
+		Tempo:          song.Tempo,
+		Length:         song.Length,
+		Duration:       songElapsed(song, song.Length).Seconds(),
+		NoteCount:      len(song.Notes),
+		Instruments:    make(map[int]int),
+	}
+
+	layers := make(map[int]struct{})
+	perTick := make(map[int]int)
+	for _, n := range song.Notes {
+		layers[n.Layer] = struct{}{}
+		info.Instruments[n.Instrument]++
+		perTick[n.Tick]++
+	}
+	info.LayersUsed = len(layers)
+
+	// Slide a window of one second over the song to find the densest second. The start time of every tick
+	// follows the tempo changes of the song.
+	ticks := make([]int, 0, len(perTick))
+	for tick := range perTick {
+		ticks = append(ticks, tick)
+	}
+	sort.Ints(ticks)
+	var starts []time.Duration
+	if len(ticks) > 0 {
+		starts = newTempoCurve(song, PlaybackOptions{}).tickStarts(max(ticks[len(ticks)-1], 0))
+	}
+	startOf := func(tick int) time.Duration { return starts[max(tick, 0)] }
+	sum, start := 0, 0
+	for _, tick := range ticks {
+		sum += perTick[tick]
+		for startOf(ticks[start]) <= startOf(tick)-time.Second {
+			sum -= perTick[ticks[start]]
+			start++
+		}
+		info.PeakNotesPerSecond = max(info.PeakNotesPerSecond, sum)
+	}
+	return info
+}
+
+// instrumentNames holds readable names of the instruments, by index.
+var instrumentNames = []string{
+	"Piano", "Bass Drum", "Snare", "Clicks", "Bass", "Flute", "Bell", "Guitar",
+	"Chimes", "Xylophone", "Iron Xylophone", "Cow Bell", "Didgeridoo", "Bit", "Banjo", "Pling",
+}
+
+// instrumentName returns the readable name of an instrument index.
+func instrumentName(instrument int) string {
+	if instrument >= 0 && instrument < len(instrumentNames) {
+		return instrumentNames[instrument]
+	}
+	return fmt.Sprintf("Custom #%d", instrument)
+}
+
+// InfoCmd is the command to show statistics about a song file.
+type InfoCmd struct {
+	Filename string `cmd:"filename"`
+}
+
+// AllowConsole allows this command from the server console.
+func (InfoCmd) AllowConsole() bool { return true }
+
+// Run loads the song in the background and prints its statistics.
+func (c InfoCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		info := AnalyzeSong(song)
+
+		if credits := song.credits(); credits != "" {
+			output.Printf("§l%s§r by %s", song.displayName(), credits)
+		} else {
+			output.Printf("§l%s", song.displayName())
+		}
+		if info.Description != "" {
+			output.Printf("§o%s", info.Description)
+		}
+		if info.Version > 0 {
+			output.Printf("File version: %d", info.Version)
+		}
+		output.Printf("Tempo: %.2f t/s, length: %d ticks (%s)", info.Tempo, info.Length, formatDuration(songElapsed(song, song.Length)))
+		output.Printf("Notes: %d on %d layer(s), peak %d notes/s", info.NoteCount, info.LayersUsed, info.PeakNotesPerSecond)
+
+		instruments := make([]int, 0, len(info.Instruments))
+		for i := range info.Instruments {
+			instruments = append(instruments, i)
+		}
+		sort.Ints(instruments)
+		parts := make([]string, 0, len(instruments))
+		for _, i := range instruments {
+			parts = append(parts, fmt.Sprintf("%s %d", instrumentName(i), info.Instruments[i]))
+		}
+		output.Printf("Instruments: %s", strings.Join(parts, ", "))
+	})
+}
@@ -0,0 +1,33 @@
+package noteblockplayer
+
+import "math"
+
+// Attenuation is a curve lowering the volume of a song with the distance of the listener to where it is
+// played from, for songs played from a position, such as those of a DJBooth. The sounds are played at the
+// position of every listener with the volume of the curve, so it replaces the attenuation of the client.
+// The zero value doesn't lower the volume at all.
+type Attenuation struct {
+	// MaxDistance is the distance in blocks at which the volume has dropped to MinVolume. Listeners further
+	// away hear the song at MinVolume. A MaxDistance of 0 disables the attenuation.
+	MaxDistance float64
+	// Rolloff is the exponent of the curve. With 1, the volume drops evenly with the distance. Higher values
+	// keep the song loud close to the source and drop it off quickly near MaxDistance, while values between
+	// 0 and 1 drop it quickly close to the source. It defaults to 1.
+	Rolloff float64
+	// MinVolume is the volume, from 0 to 1, the song is heard at from MaxDistance on.
+	MinVolume float64
+}
+
+// Volume returns the volume, from 0 to 1, a listener at the distance passed hears the song at.
+func (a Attenuation) Volume(distance float64) float64 {
+	if a.MaxDistance <= 0 {
+		return 1
+	}
+	rolloff := a.Rolloff
+	if rolloff <= 0 {
+		rolloff = 1
+	}
+	minVolume := min(max(a.MinVolume, 0), 1)
+	t := min(max(distance/a.MaxDistance, 0), 1)
+	return 1 - (1-minVolume)*math.Pow(t, rolloff)
+}
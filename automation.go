@@ -0,0 +1,128 @@
+package noteblockplayer
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// AutomationNote is a note of the automation instrument reached by a playback, see SetAutomationInstrument.
+// Its key and velocity are the parameters of the automation, as authored in Note Block Studio.
+type AutomationNote struct {
+	// PlaybackID is the ID of the playback, see StopPlayback.
+	PlaybackID int
+	Player     *world.EntityHandle
+	Song       *Song
+	Tick       int
+	Layer      int
+	Key        int
+	Velocity   int
+}
+
+// automationInstrument is the instrument index set with SetAutomationInstrument, or -1 if none is set.
+var automationInstrument atomic.Int64
+
+func init() {
+	automationInstrument.Store(-1)
+}
+
+// automationHandlers holds the functions registered with OnAutomationNote by id.
+// automationHandlersMtx protects access to automationHandlers and nextAutomationHandlerID.
+var (
+	automationHandlers      = make(map[int]func(AutomationNote))
+	nextAutomationHandlerID int
+	automationHandlersMtx   sync.Mutex
+)
+
+// SetAutomationInstrument reserves the instrument index passed, such as 255, for automation: notes of that
+// instrument are not played as sound, but call the functions registered with OnAutomationNote with their key
+// and velocity instead. This makes an automation channel that is authored directly in Note Block Studio,
+// with a layer of notes using a custom instrument. A negative index turns automation off again, which is the
+// default. Songs that are already playing keep the instrument they started with.
+//
+// Example usage:
+//
+//	noteblockplayer.SetAutomationInstrument(255)
+//	noteblockplayer.OnAutomationNote(func(n noteblockplayer.AutomationNote) {
+//	    // dim the stage lights to the velocity of the note
+//	})
+func SetAutomationInstrument(instrument int) {
+	automationInstrument.Store(int64(max(instrument, -1)))
+}
+
+// AutomationInstrument returns the instrument index set with SetAutomationInstrument, or -1 if automation is
+// off.
+func AutomationInstrument() int {
+	return int(automationInstrument.Load())
+}
+
+// isAutomation reports whether notes of the instrument passed are automation notes.
+func isAutomation(instrument int) bool {
+	return instrument >= 0 && int64(instrument) == automationInstrument.Load()
+}
+
+// OnAutomationNote registers a function called for every AutomationNote reached by every playback, and
+// returns a function that unregisters it again. The function is called from the goroutine running the
+// playback, so it must not block.
+func OnAutomationNote(f func(AutomationNote)) (cancel func()) {
+	automationHandlersMtx.Lock()
+	defer automationHandlersMtx.Unlock()
+	id := nextAutomationHandlerID
+	nextAutomationHandlerID++
+	automationHandlers[id] = f
+	return func() {
+		automationHandlersMtx.Lock()
+		defer automationHandlersMtx.Unlock()
+		delete(automationHandlers, id)
+	}
+}
+
+// automationSchedule returns the automation notes of the song indexed by their tick, or nil if automation is
+// off or the song has none.
+func automationSchedule(song *Song) map[int][]Note {
+	instrument := AutomationInstrument()
+	if instrument < 0 {
+		return nil
+	}
+	var automation map[int][]Note
+	for _, note := range song.Notes {
+		if note.Tick < 0 || note.Instrument != instrument {
+			continue
+		}
+		if automation == nil {
+			automation = make(map[int][]Note)
+		}
+		automation[note.Tick] = append(automation[note.Tick], note)
+	}
+	return automation
+}
+
+// emitAutomation calls all registered automation handlers for the automation notes of a tick, leaving out
+// those on layers muted for the playback.
+func emitAutomation(pb *playback, notes []Note) {
+	automationHandlersMtx.Lock()
+	handlers := make([]func(AutomationNote), 0, len(automationHandlers))
+	for _, f := range automationHandlers {
+		handlers = append(handlers, f)
+	}
+	automationHandlersMtx.Unlock()
+
+	for _, note := range notes {
+		if !pb.layers.allows(note.Layer) {
+			continue
+		}
+		n := AutomationNote{
+			PlaybackID: pb.id,
+			Player:     pb.eh,
+			Song:       pb.song,
+			Tick:       note.Tick,
+			Layer:      note.Layer,
+			Key:        note.Key,
+			Velocity:   note.Velocity,
+		}
+		for _, f := range handlers {
+			f(n)
+		}
+	}
+}
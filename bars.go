@@ -0,0 +1,112 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// Note Block Studio divides every beat into four ticks, and has four beats in a bar unless the song sets
+// another time signature.
+const (
+	ticksPerBeat         = 4
+	defaultTimeSignature = 4
+)
+
+// BeatsPerBar returns the number of beats in a bar of the song, as set by its time signature.
+func (s *Song) BeatsPerBar() int {
+	if s.TimeSignature <= 0 {
+		return defaultTimeSignature
+	}
+	return s.TimeSignature
+}
+
+// TickAtBar returns the tick the bar passed starts at. Bars are counted from 1, like in Note Block Studio,
+// and bars below 1 return tick 0.
+func (s *Song) TickAtBar(bar int) int {
+	return max(bar-1, 0) * s.BeatsPerBar() * ticksPerBeat
+}
+
+// BarAtTick returns the bar and the beat within that bar the tick passed falls in, both counted from 1.
+func (s *Song) BarAtTick(tick int) (bar, beat int) {
+	tick = max(tick, 0)
+	ticksPerBar := s.BeatsPerBar() * ticksPerBeat
+	return tick/ticksPerBar + 1, tick%ticksPerBar/ticksPerBeat + 1
+}
+
+// parseOffset parses an offset into the song passed, played with the PlaybackOptions passed, and returns the
+// tick it points to. Offsets are ticks ending in "t" ("600t"), seconds ending in "s" ("90s", "1.5s") or
+// minutes and seconds ("1:30"). Times follow the tempo changes of the song.
+func parseOffset(s string, song *Song, opts PlaybackOptions) (int, error) {
+	tempo := newTempoCurve(song, opts)
+	var tick int
+	switch {
+	case strings.HasSuffix(s, "t"):
+		t, err := strconv.Atoi(strings.TrimSuffix(s, "t"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid tick %q", s)
+		}
+		tick = t
+	case strings.HasSuffix(s, "s"):
+		sec, err := strconv.ParseFloat(strings.TrimSuffix(s, "s"), 64)
+		if err != nil || math.IsNaN(sec) || math.IsInf(sec, 0) {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		tick = tempo.tickAt(secondsDuration(sec))
+	default:
+		minutes, seconds, ok := strings.Cut(s, ":")
+		m, err1 := strconv.Atoi(minutes)
+		sec, err2 := strconv.ParseFloat(seconds, 64)
+		if !ok || err1 != nil || err2 != nil || sec < 0 || sec >= 60 {
+			return 0, fmt.Errorf("invalid offset %q: use a time like 90s or 1:30, or a tick like 600t", s)
+		}
+		tick = tempo.tickAt(secondsDuration(float64(m)*60 + sec))
+	}
+	if tick < 0 {
+		return 0, fmt.Errorf("offset %q is negative", s)
+	}
+	if tick > song.Length {
+		return 0, fmt.Errorf("the song is only %s (%d ticks) long", formatDuration(tempo.elapsed(song.Length)), song.Length)
+	}
+	return tick, nil
+}
+
+// SeekNoteblockToBar makes the song currently playing for the player jump to the start of the bar passed,
+// counted from 1. Returns true if a song was playing.
+func SeekNoteblockToBar(eh *world.EntityHandle, bar int) bool {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	pb, ok := playbacks[musicKey(eh)]
+	if ok {
+		pb.send(control{kind: controlSeek, tick: pb.song.TickAtBar(bar)})
+	}
+	return ok
+}
+
+// SeekCmd is the command to make the song playing jump to the start of a bar.
+type SeekCmd struct {
+	Bar int `cmd:"bar"`
+}
+
+// Run seeks the song playing for the player to the bar passed.
+func (c SeekCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbseek command is only valid for players")
+		return
+	}
+	if c.Bar < 1 {
+		output.Error("Bars are counted from 1")
+		return
+	}
+	if !SeekNoteblockToBar(p.H(), c.Bar) {
+		output.Error("No song is currently playing")
+		return
+	}
+	output.Printf("Jumped to bar %d", c.Bar)
+}
@@ -0,0 +1,419 @@
+package noteblockplayer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Broadcast is a song played to every player of a world or zone at a set time, for example an hourly chime
+// or the theme of an event starting at 8pm.
+type Broadcast struct {
+	// Name identifies the broadcast.
+	Name string `json:"name"`
+	// Song is the name of the song played.
+	Song string `json:"song"`
+	// At is when the song is played: "20:00" plays it every day at 8pm server time, "*:00" every hour on the
+	// hour, and "game:13000" whenever the world time reaches 13000 ticks (nightfall).
+	At string `json:"at"`
+	// World is the name of the world the song is played in. If empty, it is played in every world passed
+	// to SetBroadcastWorlds.
+	World string `json:"world,omitempty"`
+	// Zone, if set, limits the broadcast to the players within it.
+	Zone *Zone `json:"zone,omitempty"`
+	// Interrupt plays the song to players who are listening to another song, replacing it. By default,
+	// those players are skipped.
+	Interrupt bool `json:"interrupt,omitempty"`
+}
+
+// Zone is a box in a world, from the corner Min to the corner Max.
+type Zone struct {
+	Min mgl64.Vec3 `json:"min"`
+	Max mgl64.Vec3 `json:"max"`
+}
+
+// Contains reports whether the position passed is within the zone.
+func (z Zone) Contains(pos mgl64.Vec3) bool {
+	for i := range 3 {
+		lo, hi := min(z.Min[i], z.Max[i]), max(z.Min[i], z.Max[i])
+		if pos[i] < lo || pos[i] > hi {
+			return false
+		}
+	}
+	return true
+}
+
+// broadcastTime is the parsed form of Broadcast.At.
+type broadcastTime struct {
+	// game is true for in-game times, in which case tick is the world time.
+	game bool
+	tick int
+	// hourly is true for times played every hour, in which case hour is unused.
+	hourly       bool
+	hour, minute int
+}
+
+// parseBroadcastTime parses the At field of a Broadcast.
+func parseBroadcastTime(at string) (broadcastTime, error) {
+	if tick, ok := strings.CutPrefix(at, "game:"); ok {
+		t, err := strconv.Atoi(tick)
+		if err != nil || t < 0 || t >= 24000 {
+			return broadcastTime{}, fmt.Errorf("invalid game time %q: must be a world time from 0 to 23999", tick)
+		}
+		return broadcastTime{game: true, tick: t}, nil
+	}
+	hour, minute, ok := strings.Cut(at, ":")
+	m, err := strconv.Atoi(minute)
+	if !ok || err != nil || m < 0 || m > 59 {
+		return broadcastTime{}, fmt.Errorf("invalid time %q: must be HH:MM, *:MM or game:TICKS", at)
+	}
+	if hour == "*" {
+		return broadcastTime{hourly: true, minute: m}, nil
+	}
+	h, err := strconv.Atoi(hour)
+	if err != nil || h < 0 || h > 23 {
+		return broadcastTime{}, fmt.Errorf("invalid time %q: must be HH:MM, *:MM or game:TICKS", at)
+	}
+	return broadcastTime{hour: h, minute: m}, nil
+}
+
+// dueAt reports whether a real-world time is due in the minute of the time passed.
+func (t broadcastTime) dueAt(now time.Time) bool {
+	return !t.game && now.Minute() == t.minute && (t.hourly || now.Hour() == t.hour)
+}
+
+// BroadcastStore persists the broadcasts added with AddBroadcast.
+type BroadcastStore interface {
+	// Load returns all stored broadcasts.
+	Load() ([]Broadcast, error)
+	// Save stores all broadcasts.
+	Save(broadcasts []Broadcast) error
+}
+
+// FileBroadcastStore is a BroadcastStore keeping the broadcasts in a JSON file.
+type FileBroadcastStore struct {
+	path string
+}
+
+// NewFileBroadcastStore returns a FileBroadcastStore reading from and writing to the JSON file at the path
+// passed. A file that does not exist yet is created on the first save.
+func NewFileBroadcastStore(path string) *FileBroadcastStore {
+	return &FileBroadcastStore{path: path}
+}
+
+// Load reads the broadcasts from the file. A file that does not exist yet holds no broadcasts.
+func (s *FileBroadcastStore) Load() ([]Broadcast, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var broadcasts []Broadcast
+	if err := json.Unmarshal(data, &broadcasts); err != nil {
+		return nil, err
+	}
+	return broadcasts, nil
+}
+
+// Save writes the broadcasts to the file.
+func (s *FileBroadcastStore) Save(broadcasts []Broadcast) error {
+	return writeJSONFile(s.path, broadcasts)
+}
+
+// broadcasts holds the broadcasts added with AddBroadcast, broadcastStore the store set with
+// SetBroadcastStore and broadcastWorlds the worlds set with SetBroadcastWorlds. broadcastsMtx protects access
+// to all of them.
+var (
+	broadcasts      []Broadcast
+	broadcastStore  BroadcastStore
+	broadcastWorlds []*world.World
+	broadcastsMtx   sync.Mutex
+
+	broadcastsOnce sync.Once
+)
+
+// SetBroadcastWorlds sets the worlds broadcasts are played in. Broadcasts with a World are only played in the
+// world with that name, others in all of them. Worlds of players adding a broadcast with /nbschedule are
+// added automatically.
+func SetBroadcastWorlds(worlds ...*world.World) {
+	broadcastsMtx.Lock()
+	defer broadcastsMtx.Unlock()
+	broadcastWorlds = slices.Clone(worlds)
+	startBroadcasts()
+}
+
+// addBroadcastWorld adds the world passed to the worlds broadcasts are played in.
+func addBroadcastWorld(w *world.World) {
+	broadcastsMtx.Lock()
+	defer broadcastsMtx.Unlock()
+	if !slices.Contains(broadcastWorlds, w) {
+		broadcastWorlds = append(broadcastWorlds, w)
+	}
+}
+
+// SetBroadcastStore sets the store broadcasts are saved to, and loads the broadcasts stored in it, replacing
+// those added so far. Without a store, broadcasts are only kept until the server stops.
+//
+// Example usage:
+//
+//	if err := noteblockplayer.SetBroadcastStore(noteblockplayer.NewFileBroadcastStore("noteblock_broadcasts.json")); err != nil {
+//	    // handle error
+//	}
+//	noteblockplayer.SetBroadcastWorlds(srv.World(), srv.Nether())
+func SetBroadcastStore(s BroadcastStore) error {
+	var loaded []Broadcast
+	if s != nil {
+		var err error
+		if loaded, err = s.Load(); err != nil {
+			return err
+		}
+	}
+	broadcastsMtx.Lock()
+	defer broadcastsMtx.Unlock()
+	broadcastStore, broadcasts = s, loaded
+	startBroadcasts()
+	return nil
+}
+
+// AddBroadcast schedules the broadcast passed, replacing any broadcast with the same name, and saves all
+// broadcasts to the store, if one is set.
+//
+// Example usage (a chime every hour and a theme every evening):
+//
+//	_ = noteblockplayer.AddBroadcast(noteblockplayer.Broadcast{Name: "chime", Song: "bells", At: "*:00"})
+//	_ = noteblockplayer.AddBroadcast(noteblockplayer.Broadcast{Name: "event", Song: "theme", At: "20:00", World: "World", Interrupt: true})
+func AddBroadcast(b Broadcast) error {
+	if b.Name == "" || b.Song == "" {
+		return errors.New("broadcasts need a name and a song")
+	}
+	if _, err := parseBroadcastTime(b.At); err != nil {
+		return err
+	}
+	broadcastsMtx.Lock()
+	defer broadcastsMtx.Unlock()
+	broadcasts = slices.DeleteFunc(slices.Clone(broadcasts), func(other Broadcast) bool {
+		return other.Name == b.Name
+	})
+	broadcasts = append(broadcasts, b)
+	startBroadcasts()
+	return saveBroadcasts()
+}
+
+// RemoveBroadcast removes the broadcast with the name passed and saves the remaining broadcasts to the store,
+// if one is set. It returns false if no broadcast has the name.
+func RemoveBroadcast(name string) (bool, error) {
+	broadcastsMtx.Lock()
+	defer broadcastsMtx.Unlock()
+	i := slices.IndexFunc(broadcasts, func(b Broadcast) bool { return b.Name == name })
+	if i < 0 {
+		return false, nil
+	}
+	broadcasts = slices.Delete(slices.Clone(broadcasts), i, i+1)
+	return true, saveBroadcasts()
+}
+
+// Broadcasts returns all scheduled broadcasts, in the order they were added.
+func Broadcasts() []Broadcast {
+	broadcastsMtx.Lock()
+	defer broadcastsMtx.Unlock()
+	return slices.Clone(broadcasts)
+}
+
+// saveBroadcasts saves the broadcasts to the store, if one is set. broadcastsMtx must be held.
+func saveBroadcasts() error {
+	if broadcastStore == nil {
+		return nil
+	}
+	return broadcastStore.Save(slices.Clone(broadcasts))
+}
+
+// startBroadcasts starts playing broadcasts once. broadcastsMtx must be held.
+func startBroadcasts() {
+	broadcastsOnce.Do(func() {
+		go runBroadcasts()
+	})
+}
+
+// runBroadcasts checks every second which broadcasts are due, and plays them.
+func runBroadcasts() {
+	// lastMinute is the minute real-world broadcasts were last played in, and lastTime the world time of
+	// every world when it was last checked, so every broadcast plays once when its time is reached.
+	var lastMinute time.Time
+	lastTime := make(map[*world.World]int)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		broadcastsMtx.Lock()
+		all, worlds := slices.Clone(broadcasts), slices.Clone(broadcastWorlds)
+		broadcastsMtx.Unlock()
+
+		minute := now.Truncate(time.Minute)
+		newMinute := !minute.Equal(lastMinute)
+		lastMinute = minute
+		for _, w := range worlds {
+			cur := w.Time()
+			prev, checked := lastTime[w]
+			lastTime[w] = cur
+			for _, b := range all {
+				if b.World != "" && b.World != w.Name() {
+					continue
+				}
+				t, err := parseBroadcastTime(b.At)
+				if err != nil {
+					continue
+				}
+				if musicPaused.Load() {
+					// All music was stopped with StopAll, broadcasts due in the meantime are skipped.
+					continue
+				}
+				if (t.game && checked && reachedTick(prev, cur, t.tick)) || (newMinute && t.dueAt(now)) {
+					go playBroadcast(w, b)
+				}
+			}
+		}
+	}
+}
+
+// reachedTick reports whether the world time passed the time of day tick between the world times prev and
+// cur, which may be on different days.
+func reachedTick(prev, cur, tick int) bool {
+	if cur <= prev || cur-prev >= 24000 {
+		// The time was set back, or stopped, or jumped more than a day: nothing is played.
+		return false
+	}
+	next := prev - prev%24000 + tick
+	if next <= prev {
+		next += 24000
+	}
+	return next <= cur
+}
+
+// playBroadcast plays the song of the broadcast to every player in the world passed within its zone,
+// except players who muted broadcast music, and players listening to another song unless the broadcast
+// interrupts them.
+func playBroadcast(w *world.World, b Broadcast) {
+	song, err := flexSongLoader(b.Song)
+	if err != nil {
+		return
+	}
+	var listeners []*world.EntityHandle
+	<-w.Exec(func(tx *world.Tx) {
+		for e := range tx.Players() {
+			if b.Zone == nil || b.Zone.Contains(e.Position()) {
+				listeners = append(listeners, e.H())
+			}
+		}
+	})
+	for _, eh := range listeners {
+		if IsMuted(eh) || (!b.Interrupt && isPlaying(eh)) {
+			continue
+		}
+		go playSong(eh, song, PlaybackOptions{Source: "broadcast"})
+	}
+}
+
+// ScheduleListCmd is the admin command listing the scheduled broadcasts.
+type ScheduleListCmd struct {
+	List cmd.SubCommand `cmd:"list"`
+}
+
+// AllowConsole allows this command from the server console.
+func (ScheduleListCmd) AllowConsole() bool { return true }
+
+// Allow only allows admins to run the command. See SetAdminChecker.
+func (ScheduleListCmd) Allow(src cmd.Source) bool { return isAdmin(src) }
+
+// Run lists the scheduled broadcasts.
+func (c ScheduleListCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	all := Broadcasts()
+	if len(all) == 0 {
+		output.Print("No broadcasts scheduled, add one with /nbschedule add <name> <song> <at>")
+		return
+	}
+	output.Printf("%d broadcasts scheduled:", len(all))
+	for _, b := range all {
+		where := "every world"
+		if b.World != "" {
+			where = b.World
+		}
+		if b.Zone != nil {
+			where += " (zone)"
+		}
+		output.Printf("§e%s§r: %s at %s in %s", b.Name, b.Song, b.At, where)
+	}
+}
+
+// ScheduleAddCmd is the admin command scheduling a broadcast in the world of the player running it, or in
+// every world if run from the console.
+type ScheduleAddCmd struct {
+	Add       cmd.SubCommand     `cmd:"add"`
+	Name      string             `cmd:"name"`
+	Song      string             `cmd:"song"`
+	At        string             `cmd:"at"`
+	Interrupt cmd.Optional[bool] `cmd:"interrupt"`
+}
+
+// AllowConsole allows this command from the server console.
+func (ScheduleAddCmd) AllowConsole() bool { return true }
+
+// Allow only allows admins to run the command. See SetAdminChecker.
+func (ScheduleAddCmd) Allow(src cmd.Source) bool { return isAdmin(src) }
+
+// Run checks in the background that the song exists and schedules the broadcast.
+func (c ScheduleAddCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	loadSongForCmd(src, w, c.Song, func(src cmd.Source, output *cmd.Output, tx *world.Tx, _ *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		b := Broadcast{Name: c.Name, Song: c.Song, At: c.At, Interrupt: c.Interrupt.LoadOr(false)}
+		if _, ok := src.(*player.Player); ok {
+			b.World = tx.World().Name()
+			addBroadcastWorld(tx.World())
+		}
+		if err := AddBroadcast(b); err != nil {
+			output.Errorf("Failed to schedule broadcast: %v", err)
+			return
+		}
+		output.Printf("Scheduled %s to play %s at %s", b.Name, b.Song, b.At)
+	})
+}
+
+// ScheduleRemoveCmd is the admin command removing a scheduled broadcast.
+type ScheduleRemoveCmd struct {
+	Remove cmd.SubCommand `cmd:"remove"`
+	Name   string         `cmd:"name"`
+}
+
+// AllowConsole allows this command from the server console.
+func (ScheduleRemoveCmd) AllowConsole() bool { return true }
+
+// Allow only allows admins to run the command. See SetAdminChecker.
+func (ScheduleRemoveCmd) Allow(src cmd.Source) bool { return isAdmin(src) }
+
+// Run removes the broadcast.
+func (c ScheduleRemoveCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	ok, err := RemoveBroadcast(c.Name)
+	if !ok {
+		output.Errorf("No broadcast is named %s", c.Name)
+		return
+	}
+	if err != nil {
+		output.Errorf("Removed %s, but failed to save broadcasts: %v", c.Name, err)
+		return
+	}
+	output.Printf("Removed broadcast %s", c.Name)
+}
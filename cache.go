@@ -0,0 +1,161 @@
+package noteblockplayer
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// cacheEntry is a parsed song in the song cache, along with the state of the file it was parsed from.
+type cacheEntry struct {
+	key     string
+	song    *Song
+	modTime time.Time
+	size    int64
+	// mem is the estimated memory used by song, see songMemory.
+	mem int64
+}
+
+// songCache holds the parsed songs by file path, or by pack path and song name for songs in packs, as
+// elements of songLRU, which orders them from most to least recently used. cacheMem is the estimated memory
+// used by all cached songs, and cacheBudget the budget set with SetSongCacheBudget. songCacheMtx protects
+// access to all of them.
+var (
+	songCache    = make(map[string]*list.Element)
+	songLRU      = list.New()
+	cacheMem     int64
+	cacheBudget  int64
+	songCacheMtx sync.Mutex
+)
+
+// SetSongCacheBudget limits the estimated memory used by the songs in the song cache to the number of bytes
+// passed. Once the budget is exceeded, the least recently played songs are removed from the cache until it
+// fits again, and are parsed again when played next. Songs still playing are not affected. A budget of 0,
+// the default, never removes songs.
+//
+// Example usage (keep at most 64 MiB of songs in memory):
+//
+//	noteblockplayer.SetSongCacheBudget(64 << 20)
+func SetSongCacheBudget(bytes int64) {
+	songCacheMtx.Lock()
+	defer songCacheMtx.Unlock()
+	cacheBudget = max(bytes, 0)
+	evictSongs()
+}
+
+// SongCacheUsage returns the number of songs in the song cache and the estimated memory they use in bytes.
+func SongCacheUsage() (songs int, bytes int64) {
+	songCacheMtx.Lock()
+	defer songCacheMtx.Unlock()
+	return songLRU.Len(), cacheMem
+}
+
+// songMemory estimates the memory used by the song passed in bytes.
+func songMemory(s *Song) int64 {
+	mem := int64(unsafe.Sizeof(*s)) + int64(len(s.Title)+len(s.Author)+len(s.name))
+	mem += int64(len(s.OriginalAuthor) + len(s.Description) + len(s.ImportName))
+	mem += int64(cap(s.Notes)) * int64(unsafe.Sizeof(Note{}))
+	mem += int64(cap(s.Lyrics)) * int64(unsafe.Sizeof(LyricLine{}))
+	for _, l := range s.Lyrics {
+		mem += int64(len(l.Text))
+	}
+	mem += int64(cap(s.Markers)) * int64(unsafe.Sizeof(Marker{}))
+	for _, m := range s.Markers {
+		mem += int64(len(m.Name))
+	}
+	return mem
+}
+
+// evictSongs removes the least recently used songs from the song cache until it fits the budget set with
+// SetSongCacheBudget. songCacheMtx must be held.
+func evictSongs() {
+	for cacheBudget > 0 && cacheMem > cacheBudget && songLRU.Len() > 0 {
+		removeCachedSong(songLRU.Back())
+	}
+}
+
+// removeCachedSong removes the element passed from the song cache. songCacheMtx must be held.
+func removeCachedSong(el *list.Element) {
+	e := songLRU.Remove(el).(*cacheEntry)
+	delete(songCache, e.key)
+	cacheMem -= e.mem
+}
+
+// cachedSong returns the song with the cache key passed from the song cache. If it is not cached yet, or the
+// file it was parsed from changed since, it is loaded with load and added to the cache. info describes the
+// file the song is stored in.
+//
+// Songs in the cache are shared between playbacks and must not be modified.
+func cachedSong(key string, info fs.FileInfo, load func() (*Song, error)) (*Song, error) {
+	songCacheMtx.Lock()
+	if el, ok := songCache[key]; ok {
+		if e := el.Value.(*cacheEntry); e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+			songLRU.MoveToFront(el)
+			songCacheMtx.Unlock()
+			return e.song, nil
+		}
+	}
+	songCacheMtx.Unlock()
+
+	song, err := load()
+	if err != nil {
+		return nil, err
+	}
+	songCacheMtx.Lock()
+	defer songCacheMtx.Unlock()
+	if el, ok := songCache[key]; ok {
+		removeCachedSong(el)
+	}
+	e := &cacheEntry{key: key, song: song, modTime: info.ModTime(), size: info.Size(), mem: songMemory(song)}
+	songCache[key] = songLRU.PushFront(e)
+	cacheMem += e.mem
+	evictSongs()
+	return song, nil
+}
+
+// PreloadSongs parses the songs with the names passed, or all songs in the song folders if no names are
+// passed, and adds them to the song cache. Calling it when the server starts means the first time a big
+// song is played doesn't wait for it to be parsed. It returns the number of songs loaded, and an error
+// describing every song that failed to load.
+//
+// Example usage (at server start, in the background):
+//
+//	go func() {
+//	    if _, err := noteblockplayer.PreloadSongs(); err != nil {
+//	        log.Printf("preload songs: %v", err)
+//	    }
+//	}()
+func PreloadSongs(names ...string) (int, error) {
+	if len(names) == 0 {
+		all, err := ListSongs()
+		if err != nil {
+			return 0, err
+		}
+		names = all
+	}
+	var (
+		n    int
+		errs []error
+	)
+	for _, name := range names {
+		if _, err := flexSongLoader(name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// ClearSongCache removes all songs from the song cache, so they are parsed again when played next.
+func ClearSongCache() {
+	songCacheMtx.Lock()
+	defer songCacheMtx.Unlock()
+	clear(songCache)
+	songLRU.Init()
+	cacheMem = 0
+}
@@ -0,0 +1,138 @@
+package noteblockplayer
+
+import (
+	"maps"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// ChannelAction decides what happens to the songs playing to a player on other channels with a lower
+// priority while a song plays. See PlaybackOptions.Priority.
+type ChannelAction int
+
+const (
+	// DuckLower plays the songs with a lower priority at PlaybackOptions.DuckVolume, so they can still be
+	// heard quietly. This is the default.
+	DuckLower ChannelAction = iota
+	// PauseLower pauses the songs with a lower priority, and resumes them where they were once the song ends.
+	PauseLower
+)
+
+// JingleChannel is the channel PlayJingle plays jingles on, and jinglePriority their priority.
+const (
+	JingleChannel  = "jingle"
+	jinglePriority = 100
+)
+
+// PlayJingle plays a short clip, such as a stinger for a kill or a level up, to the player on the
+// JingleChannel. The music playing to the player is paused while the jingle plays, and continues at the tick
+// it was paused at once the jingle ends or is stopped. A jingle played while another one plays replaces it.
+// Returns an error if the jingle can't be loaded, like PlayNoteblock.
+//
+// Example usage:
+//
+//	_ = noteblockplayer.PlayJingle(p.H(), "level_up")
+func PlayJingle(eh *world.EntityHandle, filename string) error {
+	song, err := flexSongLoader(filename)
+	if err != nil {
+		return err
+	}
+	_, err = PlaySong(eh, song, PlaybackOptions{
+		Channel:       JingleChannel,
+		Priority:      jinglePriority,
+		LowerChannels: PauseLower,
+		Source:        "jingle",
+	})
+	return err
+}
+
+// channelVolumes holds the volumes set with SetChannelVolume. It is replaced as a whole whenever a volume is
+// set, so playbacks can read it for every tick without locking.
+var (
+	channelVolumes    atomic.Pointer[map[string]float32]
+	channelVolumesMtx sync.Mutex
+)
+
+// SetChannelVolume sets the volume, from 0 to 1, of all songs playing on the channel passed (see
+// PlaybackOptions.Channel), on top of the volume of the player and the master volume. It applies to running
+// playbacks immediately. The volume of every channel is 1 by default, except for the AmbienceChannel, which
+// is 0.5.
+//
+// Example usage:
+//
+//	noteblockplayer.SetChannelVolume(noteblockplayer.AmbienceChannel, 0.25)
+func SetChannelVolume(channel string, volume float64) {
+	channelVolumesMtx.Lock()
+	defer channelVolumesMtx.Unlock()
+	volumes := make(map[string]float32)
+	if old := channelVolumes.Load(); old != nil {
+		maps.Copy(volumes, *old)
+	}
+	volumes[channel] = float32(min(max(volume, 0), 1))
+	channelVolumes.Store(&volumes)
+}
+
+// ChannelVolume returns the volume of the channel passed, as set with SetChannelVolume.
+func ChannelVolume(channel string) float64 {
+	return float64(channelVolume(channel))
+}
+
+// channelVolume returns the volume of the channel passed.
+func channelVolume(channel string) float32 {
+	if volumes := channelVolumes.Load(); volumes != nil {
+		if v, ok := (*volumes)[channel]; ok {
+			return v
+		}
+	}
+	if channel == AmbienceChannel {
+		return defaultAmbienceVolume
+	}
+	return 1
+}
+
+// defaultDuckVolume is the volume songs are ducked to if PlaybackOptions.DuckVolume is not set.
+const defaultDuckVolume = 0.3
+
+// duckVolume returns the volume the playback ducks the songs with a lower priority to.
+func (pb *playback) duckVolume() float32 {
+	if pb.opts.DuckVolume <= 0 {
+		return defaultDuckVolume
+	}
+	return float32(min(pb.opts.DuckVolume, 1))
+}
+
+// applyPriorities ducks and pauses the playbacks of the player for the playbacks with a higher priority
+// playing to them, and restores the playbacks that have none left. It is called whenever a playback of the
+// player starts or ends. Playbacks paused by the player stay paused, as their pause is kept apart from the
+// pause for a higher priority.
+func applyPriorities(eh *world.EntityHandle) {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	all := playbacksOf(eh)
+	for _, pb := range all {
+		hold, volume := false, float32(1)
+		for _, other := range all {
+			if other.opts.Priority <= pb.opts.Priority {
+				continue
+			}
+			switch other.opts.LowerChannels {
+			case PauseLower:
+				hold = true
+			default:
+				volume = min(volume, other.duckVolume())
+			}
+		}
+		pb.duck.Store(math.Float32bits(volume))
+		if hold != pb.holding {
+			pb.holding = hold
+			if hold {
+				pb.send(control{kind: controlHold})
+			} else {
+				pb.send(control{kind: controlRelease})
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package noteblockplayer
+
+import (
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/player"
+)
+
+// ChargeFunc is called before a song requested by a player with a command or the song browser starts
+// playing or is queued. Returning an error blocks the request, and the error is shown to the player.
+type ChargeFunc func(p *player.Player, song *Song) error
+
+// chargeFunc holds the function set with SetChargeFunc.
+var chargeFunc atomic.Pointer[ChargeFunc]
+
+// SetChargeFunc sets the function charging players for song requests, so servers with an economy plugin can
+// make players pay for the songs they play. The function is called with the world transaction of the player
+// open, after the song was loaded and before it plays. Passing nil makes song requests free again, which is
+// the default. Songs played through functions such as PlayNoteblock are never charged.
+//
+// Example usage:
+//
+//	noteblockplayer.SetChargeFunc(func(p *player.Player, song *noteblockplayer.Song) error {
+//	    if !economy.Withdraw(p.UUID(), 10) {
+//	        return errors.New("a song costs 10 coins")
+//	    }
+//	    return nil
+//	})
+func SetChargeFunc(f ChargeFunc) {
+	if f == nil {
+		chargeFunc.Store(nil)
+		return
+	}
+	chargeFunc.Store(&f)
+}
+
+// chargeSong charges the player for requesting the song passed with the function set with SetChargeFunc.
+// It must be called with the world transaction of the player open.
+func chargeSong(p *player.Player, song *Song) error {
+	f := chargeFunc.Load()
+	if f == nil {
+		return nil
+	}
+	return (*f)(p, song)
+}
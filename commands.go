@@ -0,0 +1,205 @@
+package noteblockplayer
+
+import (
+	"slices"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+)
+
+// commandSpec describes a command of the package, which is only created and registered by
+// RegisterCommands.
+type commandSpec struct {
+	name, description string
+	aliases           []string
+	runnables         []cmd.Runnable
+}
+
+// commandSpecs are all commands of the package, by their default name.
+var commandSpecs = []commandSpec{
+	{
+		name:        "playnoteblock",
+		description: "Play a noteblock song file (json/nbs), from a time like 90s or 1:30 or a tick like 600t; a plain number is the tempo",
+		aliases:     []string{"playnb", "pnb"},
+		runnables:   []cmd.Runnable{PlayNoteBlockCmd{}, PlayNoteBlockFromCmd{}},
+	},
+	{
+		name:        "stopnoteblock",
+		description: "Stop the currently playing noteblock file",
+		aliases:     []string{"stopnb", "snb"},
+		runnables:   []cmd.Runnable{StopNoteBlockCmd{}, StopPlaybackCmd{}},
+	},
+	{
+		name:        "nbrecord",
+		description: "Record the note blocks you play and save them as a song",
+		runnables:   []cmd.Runnable{RecordStartCmd{}, RecordSaveCmd{}, RecordCancelCmd{}},
+	},
+	{
+		name:        "nbvalidate",
+		description: "Check a noteblock song file for problems",
+		runnables:   []cmd.Runnable{ValidateCmd{}},
+	},
+	{
+		name:        "nbinfo",
+		description: "Show statistics about a noteblock song file",
+		runnables:   []cmd.Runnable{InfoCmd{}},
+	},
+	{
+		name:        "nbanalyze",
+		description: "Show the key and chords of a noteblock song file",
+		runnables:   []cmd.Runnable{AnalyzeCmd{}},
+	},
+	{
+		name:        "nbdump",
+		description: "Print the playback schedule of a noteblock song file",
+		runnables:   []cmd.Runnable{DumpScheduleCmd{}},
+	},
+	{
+		name:        "nblayer",
+		description: "Mute or solo layers of the currently playing noteblock song, or play a single layer",
+		runnables:   []cmd.Runnable{LayerCmd{}, LayerResetCmd{}, LayerPlayCmd{}},
+	},
+	{
+		name:        "nbdj",
+		description: "Control the DJ booth you run, or vote to skip its song",
+		runnables:   []cmd.Runnable{DJQueueCmd{}, DJPlayNextCmd{}, DJRequestCmd{}, DJSkipCmd{}, DJCrossfadeCmd{}, DJStopCmd{}, DJVolumeCmd{}, DJVoteSkipCmd{}},
+	},
+	{
+		name:        "voteskip",
+		description: "Vote to skip the song of the DJ booth you are near",
+		runnables:   []cmd.Runnable{VoteSkipCmd{}},
+	},
+	{
+		name:        "nbinvite",
+		description: "Invite a player to your listening party",
+		runnables:   []cmd.Runnable{InviteCmd{}},
+	},
+	{
+		name:        "nbjoin",
+		description: "Accept or decline an invitation to a listening party",
+		runnables:   []cmd.Runnable{JoinCmd{}},
+	},
+	{
+		name:        "queuenb",
+		description: "Manage the queue of noteblock songs played after the current one",
+		runnables:   []cmd.Runnable{QueueListCmd{}, QueueAddCmd{}, QueueRemoveCmd{}, QueueMoveCmd{}, QueueClearCmd{}},
+	},
+	{
+		name:        "nbrepeat",
+		description: "Set the repeat mode of your noteblock queue (off, one or all)",
+		runnables:   []cmd.Runnable{RepeatCmd{}},
+	},
+	{
+		name:        "nbpitch",
+		description: "Shift the pitch of all noteblock music you hear",
+		runnables:   []cmd.Runnable{PitchCmd{}},
+	},
+	{
+		name:        "nbmute",
+		description: "Mute or unmute broadcast music, such as DJ booths and ambient music",
+		runnables:   []cmd.Runnable{MuteCmd{}},
+	},
+	{
+		name:        "nbschedule",
+		description: "Schedule noteblock songs played to everyone at set times",
+		runnables:   []cmd.Runnable{ScheduleListCmd{}, ScheduleAddCmd{}, ScheduleRemoveCmd{}},
+	},
+	{
+		name:        "stopallnb",
+		description: "Stop every noteblock song playing on the server",
+		runnables:   []cmd.Runnable{StopAllCmd{}},
+	},
+	{
+		name:        "resumeallnb",
+		description: "Resume the ambient music and broadcasts paused by /stopallnb",
+		runnables:   []cmd.Runnable{ResumeAllCmd{}},
+	},
+	{
+		name:        "nbactive",
+		description: "List every noteblock song playing on the server",
+		runnables:   []cmd.Runnable{ActiveCmd{}},
+	},
+	{
+		name:        "nbseek",
+		description: "Jump to a bar or marker of the currently playing noteblock song",
+		runnables:   []cmd.Runnable{SeekCmd{}, SeekMarkerCmd{}},
+	},
+	{
+		name:        "nbsheet",
+		description: "Get a book with the sheet music of a noteblock song file",
+		runnables:   []cmd.Runnable{SheetCmd{}},
+	},
+	{
+		name:        "music",
+		description: "Play, control and find noteblock songs",
+		runnables:   []cmd.Runnable{MusicPlayCmd{}, MusicStopCmd{}, MusicPauseCmd{}, MusicResumeCmd{}, MusicQueueCmd{}, MusicVolumeCmd{}, MusicListCmd{}, MusicSearchCmd{}},
+	},
+	{
+		name:        "musicui",
+		description: "Browse, play and bookmark noteblock songs",
+		runnables:   []cmd.Runnable{MusicUICmd{}},
+	},
+	{
+		name:        "nbfav",
+		description: "Bookmark noteblock songs and play a random favorite",
+		runnables:   []cmd.Runnable{FavoriteAddCmd{}, FavoriteRemoveCmd{}, FavoriteListCmd{}, FavoritePlayCmd{}},
+	},
+	{
+		name:        "nbhistory",
+		description: "List the noteblock songs you played recently",
+		runnables:   []cmd.Runnable{HistoryCmd{}},
+	},
+	{
+		name:        "nbtop",
+		description: "List the noteblock songs played most often on the server",
+		runnables:   []cmd.Runnable{TopCmd{}},
+	},
+	{
+		name:        "listnb",
+		description: "List the noteblock songs, or the songs stored more than once",
+		runnables:   []cmd.Runnable{ListCmd{}, ListDuplicatesCmd{}},
+	},
+}
+
+// CommandOptions change which commands RegisterCommands registers, and under which names.
+type CommandOptions struct {
+	// Skip holds the default names of commands that are not registered, for example "nbdj" on servers
+	// without DJ booths.
+	Skip []string
+	// Rename maps the default names of commands to the names they are registered under instead. Aliases of
+	// renamed commands are kept.
+	Rename map[string]string
+}
+
+// Commands returns all commands of the package under their default names, without registering them. The
+// Runnable types of the commands are exported, so plugins can also register them under their own commands.
+func Commands() []cmd.Command {
+	commands := make([]cmd.Command, 0, len(commandSpecs))
+	for _, s := range commandSpecs {
+		commands = append(commands, cmd.New(s.name, s.description, s.aliases, s.runnables...))
+	}
+	return commands
+}
+
+// RegisterCommands registers the commands of the package with Dragonfly, changed by the CommandOptions
+// passed. Commands are not registered by just importing the package, so this must be called once when the
+// server starts. Earlier versions registered the commands on import; servers that still import the package
+// with _ must call this instead, or none of the commands exist.
+//
+// Example usage:
+//
+//	noteblockplayer.RegisterCommands(noteblockplayer.CommandOptions{
+//	    Skip:   []string{"nbdj", "voteskip"},
+//	    Rename: map[string]string{"playnoteblock": "play"},
+//	})
+func RegisterCommands(opts CommandOptions) {
+	for _, s := range commandSpecs {
+		if slices.Contains(opts.Skip, s.name) {
+			continue
+		}
+		name := s.name
+		if renamed, ok := opts.Rename[name]; ok && renamed != "" {
+			name = renamed
+		}
+		cmd.Register(cmd.New(name, s.description, s.aliases, s.runnables...))
+	}
+}
@@ -0,0 +1,108 @@
+package noteblockplayer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// cooldownKey identifies the cooldown of a command for a single player.
+type cooldownKey struct {
+	eh      *world.EntityHandle
+	command string
+}
+
+// cooldowns holds the cooldowns set with SetCommandCooldown by default command name, cooldownUsed when every
+// player last used a command with a cooldown and cooldownPruned when cooldownUsed was last pruned.
+// cooldownsMtx protects access to all of them.
+var (
+	cooldowns      = make(map[string]time.Duration)
+	cooldownUsed   = make(map[cooldownKey]time.Time)
+	cooldownPruned time.Time
+	cooldownsMtx   sync.Mutex
+)
+
+// SetCommandCooldown sets how long players must wait between two song requests with the command with the
+// default name passed. Cooldowns apply to the commands requesting songs: "playnoteblock" (and /music play),
+// "queuenb" (adding songs, and /music queue), "nbdj" (requesting songs) and "nbfav" (playing a favorite).
+// Admins (see SetAdminChecker) and the server console are never limited. Passing 0 removes the cooldown.
+//
+// Example usage (one song request per 30 seconds):
+//
+//	noteblockplayer.SetCommandCooldown("playnoteblock", 30*time.Second)
+func SetCommandCooldown(command string, d time.Duration) {
+	cooldownsMtx.Lock()
+	defer cooldownsMtx.Unlock()
+	if d <= 0 {
+		delete(cooldowns, command)
+		return
+	}
+	cooldowns[command] = d
+}
+
+// CommandCooldown returns how long the player has to wait before they can use the command with the default
+// name passed again, or 0 if they can use it now.
+func CommandCooldown(eh *world.EntityHandle, command string) time.Duration {
+	cooldownsMtx.Lock()
+	defer cooldownsMtx.Unlock()
+	return cooldownRemaining(cooldownKey{eh: eh, command: command}, time.Now())
+}
+
+// cooldownRemaining returns the time left of the cooldown with the key passed at the time passed.
+// cooldownsMtx must be held.
+func cooldownRemaining(key cooldownKey, now time.Time) time.Duration {
+	d, ok := cooldowns[key.command]
+	if !ok {
+		return 0
+	}
+	used, ok := cooldownUsed[key]
+	if !ok {
+		return 0
+	}
+	return max(0, used.Add(d).Sub(now))
+}
+
+// checkCooldown reports whether the source may use the command with the default name passed now. If not,
+// the time left is written to the output. The cooldown only starts once the song requested was accepted,
+// with startCooldown.
+func checkCooldown(src cmd.Source, output *cmd.Output, command string) bool {
+	p, ok := src.(*player.Player)
+	if !ok || isAdmin(src) {
+		return true
+	}
+	cooldownsMtx.Lock()
+	defer cooldownsMtx.Unlock()
+	if remaining := cooldownRemaining(cooldownKey{eh: p.H(), command: command}, time.Now()); remaining > 0 {
+		output.Errorf("You can request a song again in %s", remaining.Round(time.Second))
+		return false
+	}
+	return true
+}
+
+// cooldownPruneInterval is how often the uses of commands whose cooldown ended are removed from cooldownUsed.
+const cooldownPruneInterval = time.Minute
+
+// startCooldown starts the cooldown of the command with the default name passed for the player, once the song
+// they requested with it was accepted.
+func startCooldown(eh *world.EntityHandle, command string) {
+	now := time.Now()
+	cooldownsMtx.Lock()
+	defer cooldownsMtx.Unlock()
+	if _, ok := cooldowns[command]; !ok {
+		return
+	}
+	if now.Sub(cooldownPruned) >= cooldownPruneInterval {
+		// Entries of earlier uses whose cooldown ended are removed now and then, so the map doesn't grow with
+		// every player.
+		for k := range cooldownUsed {
+			if cooldownRemaining(k, now) == 0 {
+				delete(cooldownUsed, k)
+			}
+		}
+		cooldownPruned = now
+	}
+	cooldownUsed[cooldownKey{eh: eh, command: command}] = now
+}
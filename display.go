@@ -0,0 +1,171 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/player/bossbar"
+	"github.com/df-mc/dragonfly/server/player/scoreboard"
+	"github.com/df-mc/dragonfly/server/player/title"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// displayInterval is how often the opt-in playback displays are refreshed.
+const displayInterval = time.Second
+
+// updateDisplays refreshes the opt-in displays (see PlaybackOptions) of a playback for the player,
+// based on the tick the song is currently at.
+func updateDisplays(pp *player.Player, song *Song, opts PlaybackOptions, tick int) {
+	if opts.BossBar {
+		progress := songProgress(song, tick)
+		pp.SendBossBar(bossbar.New(fmt.Sprintf("♪ %s - %d%%", song.displayName(), int(progress*100))).
+			WithHealthPercentage(progress))
+	}
+	if opts.Scoreboard {
+		board := scoreboard.New("§l♪ Now Playing")
+		lines := []string{song.displayName()}
+		if credits := song.credits(); credits != "" {
+			lines = append(lines, "§7by "+credits)
+		}
+		tempo := newTempoCurve(song, opts)
+		bar, beat := song.BarAtTick(tick)
+		lines = append(lines, fmt.Sprintf("§7%s / %s", formatDuration(tempo.elapsed(tick)), formatDuration(tempo.elapsed(song.Length))))
+		lines = append(lines, fmt.Sprintf("§7Bar %d, beat %d", bar, beat))
+		if next, ok := nextQueued(pp.H()); ok {
+			lines = append(lines, "§7Next: "+next.displayName())
+		}
+		for i, line := range lines {
+			board.Set(i, line)
+		}
+		pp.SendScoreboard(board)
+	}
+}
+
+// announceSong shows a "Now Playing" title to the player, with the song title and author as subtitle.
+func announceSong(eh *world.EntityHandle, song *Song) {
+	subtitle := song.displayName()
+	if credits := song.credits(); credits != "" {
+		subtitle += " — " + credits
+	}
+	_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		if pp, ok := ent.(*player.Player); ok {
+			pp.SendTitle(title.New("♪ Now Playing").WithSubtitle(subtitle))
+		}
+	})
+}
+
+// loadingDelay is how long a song must take to load before its loading progress is shown, and
+// loadingInterval how often the progress is refreshed afterwards.
+const (
+	loadingDelay    = 250 * time.Millisecond
+	loadingInterval = 200 * time.Millisecond
+)
+
+// loadSongWithProgress loads a song like loadSong, showing a "Loading… (x%)" tip to the player if it
+// takes a while to parse. It must not be called from a transaction, as it blocks until the song is loaded.
+func loadSongWithProgress(eh *world.EntityHandle, w *world.World, name string) (*Song, error) {
+	start := time.Now()
+	var shown time.Time
+	return loadSong(name, w, func(read, total int64) {
+		if total <= 0 || time.Since(start) < loadingDelay || time.Since(shown) < loadingInterval {
+			return
+		}
+		shown = time.Now()
+		text := fmt.Sprintf("§7Loading… (%d%%)", read*100/total)
+		_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+			if pp, ok := ent.(*player.Player); ok {
+				pp.SendTip(text)
+			}
+		})
+	})
+}
+
+// loadSongForCmd loads the song with the name passed for a command in a new goroutine, so that parsing a
+// large file doesn't block the world the command was run in, showing its loading progress to players. Once
+// loaded, f is called with the song, or the error it failed to load with, in a new transaction: of the
+// player for players, who are skipped if they left in the meantime, and of the world the command was run in
+// for other sources. The output passed to f is sent to the source like the output of the command itself.
+func loadSongForCmd(src cmd.Source, tx *world.Tx, name string, f func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error)) {
+	w := tx.World()
+	if p, ok := src.(*player.Player); ok {
+		eh := p.H()
+		go func() {
+			song, err := loadSongWithProgress(eh, w, name)
+			_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+				if pp, ok := ent.(*player.Player); ok {
+					output := &cmd.Output{}
+					f(pp, output, tx, song, err)
+					pp.SendCommandOutput(output)
+				}
+			})
+		}()
+		return
+	}
+	go func() {
+		song, err := loadSong(name, w, nil)
+		w.Exec(func(tx *world.Tx) {
+			output := &cmd.Output{}
+			f(src, output, tx, song, err)
+			src.SendCommandOutput(output)
+		})
+	}()
+}
+
+// clearDisplays removes all opt-in displays shown during a playback from the player's screen.
+func clearDisplays(eh *world.EntityHandle, opts PlaybackOptions) {
+	if !opts.BossBar && !opts.Scoreboard {
+		return
+	}
+	_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		pp, ok := ent.(*player.Player)
+		if !ok {
+			return
+		}
+		if opts.BossBar {
+			pp.RemoveBossBar()
+		}
+		if opts.Scoreboard {
+			pp.RemoveScoreboard()
+		}
+	})
+}
+
+// songProgress returns how far into the song the tick passed is, in the range [0, 1].
+func songProgress(song *Song, tick int) float64 {
+	if song.Length <= 0 {
+		return 1
+	}
+	return min(max(float64(tick)/float64(song.Length), 0), 1)
+}
+
+// songElapsed returns the time it takes to play the song up to the tick passed at its own tempo, following
+// its tempo changes.
+func songElapsed(song *Song, tick int) time.Duration {
+	return newTempoCurve(song, PlaybackOptions{}).elapsed(tick)
+}
+
+// ticksDuration returns the time it takes to play the number of ticks passed at a tempo in ticks per
+// second. A tempo of zero or less falls back to 20 ticks per second, like playback does.
+func ticksDuration(ticks int, tempo float64) time.Duration {
+	if tempo <= 0 {
+		tempo = 20
+	}
+	return time.Duration(float64(ticks) / tempo * float64(time.Second))
+}
+
+// secondsDuration converts a number of seconds to a time.Duration, clamping times too long to be represented.
+func secondsDuration(seconds float64) time.Duration {
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// formatDuration formats a duration as minutes and seconds, for example "3:07".
+func formatDuration(d time.Duration) string {
+	secs := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
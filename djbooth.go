@@ -0,0 +1,692 @@
+package noteblockplayer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// DJBooth is a location in a world from which songs are broadcast to every player within a radius. A
+// designated player, the DJ, controls the booth: they queue songs, skip, crossfade between songs and set the
+// volume, while the audience can vote to skip the current song.
+//
+// Songs played by a booth are independent of the songs played to single players with PlayNoteblock.
+type DJBooth struct {
+	name   string
+	w      *world.World
+	pos    mgl64.Vec3
+	radius float64
+
+	mu     sync.Mutex
+	dj     *world.EntityHandle
+	queue  []boothEntry
+	decks  []*deck
+	votes  map[*world.EntityHandle]struct{}
+	volume float64
+	closed bool
+
+	attenuation Attenuation
+	surround    *Surround
+
+	// path is the path the booth moves along, set with SetPath.
+	path atomic.Pointer[boothPath]
+
+	skipFraction float64
+}
+
+// boothEntry is a song waiting in the queue of a DJBooth.
+type boothEntry struct {
+	song     *Song
+	priority bool
+}
+
+// deck is a song being broadcast by a DJBooth. A booth has a single deck, except while crossfading.
+type deck struct {
+	song *Song
+	// gain holds the bits of the float64 volume the deck is played at, changed while crossfading.
+	gain atomic.Uint64
+	stop chan struct{}
+	once sync.Once
+}
+
+// halt stops the deck if it is still playing.
+func (d *deck) halt() {
+	d.once.Do(func() { close(d.stop) })
+}
+
+// booths holds all open DJ booths by name.
+// boothsMtx protects access to booths.
+var (
+	booths    = make(map[string]*DJBooth)
+	boothsMtx sync.Mutex
+)
+
+// NewDJBooth opens a DJ booth with the name passed at pos in the world w, broadcasting to all players within
+// radius blocks. The player behind dj controls the booth, and may be changed later with SetDJ. An existing
+// booth with the same name is closed.
+func NewDJBooth(name string, w *world.World, pos mgl64.Vec3, radius float64, dj *world.EntityHandle) *DJBooth {
+	b := &DJBooth{
+		name:   name,
+		w:      w,
+		pos:    pos,
+		radius: radius,
+		dj:     dj,
+		votes:  make(map[*world.EntityHandle]struct{}),
+		volume: 1,
+
+		skipFraction: 0.5,
+	}
+	boothsMtx.Lock()
+	old, ok := booths[name]
+	booths[name] = b
+	boothsMtx.Unlock()
+	if ok {
+		old.Close()
+	}
+	return b
+}
+
+// DJBoothByName returns the open booth with the name passed.
+func DJBoothByName(name string) (*DJBooth, bool) {
+	boothsMtx.Lock()
+	defer boothsMtx.Unlock()
+	b, ok := booths[name]
+	return b, ok
+}
+
+// Name returns the name of the booth.
+func (b *DJBooth) Name() string {
+	return b.name
+}
+
+// SetDJ makes the player behind the handle passed the DJ of the booth.
+func (b *DJBooth) SetDJ(dj *world.EntityHandle) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dj = dj
+}
+
+// IsDJ reports whether the player behind the handle passed is the DJ of the booth.
+func (b *DJBooth) IsDJ(eh *world.EntityHandle) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dj == eh
+}
+
+// InRange reports whether the position passed, in the world passed, is within the radius of the booth.
+func (b *DJBooth) InRange(w *world.World, pos mgl64.Vec3) bool {
+	return b.inRange(w, pos, b.Position())
+}
+
+// inRange reports whether the position passed, in the world passed, is within the radius of the booth when it
+// is at the position centre.
+func (b *DJBooth) inRange(w *world.World, pos, centre mgl64.Vec3) bool {
+	return w == b.w && pos.Sub(centre).Len() <= b.radius
+}
+
+// Queue adds the song to the end of the booth's queue. If nothing is playing, it starts right away.
+func (b *DJBooth) Queue(song *Song) {
+	b.Enqueue(song, false)
+}
+
+// Enqueue adds the song to the booth's queue. Priority songs are played next: they are inserted at the
+// front of the queue, after any priority songs already waiting, while other songs are added to the end.
+// If nothing is playing, the song starts right away.
+func (b *DJBooth) Enqueue(song *Song, priority bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	e := boothEntry{song: song, priority: priority}
+	if !priority {
+		b.queue = append(b.queue, e)
+	} else {
+		i := 0
+		for i < len(b.queue) && b.queue[i].priority {
+			i++
+		}
+		b.queue = slices.Insert(b.queue, i, e)
+	}
+	if len(b.decks) == 0 {
+		b.playNext()
+	}
+}
+
+// Queued returns the songs in the booth's queue, in the order they will be played.
+func (b *DJBooth) Queued() []*Song {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	songs := make([]*Song, len(b.queue))
+	for i, e := range b.queue {
+		songs[i] = e.song
+	}
+	return songs
+}
+
+// Playing returns the song currently broadcast by the booth. While crossfading, this is the song faded in.
+func (b *DJBooth) Playing() (*Song, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.decks) == 0 {
+		return nil, false
+	}
+	return b.decks[len(b.decks)-1].song, true
+}
+
+// Skip stops the current song and starts the next song of the queue, if any.
+func (b *DJBooth) Skip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.haltDecks()
+	b.playNext()
+}
+
+// Stop stops the current song without starting the next one. The queue is kept, so playback continues with
+// the next call to Queue or Skip.
+func (b *DJBooth) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.haltDecks()
+}
+
+// Crossfade starts the next song of the queue and fades it in over the duration passed, while fading out
+// the current song. An error is returned if no song is queued.
+func (b *DJBooth) Crossfade(d time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) == 0 {
+		return errors.New("no song queued")
+	}
+	old := b.decks
+	b.decks = nil
+	in := b.playNext()
+	if len(old) == 0 || d <= 0 {
+		for _, o := range old {
+			o.halt()
+		}
+		in.gain.Store(math.Float64bits(1))
+		return nil
+	}
+	in.gain.Store(math.Float64bits(0))
+	b.decks = append(old, in)
+	go b.fade(old, in, d)
+	return nil
+}
+
+// fade moves the gain from the decks in out to the deck in over the duration passed, and stops the decks
+// in out afterwards.
+func (b *DJBooth) fade(out []*deck, in *deck, d time.Duration) {
+	const step = 50 * time.Millisecond
+	start := time.Now()
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	for range ticker.C {
+		f := min(1, float64(time.Since(start))/float64(d))
+		in.gain.Store(math.Float64bits(f))
+		for _, o := range out {
+			o.gain.Store(math.Float64bits(1 - f))
+		}
+		if f >= 1 {
+			break
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, o := range out {
+		b.removeDeck(o)
+		o.halt()
+	}
+}
+
+// SetVolume sets the volume, from 0 to 1, that everything broadcast by the booth is played at.
+func (b *DJBooth) SetVolume(volume float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.volume = max(0, min(1, volume))
+}
+
+// SetAttenuation sets the curve lowering the volume of the booth for listeners further away from it. By
+// default, everyone within the radius of the booth hears it at the same volume.
+//
+// Example usage (full volume up close, fading to 20% at the edge of a radius of 32 blocks):
+//
+//	booth.SetAttenuation(noteblockplayer.Attenuation{MaxDistance: 32, Rolloff: 2, MinVolume: 0.2})
+func (b *DJBooth) SetAttenuation(a Attenuation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attenuation = a
+}
+
+// SetSurround plays the booth through the speakers of the Surround passed, placed around the stage, instead of
+// playing every note at the position of the listeners. With an Attenuation set, the volume of every speaker
+// is lowered by the distance to that speaker. Passing nil turns surround off again.
+//
+// Example usage:
+//
+//	booth.SetSurround(&noteblockplayer.Surround{
+//	    FrontLeft:  mgl64.Vec3{-10, 64, 10},
+//	    FrontRight: mgl64.Vec3{10, 64, 10},
+//	    Rear:       mgl64.Vec3{0, 64, -20},
+//	})
+func (b *DJBooth) SetSurround(s *Surround) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.surround = s
+}
+
+// SetSkipFraction sets the fraction (0 to 1) of the audience that must vote to skip the current song with
+// VoteSkip. The default is 0.5: at least half of the audience.
+func (b *DJBooth) SetSkipFraction(fraction float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.skipFraction = max(0, min(1, fraction))
+}
+
+// VoteSkip registers the vote of the player to skip the current song. The song is skipped once the fraction
+// of the audience (every player in range except the DJ and players who muted broadcast music) set with
+// SetSkipFraction voted for it. Only the votes of players still in range count, and all votes are reset when
+// a new song starts. It returns the number of votes, the number of votes needed and whether the song was
+// skipped. If nothing is playing, the number of votes is 0. Players outside the audience can't vote, and an
+// error wrapping ErrNotEligible is returned with the reason.
+func (b *DJBooth) VoteSkip(tx *world.Tx, voter *world.EntityHandle) (votes, needed int, skipped bool, err error) {
+	listeners := make(map[*world.EntityHandle]struct{})
+	if tx.World() == b.w {
+		for e := range tx.Players() {
+			if !b.IsDJ(e.H()) && b.InRange(tx.World(), e.Position()) && !IsMuted(e.H()) {
+				listeners[e.H()] = struct{}{}
+			}
+		}
+	}
+	if _, ok := listeners[voter]; !ok {
+		switch {
+		case b.IsDJ(voter):
+			return 0, 0, false, fmt.Errorf("%w: you are the DJ", ErrNotEligible)
+		case IsMuted(voter):
+			return 0, 0, false, fmt.Errorf("%w: you muted broadcast music", ErrNotEligible)
+		default:
+			return 0, 0, false, fmt.Errorf("%w: you are out of range of the booth", ErrNotEligible)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	needed = max(1, int(math.Ceil(b.skipFraction*float64(len(listeners)))))
+	if len(b.decks) == 0 {
+		return 0, needed, false, nil
+	}
+	b.votes[voter] = struct{}{}
+	for v := range b.votes {
+		if _, ok := listeners[v]; ok {
+			votes++
+		}
+	}
+	if votes < needed {
+		return votes, needed, false, nil
+	}
+	b.haltDecks()
+	b.playNext()
+	return votes, needed, true, nil
+}
+
+// Close stops the booth and removes it, so it can no longer be found with DJBoothByName.
+func (b *DJBooth) Close() {
+	boothsMtx.Lock()
+	if booths[b.name] == b {
+		delete(booths, b.name)
+	}
+	boothsMtx.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.queue = nil
+	b.haltDecks()
+}
+
+// haltDecks stops all decks of the booth. b.mu must be held.
+func (b *DJBooth) haltDecks() {
+	for _, d := range b.decks {
+		d.halt()
+	}
+	b.decks = nil
+}
+
+// removeDeck removes the deck from the decks of the booth. b.mu must be held.
+func (b *DJBooth) removeDeck(d *deck) {
+	for i, o := range b.decks {
+		if o == d {
+			b.decks = append(b.decks[:i], b.decks[i+1:]...)
+			return
+		}
+	}
+}
+
+// playNext starts the next song of the queue on a new deck and returns it, or nil if the queue is empty.
+// b.mu must be held.
+func (b *DJBooth) playNext() *deck {
+	if b.closed || len(b.queue) == 0 {
+		return nil
+	}
+	d := &deck{song: b.queue[0].song, stop: make(chan struct{})}
+	d.gain.Store(math.Float64bits(1))
+	b.queue = b.queue[1:]
+	b.decks = append(b.decks, d)
+	clear(b.votes)
+	go b.play(d)
+	return d
+}
+
+// play broadcasts the song of the deck until it finishes or the deck is stopped. When the song finishes,
+// the next song of the queue is started.
+func (b *DJBooth) play(d *deck) {
+	notesPerTick := buildSchedule(d.song, PlaybackOptions{})
+	tempo := newTempoCurve(d.song, PlaybackOptions{})
+	instruments := resolveInstruments(d.song)
+	tickDuration := tempo.tickDuration(0)
+	ticker := time.NewTicker(tickDuration)
+	defer ticker.Stop()
+
+	writers := make(map[*world.EntityHandle]*writerCache)
+	prefs := make(prefsCache)
+	var (
+		pks []packet.Packet
+		buf soundBuffer
+	)
+	for tick := 0; tick <= d.song.Length; tick++ {
+		// The ticker follows the tempo changes of the song.
+		if td := tempo.tickDuration(tick); td != tickDuration {
+			tickDuration = td
+			ticker.Reset(td)
+		}
+		if notes := notesPerTick[tick]; len(notes) > 0 {
+			b.mu.Lock()
+			volume, attenuation, surround := b.volume*math.Float64frombits(d.gain.Load()), b.attenuation, b.surround
+			b.mu.Unlock()
+			centre := b.Position()
+			<-b.w.Exec(func(tx *world.Tx) {
+				for e := range tx.Players() {
+					p, ok := e.(*player.Player)
+					if !ok || !b.inRange(tx.World(), p.Position(), centre) || IsMuted(p.H()) {
+						continue
+					}
+					c, ok := writers[p.H()]
+					if !ok {
+						c = &writerCache{}
+						writers[p.H()] = c
+					}
+					w, ok := c.writer(p)
+					if !ok {
+						continue
+					}
+					// The volume and pitch preferences of every listener apply on top of the booth's volume.
+					playerVolume, pitch := prefs.get(p.H())
+					pack := hasResourcePack(p)
+					pks = pks[:0]
+					buf.reset()
+					if surround != nil {
+						for _, note := range notes {
+							pks = surround.appendSounds(pks, &buf, instruments.sound(note.Instrument, pack), p.Position(), noteVolume(note)*float32(volume)*playerVolume, notePitch(note, pitch), notePan(note), attenuation)
+						}
+						writePackets(w, pks...)
+						continue
+					}
+					listenerVolume := float32(volume*attenuation.Volume(p.Position().Sub(centre).Len())) * playerVolume
+					for _, note := range notes {
+						pks = append(pks, buf.sound(instruments.sound(note.Instrument, pack), p.Position(), noteVolume(note)*listenerVolume, notePitch(note, pitch)))
+					}
+					writePackets(w, pks...)
+				}
+			})
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeDeck(d)
+	if len(b.decks) == 0 {
+		b.playNext()
+	}
+}
+
+// djBooth returns the booth the player is the DJ of.
+func djBooth(eh *world.EntityHandle) (*DJBooth, bool) {
+	boothsMtx.Lock()
+	defer boothsMtx.Unlock()
+	for _, b := range booths {
+		if b.IsDJ(eh) {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// nearbyBooth returns the booth in range of the player.
+func nearbyBooth(p *player.Player, tx *world.Tx) (*DJBooth, bool) {
+	boothsMtx.Lock()
+	defer boothsMtx.Unlock()
+	for _, b := range booths {
+		if b.InRange(tx.World(), p.Position()) {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// djSource returns the booth of the player running a DJ command, writing an error to the output if the
+// source is not the DJ of a booth.
+func djSource(src cmd.Source, output *cmd.Output) (*DJBooth, bool) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbdj command is only valid for players")
+		return nil, false
+	}
+	b, ok := djBooth(p.H())
+	if !ok {
+		output.Error("You are not the DJ of a booth")
+	}
+	return b, ok
+}
+
+// DJQueueCmd is the command for the DJ to queue a song at their booth.
+type DJQueueCmd struct {
+	Queue    cmd.SubCommand `cmd:"queue"`
+	Filename string         `cmd:"filename"`
+}
+
+// Run loads the song in the background and queues it at the DJ's booth.
+func (c DJQueueCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	b, ok := djSource(src, output)
+	if !ok {
+		return
+	}
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		b.Queue(song)
+		output.Printf("Queued %s", song.displayName())
+	})
+}
+
+// DJPlayNextCmd is the command for the DJ to queue a song at the front of their booth's queue.
+type DJPlayNextCmd struct {
+	PlayNext cmd.SubCommand `cmd:"playnext"`
+	Filename string         `cmd:"filename"`
+}
+
+// Run loads the song in the background and queues it with priority at the DJ's booth.
+func (c DJPlayNextCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	b, ok := djSource(src, output)
+	if !ok {
+		return
+	}
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		b.Enqueue(song, true)
+		output.Printf("%s plays next", song.displayName())
+	})
+}
+
+// DJRequestCmd is the command for the audience of a booth to request a song, which is added to the end of
+// its queue.
+type DJRequestCmd struct {
+	Request  cmd.SubCommand `cmd:"request"`
+	Filename string         `cmd:"filename"`
+}
+
+// Run loads the song in the background and queues it at the booth the player was near.
+func (c DJRequestCmd) Run(src cmd.Source, output *cmd.Output, tx *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbdj command is only valid for players")
+		return
+	}
+	b, ok := nearbyBooth(p, tx)
+	if !ok {
+		output.Error("You are not near a DJ booth")
+		return
+	}
+	if !checkCooldown(src, output, "nbdj") {
+		return
+	}
+	loadSongForCmd(src, tx, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		p := src.(*player.Player)
+		if err := checkRequest(p, song, false); err != nil {
+			output.Errorf("Could not request %s: %v", song.displayName(), err)
+			return
+		}
+		startCooldown(p.H(), "nbdj")
+		b.Enqueue(song, false)
+		output.Printf("Requested %s", song.displayName())
+	})
+}
+
+// DJSkipCmd is the command for the DJ to skip the current song of their booth.
+type DJSkipCmd struct {
+	Skip cmd.SubCommand `cmd:"skip"`
+}
+
+// Run skips the current song of the DJ's booth.
+func (c DJSkipCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if b, ok := djSource(src, output); ok {
+		b.Skip()
+		output.Print("Skipped")
+	}
+}
+
+// DJCrossfadeCmd is the command for the DJ to crossfade into the next queued song.
+type DJCrossfadeCmd struct {
+	Crossfade cmd.SubCommand        `cmd:"crossfade"`
+	Seconds   cmd.Optional[float64] `cmd:"seconds"`
+}
+
+// Run crossfades the DJ's booth into the next queued song, over 5 seconds by default.
+func (c DJCrossfadeCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	b, ok := djSource(src, output)
+	if !ok {
+		return
+	}
+	if err := b.Crossfade(time.Duration(c.Seconds.LoadOr(5) * float64(time.Second))); err != nil {
+		output.Errorf("Failed to crossfade: %v", err)
+		return
+	}
+	output.Print("Crossfading into the next song")
+}
+
+// DJStopCmd is the command for the DJ to stop the music of their booth.
+type DJStopCmd struct {
+	Stop cmd.SubCommand `cmd:"stop"`
+}
+
+// Run stops the current song of the DJ's booth.
+func (c DJStopCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if b, ok := djSource(src, output); ok {
+		b.Stop()
+		output.Print("Stopped")
+	}
+}
+
+// DJVolumeCmd is the command for the DJ to set the volume of their booth.
+type DJVolumeCmd struct {
+	Volume cmd.SubCommand `cmd:"volume"`
+	Level  float64        `cmd:"level"`
+}
+
+// Run sets the volume of the DJ's booth, from 0 to 1.
+func (c DJVolumeCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if b, ok := djSource(src, output); ok {
+		b.SetVolume(c.Level)
+		output.Printf("Volume set to %.0f%%", max(0, min(1, c.Level))*100)
+	}
+}
+
+// DJVoteSkipCmd is the command for the audience of a booth to vote to skip the current song.
+type DJVoteSkipCmd struct {
+	VoteSkip cmd.SubCommand `cmd:"voteskip"`
+}
+
+// Run registers the player's vote to skip the song of the booth they are near.
+func (c DJVoteSkipCmd) Run(src cmd.Source, output *cmd.Output, tx *world.Tx) {
+	voteSkip(src, output, tx, "nbdj")
+}
+
+// VoteSkipCmd is the command to vote to skip the song broadcast by the booth the player is near.
+type VoteSkipCmd struct{}
+
+// Run registers the player's vote to skip the song of the booth they are near.
+func (c VoteSkipCmd) Run(src cmd.Source, output *cmd.Output, tx *world.Tx) {
+	voteSkip(src, output, tx, "voteskip")
+}
+
+// voteSkip registers the vote of the source to skip the song of the booth they are near.
+func voteSkip(src cmd.Source, output *cmd.Output, tx *world.Tx, command string) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Errorf("The %s command is only valid for players", command)
+		return
+	}
+	b, ok := nearbyBooth(p, tx)
+	if !ok {
+		output.Error("You are not near a DJ booth")
+		return
+	}
+	if b.IsDJ(p.H()) {
+		output.Error("You are the DJ, use /nbdj skip instead")
+		return
+	}
+	votes, needed, skipped, err := b.VoteSkip(tx, p.H())
+	switch {
+	case err != nil:
+		output.Errorf("Your vote was not counted: %v", err)
+	case skipped:
+		output.Print("The song was skipped")
+	case votes == 0:
+		output.Error("Nothing is playing")
+	default:
+		output.Printf("Voted to skip (%d/%d)", votes, needed)
+	}
+}
@@ -0,0 +1,28 @@
+package noteblockplayer
+
+import "errors"
+
+var (
+	// ErrSongNotFound is returned when no song with the name passed exists in the song folders or song packs.
+	ErrSongNotFound = errors.New("song not found")
+	// ErrInvalidName is returned for song names that could reach files outside the song folders, such as
+	// absolute paths and names containing "..".
+	ErrInvalidName = errors.New("invalid song name")
+	// ErrUnsupportedFormat is returned for song files that are neither NBS nor JSON songs.
+	ErrUnsupportedFormat = errors.New("unsupported song format")
+	// ErrCorruptNBS is returned when an NBS file can't be parsed, for example because it is truncated.
+	ErrCorruptNBS = errors.New("corrupt NBS file")
+	// ErrNotAllowed is returned when a song request exceeds the limits of the Tier of the player.
+	ErrNotAllowed = errors.New("song not allowed")
+	// ErrAlreadyPlaying is returned when a song is played with PlaybackOptions.NoReplace while another song
+	// is already playing for the player.
+	ErrAlreadyPlaying = errors.New("a song is already playing")
+	// ErrSongExists is returned when a recording or an uploaded song is saved under the name of a song that
+	// already exists.
+	ErrSongExists = errors.New("song already exists")
+	// ErrNotEligible is returned when a player votes to skip the song of a DJ booth but isn't part of its
+	// audience, for example because they muted broadcast music.
+	ErrNotEligible = errors.New("not eligible to vote")
+	// ErrRegionTooLarge is returned by FindNoteBlocks for regions of more blocks than it scans.
+	ErrRegionTooLarge = errors.New("region too large")
+)
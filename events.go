@@ -0,0 +1,104 @@
+package noteblockplayer
+
+import (
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// PlaybackEventType is the kind of change a PlaybackEvent describes.
+type PlaybackEventType string
+
+const (
+	// EventStart is emitted when a song starts playing.
+	EventStart PlaybackEventType = "start"
+	// EventProgress is emitted every second while a song is playing.
+	EventProgress PlaybackEventType = "progress"
+	// EventPause is emitted when a playback is paused.
+	EventPause PlaybackEventType = "pause"
+	// EventResume is emitted when a paused playback is resumed.
+	EventResume PlaybackEventType = "resume"
+	// EventSeek is emitted when a playback jumps to another tick.
+	EventSeek PlaybackEventType = "seek"
+	// EventStop is emitted when a playback is stopped or replaced by another song before it finished.
+	EventStop PlaybackEventType = "stop"
+	// EventFinish is emitted when a song played until its end.
+	EventFinish PlaybackEventType = "finish"
+	// EventMarker is emitted when a playback reaches one of the markers of its song.
+	EventMarker PlaybackEventType = "marker"
+)
+
+// PlaybackEvent describes a change in the state of a playback.
+type PlaybackEvent struct {
+	Type PlaybackEventType
+	// PlaybackID is the ID of the playback, see StopPlayback.
+	PlaybackID int
+	Player     *world.EntityHandle
+	PlayerName string
+	Song       *Song
+	Tick       int
+	Paused     bool
+	// Marker is the name of the marker reached, for EventMarker.
+	Marker string
+}
+
+// eventHandlers holds the functions registered with OnPlaybackEvent by id.
+// eventHandlersMtx protects access to eventHandlers and nextEventHandlerID.
+var (
+	eventHandlers      = make(map[int]func(PlaybackEvent))
+	nextEventHandlerID int
+	eventHandlersMtx   sync.Mutex
+)
+
+// OnPlaybackEvent registers a function called for every PlaybackEvent of every playback, and returns a
+// function that unregisters it again. The function is called from the goroutine running the playback, so
+// it must not block.
+func OnPlaybackEvent(f func(PlaybackEvent)) (cancel func()) {
+	eventHandlersMtx.Lock()
+	defer eventHandlersMtx.Unlock()
+	id := nextEventHandlerID
+	nextEventHandlerID++
+	eventHandlers[id] = f
+	return func() {
+		eventHandlersMtx.Lock()
+		defer eventHandlersMtx.Unlock()
+		delete(eventHandlers, id)
+	}
+}
+
+// emitPlaybackEvent calls all registered event handlers with an event of the type passed for the playback.
+func emitPlaybackEvent(pb *playback, typ PlaybackEventType) {
+	emitEvent(pb, typ, "")
+}
+
+// emitMarkerEvent calls all registered event handlers with an EventMarker for the marker passed.
+func emitMarkerEvent(pb *playback, marker string) {
+	emitEvent(pb, EventMarker, marker)
+}
+
+// emitEvent calls all registered event handlers with an event of the type passed for the playback.
+func emitEvent(pb *playback, typ PlaybackEventType, marker string) {
+	eventHandlersMtx.Lock()
+	handlers := make([]func(PlaybackEvent), 0, len(eventHandlers))
+	for _, f := range eventHandlers {
+		handlers = append(handlers, f)
+	}
+	eventHandlersMtx.Unlock()
+	if len(handlers) == 0 {
+		return
+	}
+
+	e := PlaybackEvent{
+		Type:       typ,
+		PlaybackID: pb.id,
+		Player:     pb.eh,
+		PlayerName: pb.playerName,
+		Song:       pb.song,
+		Tick:       int(pb.tick.Load()),
+		Paused:     pb.paused.Load(),
+		Marker:     marker,
+	}
+	for _, f := range handlers {
+		f(e)
+	}
+}
@@ -0,0 +1,146 @@
+package noteblockplayer
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/player"
+)
+
+// NearestInstrument is the InstrumentFallback.Instrument that picks the vanilla instrument whose name is
+// nearest to the name of the custom instrument, like for custom instruments without a fallback.
+const NearestInstrument = -1
+
+// InstrumentFallback is the chain of sounds a custom instrument of Note Block Studio is played with. Players
+// with the resource pack of the server hear the sound of the pack, and players without it the vanilla
+// instrument, so songs with custom instruments stay playable for everyone while sounding better with the
+// pack.
+type InstrumentFallback struct {
+	// Sound is the name of the sound of the resource pack the instrument is played with, such as
+	// "custom.synth_lead", for players with the pack (see SetResourcePackCheck). If empty, the vanilla
+	// instrument is played to everyone.
+	Sound string
+	// Instrument is the index of the vanilla instrument played to players without the pack, or
+	// NearestInstrument.
+	Instrument int
+}
+
+// instrumentFallbacks holds the fallbacks set with SetInstrumentFallback by the lower case name of their
+// custom instrument. instrumentFallbacksMtx protects access to instrumentFallbacks.
+var (
+	instrumentFallbacks    = make(map[string]InstrumentFallback)
+	instrumentFallbacksMtx sync.Mutex
+
+	resourcePackCheck atomic.Pointer[func(p *player.Player) bool]
+)
+
+// SetInstrumentFallback sets the fallback chain of the custom instrument with the name passed, as named in
+// Note Block Studio. Names are not case-sensitive. Custom instruments without a fallback are played with the
+// vanilla instrument nearest to their name, such as the bass for "Synth Bass", or the piano if no name
+// matches. Songs that are already playing keep the instruments they started with.
+//
+// Example usage:
+//
+//	noteblockplayer.SetInstrumentFallback("Synth Lead", noteblockplayer.InstrumentFallback{
+//	    Sound:      "custom.synth_lead",
+//	    Instrument: noteblockplayer.NearestInstrument,
+//	})
+func SetInstrumentFallback(name string, f InstrumentFallback) {
+	instrumentFallbacksMtx.Lock()
+	defer instrumentFallbacksMtx.Unlock()
+	instrumentFallbacks[strings.ToLower(name)] = f
+}
+
+// SetResourcePackCheck sets the function that reports whether a player has the resource pack with the sounds
+// of the instrument fallbacks. Without a check, no player is assumed to have it, so only vanilla instruments
+// are played. Servers that require their resource pack can pass a function that always returns true.
+func SetResourcePackCheck(f func(p *player.Player) bool) {
+	if f == nil {
+		resourcePackCheck.Store(nil)
+		return
+	}
+	resourcePackCheck.Store(&f)
+}
+
+// hasResourcePack reports whether the player has the resource pack, according to the check set with
+// SetResourcePackCheck.
+func hasResourcePack(p *player.Player) bool {
+	if f := resourcePackCheck.Load(); f != nil {
+		return (*f)(p)
+	}
+	return false
+}
+
+// instrumentMap holds the sound names the custom instruments of a song are played with.
+type instrumentMap struct {
+	// pack holds the sounds of the resource pack by instrument index, and vanilla the vanilla sounds played
+	// without it.
+	pack, vanilla map[int]string
+}
+
+// resolveInstruments returns the sound names the custom instruments of the song are played with.
+func resolveInstruments(song *Song) instrumentMap {
+	if len(song.CustomInstruments) == 0 {
+		return instrumentMap{}
+	}
+	instrumentFallbacksMtx.Lock()
+	defer instrumentFallbacksMtx.Unlock()
+	m := instrumentMap{pack: make(map[int]string), vanilla: make(map[int]string)}
+	for index, name := range song.CustomInstruments {
+		f, ok := instrumentFallbacks[strings.ToLower(name)]
+		if !ok {
+			if _, named := customSoundName(index); named {
+				// A sound name set for the index replaces the nearest instrument.
+				continue
+			}
+			f.Instrument = NearestInstrument
+		}
+		if f.Sound != "" {
+			m.pack[index] = f.Sound
+		}
+		if f.Instrument < 0 || f.Instrument >= len(instrumentSoundNames) {
+			f.Instrument = nearestInstrument(name)
+		}
+		m.vanilla[index] = instrumentSoundNames[f.Instrument]
+	}
+	return m
+}
+
+// sound returns the sound name the instrument passed is played with, for a player with the resource pack if
+// pack is true.
+func (m instrumentMap) sound(instrument int, pack bool) string {
+	if pack {
+		if name, ok := m.pack[instrument]; ok {
+			return name
+		}
+	}
+	if name, ok := m.vanilla[instrument]; ok {
+		return name
+	}
+	return instrumentSoundName(instrument)
+}
+
+// instrumentKeywords are the words custom instrument names are matched against by nearestInstrument, in the
+// order they are tried, along with the vanilla instrument they stand for.
+var instrumentKeywords = []struct {
+	word       string
+	instrument int
+}{
+	{"kick", 1}, {"drum", 1}, {"snare", 2}, {"clap", 2}, {"hat", 3}, {"click", 3}, {"stick", 3},
+	{"cow", 11}, {"iron", 10}, {"vibraphone", 10}, {"xylophone", 9}, {"marimba", 9}, {"bass", 4},
+	{"flute", 5}, {"bell", 6}, {"guitar", 7}, {"chime", 8}, {"didgeridoo", 12}, {"chip", 13},
+	{"square", 13}, {"bit", 13}, {"banjo", 14}, {"pling", 15}, {"synth", 15}, {"electric", 15},
+}
+
+// nearestInstrument returns the vanilla instrument nearest to the name of a custom instrument, or the piano if
+// no vanilla instrument matches it.
+func nearestInstrument(name string) int {
+	name = strings.ToLower(name)
+	for _, k := range instrumentKeywords {
+		if strings.Contains(name, k.word) {
+			return k.instrument
+		}
+	}
+	return 0
+}
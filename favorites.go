@@ -0,0 +1,187 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// containsSong reports whether names holds the song with the name passed. Names are compared without case
+// and extension, so "world" and "World.nbs" are the same song.
+func containsSong(names []string, name string) bool {
+	key := songNameKey(name)
+	return slices.ContainsFunc(names, func(n string) bool {
+		return songNameKey(n) == key
+	})
+}
+
+// AddFavorite bookmarks the song with the name passed for the player. Songs already bookmarked are left
+// unchanged. Favorites are stored in the PlayerPreferences of the player, so they are saved with the
+// PreferenceStore set.
+func AddFavorite(eh *world.EntityHandle, name string) error {
+	return UpdatePreferences(eh, func(prefs *PlayerPreferences) {
+		if !containsSong(prefs.Favorites, name) {
+			prefs.Favorites = append(slices.Clone(prefs.Favorites), name)
+		}
+	})
+}
+
+// RemoveFavorite removes the bookmark of the song with the name passed for the player.
+func RemoveFavorite(eh *world.EntityHandle, name string) error {
+	key := songNameKey(name)
+	return UpdatePreferences(eh, func(prefs *PlayerPreferences) {
+		prefs.Favorites = slices.DeleteFunc(slices.Clone(prefs.Favorites), func(fav string) bool {
+			return songNameKey(fav) == key
+		})
+	})
+}
+
+// IsFavorite reports whether the player bookmarked the song with the name passed.
+func IsFavorite(eh *world.EntityHandle, name string) bool {
+	return containsSong(Preferences(eh).Favorites, name)
+}
+
+// PlayRandomFavorite plays a random song of the songs the player bookmarked, and returns its name. Songs
+// that no longer exist are skipped.
+//
+// Example usage:
+//
+//	if _, err := noteblockplayer.PlayRandomFavorite(p.H()); err != nil {
+//	    p.Message("You have no favorite songs yet")
+//	}
+func PlayRandomFavorite(eh *world.EntityHandle) (string, error) {
+	name, song, err := randomFavorite(eh)
+	if err != nil {
+		return "", err
+	}
+	go playSong(eh, song, PlaybackOptions{Source: "favorites"})
+	return name, nil
+}
+
+// randomFavorite loads a random song of the songs the player bookmarked, skipping songs that no longer
+// exist, and returns its name along with the song.
+func randomFavorite(eh *world.EntityHandle) (string, *Song, error) {
+	favorites := slices.Clone(Preferences(eh).Favorites)
+	rand.Shuffle(len(favorites), func(i, j int) {
+		favorites[i], favorites[j] = favorites[j], favorites[i]
+	})
+	for _, name := range favorites {
+		if song, err := flexSongLoader(name); err == nil {
+			return name, song, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: no favorite songs", ErrSongNotFound)
+}
+
+// favoritesSource returns the player running a nbfav command, writing an error to the output if the source
+// is not a player.
+func favoritesSource(src cmd.Source, output *cmd.Output) (*player.Player, bool) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbfav command is only valid for players")
+	}
+	return p, ok
+}
+
+// FavoriteAddCmd is the command to bookmark a song.
+type FavoriteAddCmd struct {
+	Add      cmd.SubCommand `cmd:"add"`
+	Filename string         `cmd:"filename"`
+}
+
+// Run checks in the background that the song exists and adds it to the player's favorites.
+func (c FavoriteAddCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if _, ok := favoritesSource(src, output); !ok {
+		return
+	}
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		if err := AddFavorite(src.(*player.Player).H(), c.Filename); err != nil {
+			output.Errorf("Failed to save your favorites: %v", err)
+			return
+		}
+		output.Printf("Added %s to your favorites", song.displayName())
+	})
+}
+
+// FavoriteRemoveCmd is the command to remove the bookmark of a song.
+type FavoriteRemoveCmd struct {
+	Remove   cmd.SubCommand `cmd:"remove"`
+	Filename string         `cmd:"filename"`
+}
+
+// Run removes the song from the player's favorites.
+func (c FavoriteRemoveCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := favoritesSource(src, output)
+	if !ok {
+		return
+	}
+	if !IsFavorite(p.H(), c.Filename) {
+		output.Errorf("%s is not one of your favorites", c.Filename)
+		return
+	}
+	if err := RemoveFavorite(p.H(), c.Filename); err != nil {
+		output.Errorf("Failed to save your favorites: %v", err)
+		return
+	}
+	output.Printf("Removed %s from your favorites", c.Filename)
+}
+
+// FavoriteListCmd is the command listing the songs the player bookmarked.
+type FavoriteListCmd struct {
+	List cmd.SubCommand `cmd:"list"`
+}
+
+// Run lists the player's favorites.
+func (c FavoriteListCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := favoritesSource(src, output)
+	if !ok {
+		return
+	}
+	favorites := Preferences(p.H()).Favorites
+	if len(favorites) == 0 {
+		output.Print("You have no favorite songs yet, add one with /nbfav add <filename>")
+		return
+	}
+	output.Printf("Favorites (%d songs):", len(favorites))
+	for _, name := range favorites {
+		output.Printf("§e/pnb %s§r", name)
+	}
+	output.Print("§7/nbfav play plays a random one")
+}
+
+// FavoritePlayCmd is the command to play a random song of the player's favorites.
+type FavoritePlayCmd struct {
+	Play cmd.SubCommand `cmd:"play"`
+}
+
+// Run plays a random favorite of the player.
+func (c FavoritePlayCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := favoritesSource(src, output)
+	if !ok || !checkCooldown(src, output, "nbfav") {
+		return
+	}
+	eh := p.H()
+	// Favorites that were deleted are skipped by loading them, which is done in the background.
+	go func() {
+		name, song, err := randomFavorite(eh)
+		if err != nil {
+			messagePlayer(eh, "§cYou have no favorite songs to play, add one with /nbfav add <filename>")
+			return
+		}
+		if err := checkRequestHandle(eh, song, false); err != nil {
+			messagePlayer(eh, fmt.Sprintf("§cCould not play %s: %v", song.displayName(), err))
+			return
+		}
+		startCooldown(eh, "nbfav")
+		go playSong(eh, song, PlaybackOptions{Source: "favorites"})
+		messagePlayer(eh, "Playing "+name+" from your favorites")
+	}()
+}
@@ -1,293 +1,788 @@
-package noteblockplayer
-
-import (
-	"encoding/binary"
-	"encoding/json"
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
-	"strings"
-)
-
-// Notes represents a single note event read from the NBS file.
-type Notes struct {
-	Tick       int   `json:"tick"`
-	Layer      int   `json:"layer"`
-	Instrument uint8 `json:"instrument"`
-	Key        uint8 `json:"key"`
-	Velocity   uint8 `json:"velocity"`
-	Panning    uint8 `json:"panning"`
-	Pitch      int16 `json:"pitch"`
-}
-
-// NBSData holds global information as well as all Notes parsed from a NBS file.
-type NBSData struct {
-	Version  uint8   `json:"version"`
-	Length   uint16  `json:"length"`
-	Layers   uint16  `json:"layers"`
-	Tempo    float32 `json:"tempo"`
-	Duration float32 `json:"duration"`
-	Notess   []Notes `json:"Notess"`
-}
-
-// ==================== File Utility Functions ====================
-
-// fileExists checks if the path exists and is a regular file.
-func fileExists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
-
-// ==================== Binary Reader Helper Functions ====================
-
-// readUint8 reads a uint8 from io.Reader (little endian).
-func readUint8(r io.Reader) (uint8, error) {
-	var b [1]byte
-	_, err := io.ReadFull(r, b[:])
-	return b[0], err
-}
-
-// readUint16 reads a uint16 from io.Reader (little endian).
-func readUint16(r io.Reader) (uint16, error) {
-	var b [2]byte
-	_, err := io.ReadFull(r, b[:])
-	return binary.LittleEndian.Uint16(b[:]), err
-}
-
-// readUint32 reads a uint32 from io.Reader (little endian).
-func readUint32(r io.Reader) (uint32, error) {
-	var b [4]byte
-	_, err := io.ReadFull(r, b[:])
-	return binary.LittleEndian.Uint32(b[:]), err
-}
-
-// readInt16 reads an int16 from io.Reader (little endian).
-func readInt16(r io.Reader) (int16, error) {
-	var b [2]byte
-	_, err := io.ReadFull(r, b[:])
-	return int16(binary.LittleEndian.Uint16(b[:])), err
-}
-
-// readString reads a string prefixed with uint32 length and cleans it.
-func readString(r io.Reader) (string, error) {
-	length, err := readUint32(r)
-	if err != nil {
-		return "", err
-	}
-	if length == 0 {
-		return "", nil
-	}
-	strBytes := make([]byte, length)
-	_, err = io.ReadFull(r, strBytes)
-	if err != nil {
-		return "", err
-	}
-	return cleanString(string(strBytes)), nil
-}
-
-// cleanString trims whitespace and removes NUL characters.
-func cleanString(s string) string {
-	return strings.ReplaceAll(strings.TrimSpace(strings.ReplaceAll(s, "\x00", "")), "\x00", "")
-}
-
-// ==================== NBS File Parsing & Loading Functions ====================
-
-// ParseNBS parses an NBS file (*.nbs) and returns an NBSData structure
-// containing the parsed notes and metadata.
-func ParseNBS(filename string) (*NBSData, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var data NBSData
-
-	// Parse header and meta fields
-	data.Length, err = readUint16(file)
-	if err != nil {
-		return nil, err
-	}
-
-	data.Version, err = readUint8(file)
-	if err != nil {
-		return nil, err
-	}
-
-	// Skip vanilla instrument count
-	if _, err := readUint8(file); err != nil {
-		return nil, err
-	}
-
-	data.Layers, err = readUint16(file)
-	if err != nil {
-		return nil, err
-	}
-
-	// Skip custom instrument count
-	if _, err := readUint16(file); err != nil {
-		return nil, err
-	}
-
-	// Skip title, author, original_author, description
-	for i := 0; i < 4; i++ {
-		if _, err := readString(file); err != nil {
-			return nil, err
-		}
-	}
-
-	// Tempo (as centi-tempo)
-	tempoRaw, err := readUint16(file)
-	if err != nil {
-		return nil, err
-	}
-	data.Tempo = float32(tempoRaw) / 100.0
-
-	// Skip: auto_save, auto_save_duration, time_signature
-	for i := 0; i < 3; i++ {
-		if _, err := readUint8(file); err != nil {
-			return nil, err
-		}
-	}
-	// Skip: minutes_spent, left_clicks, right_clicks, blocks_added, blocks_removed
-	for i := 0; i < 5; i++ {
-		if _, err := readUint32(file); err != nil {
-			return nil, err
-		}
-	}
-	// Skip import_name
-	if _, err := readString(file); err != nil {
-		return nil, err
-	}
-
-	// Skip loop, max_loop_count, loop_start_tick
-	for i := 0; i < 2; i++ {
-		if _, err := readUint8(file); err != nil {
-			return nil, err
-		}
-	}
-	if _, err := readUint16(file); err != nil {
-		return nil, err
-	}
-
-	// Begin parsing note blocks
-	tick := -1
-	var allNotess []Notes
-	for {
-		jumpTicks, err := readUint16(file)
-		if err != nil {
-			return nil, err
-		}
-		if jumpTicks == 0 {
-			break
-		}
-		tick += int(jumpTicks)
-
-		layer := -1
-		for {
-			jumpLayers, err := readUint16(file)
-			if err != nil {
-				return nil, err
-			}
-			if jumpLayers == 0 {
-				break
-			}
-			layer += int(jumpLayers)
-
-			instrument, err := readUint8(file)
-			if err != nil {
-				return nil, err
-			}
-			key, err := readUint8(file)
-			if err != nil {
-				return nil, err
-			}
-			velocity := uint8(100)
-			panning := uint8(100)
-			pitch := int16(0)
-			// Version >= 4 files have additional velocity, panning, pitch fields
-			if data.Version >= 4 {
-				if velocity, err = readUint8(file); err != nil {
-					return nil, err
-				}
-				if panning, err = readUint8(file); err != nil {
-					return nil, err
-				}
-				if pitch, err = readInt16(file); err != nil {
-					return nil, err
-				}
-			}
-			// Ignore placeholder note (key==0)
-			if key == 0 {
-				continue
-			}
-			n := Notes{
-				Tick:       tick,
-				Layer:      layer,
-				Instrument: instrument,
-				Key:        key,
-				Velocity:   velocity,
-				Panning:    panning,
-				Pitch:      pitch,
-			}
-			allNotess = append(allNotess, n)
-		}
-	}
-
-	// In some rare NBS files, length field is zero but notes exist.
-	if data.Length == 0 && len(allNotess) > 0 {
-		maxTick := allNotess[0].Tick
-		for _, n := range allNotess {
-			if n.Tick > maxTick {
-				maxTick = n.Tick
-			}
-		}
-		data.Length = uint16(maxTick)
-	}
-
-	// Calculate song duration (in seconds)
-	if data.Tempo > 0.0 {
-		data.Duration = float32(data.Length) / data.Tempo
-	}
-	data.Notess = allNotess
-	return &data, nil
-}
-
-// ReadNBS reads and parses an NBS file from disk and returns NBSData.
-func ReadNBS(path string) (*NBSData, error) {
-	return ParseNBS(path)
-}
-
-// loadJSON loads a Song struct from a .json file on disk.
-func loadJSON(path string) (*Song, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var song Song
-	if err := json.Unmarshal(data, &song); err != nil {
-		return nil, err
-	}
-	return &song, nil
-}
-
-// flexSongLoader tries to load a song from ./noteblock/ by name, choosing between NBS or JSON format automatically.
-// NBS files are parsed with ReadNBS, JSON files are decoded into Song.
-func flexSongLoader(name string) (*Song, error) {
-	name = strings.TrimSuffix(name, ".json")
-	name = strings.TrimSuffix(name, ".nbs")
-	jsonPath := filepath.Join("noteblock", name+".json")
-	nbsPath := filepath.Join("noteblock", name+".nbs")
-
-	if fileExists(nbsPath) {
-		data, err := ReadNBS(nbsPath)
-		if err != nil {
-			return nil, err
-		}
-		return nbsConverter(data), nil
-	} else if fileExists(jsonPath) {
-		return loadJSON(jsonPath)
-	}
-	return nil, fmt.Errorf("file not found")
-}
+package noteblockplayer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// Notes represents a single note event read from the NBS file.
+type Notes struct {
+	Tick       int   `json:"tick"`
+	Layer      int   `json:"layer"`
+	Instrument uint8 `json:"instrument"`
+	Key        uint8 `json:"key"`
+	Velocity   uint8 `json:"velocity"`
+	Panning    uint8 `json:"panning"`
+	Pitch      int16 `json:"pitch"`
+}
+
+// NBSData holds global information as well as all Notes parsed from a NBS file.
+type NBSData struct {
+	Version  uint8   `json:"version"`
+	Length   uint16  `json:"length"`
+	Layers   uint16  `json:"layers"`
+	Tempo    float32 `json:"tempo"`
+	Duration float32 `json:"duration"`
+	Title    string  `json:"title"`
+	Author   string  `json:"author"`
+	Notess   []Notes `json:"Notess"`
+	// OriginalAuthor is the author of the original song, if the NBS file is a cover or remix.
+	OriginalAuthor string `json:"originalAuthor"`
+	Description    string `json:"description"`
+	// ImportName is the name of the file (such as a MIDI file) the song was imported from.
+	ImportName string `json:"importName"`
+	// TimeSignature is the number of beats in a bar, 4 for 4/4 time.
+	TimeSignature uint8 `json:"timeSignature"`
+	// Loop, MaxLoopCount and LoopStartTick are the loop settings of the song (version 4 and newer). A
+	// MaxLoopCount of 0 loops forever.
+	Loop          bool   `json:"loop"`
+	MaxLoopCount  uint8  `json:"maxLoopCount"`
+	LoopStartTick uint16 `json:"loopStartTick"`
+	// VanillaInstruments is the number of vanilla instruments of Note Block Studio when the file was saved, and
+	// CustomInstruments the names of its custom instruments, whose indices follow the vanilla instruments.
+	VanillaInstruments uint8    `json:"vanillaInstruments"`
+	CustomInstruments  []string `json:"customInstruments,omitempty"`
+	// Warnings are problems of the file that it was parsed despite, such as being truncated.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ==================== File Utility Functions ====================
+
+// fileExists checks if the path exists and is a regular file.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// ==================== Binary Reader Helper Functions ====================
+
+// readUint8 reads a uint8 from io.Reader (little endian).
+func readUint8(r io.Reader) (uint8, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return b[0], err
+}
+
+// readUint16 reads a uint16 from io.Reader (little endian).
+func readUint16(r io.Reader) (uint16, error) {
+	var b [2]byte
+	_, err := io.ReadFull(r, b[:])
+	return binary.LittleEndian.Uint16(b[:]), err
+}
+
+// readUint32 reads a uint32 from io.Reader (little endian).
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	_, err := io.ReadFull(r, b[:])
+	return binary.LittleEndian.Uint32(b[:]), err
+}
+
+// readInt16 reads an int16 from io.Reader (little endian).
+func readInt16(r io.Reader) (int16, error) {
+	var b [2]byte
+	_, err := io.ReadFull(r, b[:])
+	return int16(binary.LittleEndian.Uint16(b[:])), err
+}
+
+// maxStringLength is the maximum length of a string in an NBS file, so that a corrupt length never makes
+// the parser allocate gigabytes.
+const maxStringLength = 1 << 20
+
+// readString reads a string prefixed with uint32 length and cleans it.
+func readString(r io.Reader) (string, error) {
+	length, err := readUint32(r)
+	if err != nil {
+		return "", err
+	}
+	if length == 0 {
+		return "", nil
+	}
+	if length > maxStringLength {
+		return "", fmt.Errorf("string length %d exceeds %d bytes", length, maxStringLength)
+	}
+	strBytes := make([]byte, length)
+	_, err = io.ReadFull(r, strBytes)
+	if err != nil {
+		return "", err
+	}
+	return cleanString(string(strBytes)), nil
+}
+
+// cleanString trims whitespace and removes NUL characters.
+func cleanString(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(strings.ReplaceAll(s, "\x00", "")), "\x00", "")
+}
+
+// ==================== NBS File Parsing & Loading Functions ====================
+
+// ParseNBS parses an NBS file (*.nbs) and returns an NBSData structure
+// containing the parsed notes and metadata.
+func ParseNBS(filename string) (*NBSData, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return DecodeNBS(bufio.NewReader(file))
+}
+
+// ParseOptions controls how strictly NBS files are parsed.
+type ParseOptions struct {
+	// Strict rejects NBS files that break the format after the note section, which the notes don't depend
+	// on: a missing or truncated layer or custom instrument section, and data after the end of the file.
+	// By default these files are accepted, since many tools export them and their notes play fine.
+	Strict bool
+}
+
+// parseOpts holds the ParseOptions set with SetParseOptions. parseOptsMtx protects access to parseOpts.
+var (
+	parseOpts    ParseOptions
+	parseOptsMtx sync.RWMutex
+)
+
+// SetParseOptions sets the ParseOptions used by DecodeNBS, ParseNBS and all songs loaded by name, such as
+// songs played with PlayNoteblock and the commands.
+func SetParseOptions(opts ParseOptions) {
+	parseOptsMtx.Lock()
+	defer parseOptsMtx.Unlock()
+	parseOpts = opts
+}
+
+// parseOptions returns the ParseOptions set with SetParseOptions.
+func parseOptions() ParseOptions {
+	parseOptsMtx.RLock()
+	defer parseOptsMtx.RUnlock()
+	return parseOpts
+}
+
+// DecodeNBS parses NBS data from r and returns an NBSData structure
+// containing the parsed notes and metadata, using the ParseOptions set
+// with SetParseOptions. Data that can't be parsed results in an error
+// wrapping ErrCorruptNBS and an *NBSError telling where the data is broken.
+func DecodeNBS(r io.Reader) (*NBSData, error) {
+	return DecodeNBSWithOptions(r, parseOptions())
+}
+
+// DecodeNBSWithOptions works like DecodeNBS, but parses the data with the
+// ParseOptions passed.
+func DecodeNBSWithOptions(r io.Reader, opts ParseOptions) (*NBSData, error) {
+	data, err := decodeNBS(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptNBS, err)
+	}
+	return data, nil
+}
+
+// NBSError describes where parsing an NBS file failed, so broken exports can be diagnosed.
+type NBSError struct {
+	// Section is the section of the file the error occurred in: "header", "notes", "layers" or
+	// "instruments".
+	Section string
+	// Field is the field that couldn't be read, for example "note key".
+	Field string
+	// Offset is the byte offset of the field in the file.
+	Offset int64
+	// Tick and Layer are the tick and layer of the note being read in the note section, or -1 if unknown.
+	Tick, Layer int
+	// Err is the error that occurred while reading the field.
+	Err error
+}
+
+// Error returns a description of the error and where it occurred, for example
+// "failed reading note key at offset 0x1A2F in tick 384, layer 2: unexpected EOF".
+func (e *NBSError) Error() string {
+	msg := fmt.Sprintf("failed reading %s at offset 0x%X", e.Field, e.Offset)
+	if e.Tick >= 0 {
+		msg += fmt.Sprintf(" in tick %d", e.Tick)
+		if e.Layer >= 0 {
+			msg += fmt.Sprintf(", layer %d", e.Layer)
+		}
+	} else if e.Layer >= 0 {
+		msg += fmt.Sprintf(" of layer %d", e.Layer)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error that occurred while reading the field.
+func (e *NBSError) Unwrap() error {
+	return e.Err
+}
+
+// nbsDecoder reads the fields of an NBS file, keeping track of the byte offset and the position in the note
+// section, so that errors tell where the file is broken.
+type nbsDecoder struct {
+	r           io.Reader
+	offset      int64
+	section     string
+	tick, layer int
+}
+
+// Read reads from the underlying reader and advances the offset.
+func (d *nbsDecoder) Read(b []byte) (int, error) {
+	n, err := d.r.Read(b)
+	d.offset += int64(n)
+	return n, err
+}
+
+// wrap returns an *NBSError for the field starting at the offset passed, or nil if err is nil.
+func (d *nbsDecoder) wrap(field string, start int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	// Running out of data in the middle of a file is never expected.
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return &NBSError{Section: d.section, Field: field, Offset: start, Tick: d.tick, Layer: d.layer, Err: err}
+}
+
+// uint8 reads the uint8 field with the name passed.
+func (d *nbsDecoder) uint8(field string) (uint8, error) {
+	start := d.offset
+	v, err := readUint8(d)
+	return v, d.wrap(field, start, err)
+}
+
+// uint16 reads the uint16 field with the name passed.
+func (d *nbsDecoder) uint16(field string) (uint16, error) {
+	start := d.offset
+	v, err := readUint16(d)
+	return v, d.wrap(field, start, err)
+}
+
+// uint32 reads the uint32 field with the name passed.
+func (d *nbsDecoder) uint32(field string) (uint32, error) {
+	start := d.offset
+	v, err := readUint32(d)
+	return v, d.wrap(field, start, err)
+}
+
+// int16 reads the int16 field with the name passed.
+func (d *nbsDecoder) int16(field string) (int16, error) {
+	start := d.offset
+	v, err := readInt16(d)
+	return v, d.wrap(field, start, err)
+}
+
+// string reads the string field with the name passed.
+func (d *nbsDecoder) string(field string) (string, error) {
+	start := d.offset
+	v, err := readString(d)
+	return v, d.wrap(field, start, err)
+}
+
+// decodeNBS parses NBS data from r for DecodeNBSWithOptions. Errors are of the type *NBSError.
+func decodeNBS(r io.Reader, opts ParseOptions) (*NBSData, error) {
+	var (
+		data NBSData
+		err  error
+		d    = &nbsDecoder{r: r, section: "header", tick: -1, layer: -1}
+	)
+
+	// Parse header and meta fields. Files of version 0 start with the song length, newer files start with
+	// zero followed by the version.
+	first, err := d.uint16("song length")
+	if err != nil {
+		return nil, err
+	}
+	if first != 0 {
+		data.Length = first
+		// Version 0 files were saved by the original Note Block Studio, which had 10 instruments.
+		data.VanillaInstruments = 10
+	} else {
+		if data.Version, err = d.uint8("version"); err != nil {
+			return nil, err
+		}
+		if data.VanillaInstruments, err = d.uint8("vanilla instrument count"); err != nil {
+			return nil, err
+		}
+		if data.Version >= 3 {
+			if data.Length, err = d.uint16("song length"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if data.Layers, err = d.uint16("layer count"); err != nil {
+		return nil, err
+	}
+	if data.Title, err = d.string("song name"); err != nil {
+		return nil, err
+	}
+	if data.Author, err = d.string("song author"); err != nil {
+		return nil, err
+	}
+	if data.OriginalAuthor, err = d.string("original author"); err != nil {
+		return nil, err
+	}
+	if data.Description, err = d.string("description"); err != nil {
+		return nil, err
+	}
+
+	// Tempo (as centi-tempo)
+	tempoRaw, err := d.uint16("tempo")
+	if err != nil {
+		return nil, err
+	}
+	data.Tempo = float32(tempoRaw) / 100.0
+
+	// Skip: auto_save, auto_save_duration
+	for _, field := range []string{"auto save", "auto save duration"} {
+		if _, err := d.uint8(field); err != nil {
+			return nil, err
+		}
+	}
+	if data.TimeSignature, err = d.uint8("time signature"); err != nil {
+		return nil, err
+	}
+	// Skip: minutes_spent, left_clicks, right_clicks, blocks_added, blocks_removed
+	for _, field := range []string{"minutes spent", "left clicks", "right clicks", "note blocks added", "note blocks removed"} {
+		if _, err := d.uint32(field); err != nil {
+			return nil, err
+		}
+	}
+	if data.ImportName, err = d.string("import name"); err != nil {
+		return nil, err
+	}
+
+	// Loop, max_loop_count, loop_start_tick (version 4 and newer)
+	if data.Version >= 4 {
+		loop, err := d.uint8("loop")
+		if err != nil {
+			return nil, err
+		}
+		data.Loop = loop != 0
+		if data.MaxLoopCount, err = d.uint8("max loop count"); err != nil {
+			return nil, err
+		}
+		if data.LoopStartTick, err = d.uint16("loop start tick"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Begin parsing note blocks
+	allNotess, err := d.notes(data.Version)
+	if err != nil {
+		// A file that ends in the middle of the note section was most likely cut off while it was copied or
+		// uploaded. Lenient parsing plays the notes read up to that point.
+		if opts.Strict || !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		data.Warnings = append(data.Warnings, fmt.Sprintf("file is truncated (%v), only the first %d notes were read", err, len(allNotess)))
+		// The song ends with the last note read rather than with silence up to the length in the header.
+		data.Length = 0
+	}
+
+	// The notes are all that is played, so the sections after them are only checked in strict mode. They are
+	// still read as far as possible otherwise, for the custom instruments, which tempo changers are.
+	if data.CustomInstruments, err = d.trailer(data.Version, data.Layers); err != nil && opts.Strict {
+		return nil, err
+	}
+
+	// Files older than version 3 don't store the length, and some tools leave it zero although notes exist.
+	if data.Length == 0 && len(allNotess) > 0 {
+		maxTick := allNotess[0].Tick
+		for _, n := range allNotess {
+			if n.Tick > maxTick {
+				maxTick = n.Tick
+			}
+		}
+		data.Length = uint16(maxTick)
+	}
+
+	// Calculate song duration (in seconds)
+	if data.Tempo > 0.0 {
+		data.Duration = float32(data.Length) / data.Tempo
+	}
+	data.Notess = allNotess
+	return &data, nil
+}
+
+// notes reads the note section of an NBS file of the version passed. If reading fails, the notes read so
+// far are returned along with the error.
+func (d *nbsDecoder) notes(version uint8) ([]Notes, error) {
+	d.section = "notes"
+	tick := -1
+	var allNotess []Notes
+	for {
+		d.layer = -1
+		jumpTicks, err := d.uint16("tick jump")
+		if err != nil {
+			return allNotess, err
+		}
+		if jumpTicks == 0 {
+			break
+		}
+		tick += int(jumpTicks)
+		d.tick = tick
+
+		layer := -1
+		for {
+			jumpLayers, err := d.uint16("layer jump")
+			if err != nil {
+				return allNotess, err
+			}
+			if jumpLayers == 0 {
+				break
+			}
+			layer += int(jumpLayers)
+			d.layer = layer
+
+			instrument, err := d.uint8("note instrument")
+			if err != nil {
+				return allNotess, err
+			}
+			key, err := d.uint8("note key")
+			if err != nil {
+				return allNotess, err
+			}
+			velocity := uint8(100)
+			panning := uint8(100)
+			pitch := int16(0)
+			// Version >= 4 files have additional velocity, panning, pitch fields
+			if version >= 4 {
+				if velocity, err = d.uint8("note velocity"); err != nil {
+					return allNotess, err
+				}
+				if panning, err = d.uint8("note panning"); err != nil {
+					return allNotess, err
+				}
+				if pitch, err = d.int16("note pitch"); err != nil {
+					return allNotess, err
+				}
+			}
+			// Ignore placeholder note (key==0)
+			if key == 0 {
+				continue
+			}
+			n := Notes{
+				Tick:       tick,
+				Layer:      layer,
+				Instrument: instrument,
+				Key:        key,
+				Velocity:   velocity,
+				Panning:    panning,
+				Pitch:      pitch,
+			}
+			allNotess = append(allNotess, n)
+		}
+	}
+
+	return allNotess, nil
+}
+
+// trailer reads the layer and custom instrument sections that follow the note section of an NBS file of the
+// version and with the number of layers passed, and checks that the file ends after them. It returns the
+// names of the custom instruments, including those read before an error occurred.
+func (d *nbsDecoder) trailer(version uint8, layers uint16) ([]string, error) {
+	d.section, d.tick = "layers", -1
+	for layer := range int(layers) {
+		d.layer = layer
+		if _, err := d.string("layer name"); err != nil {
+			return nil, err
+		}
+		if version >= 4 {
+			if _, err := d.uint8("layer lock"); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := d.uint8("layer volume"); err != nil {
+			return nil, err
+		}
+		if version >= 2 {
+			if _, err := d.uint8("layer stereo"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	d.section, d.layer = "instruments", -1
+	count, err := d.uint8("custom instrument count")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, count)
+	for range int(count) {
+		name, err := d.string("instrument name")
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+		if _, err := d.string("instrument sound file"); err != nil {
+			return names, err
+		}
+		if _, err := d.uint8("instrument key"); err != nil {
+			return names, err
+		}
+		if _, err := d.uint8("instrument press"); err != nil {
+			return names, err
+		}
+	}
+
+	start := d.offset
+	if n, _ := d.Read(make([]byte, 1)); n > 0 {
+		return names, d.wrap("end of file", start, errors.New("unexpected data after the end of the song"))
+	}
+	return names, nil
+}
+
+// ReadNBS reads and parses an NBS file from disk and returns NBSData.
+func ReadNBS(path string) (*NBSData, error) {
+	return ParseNBS(path)
+}
+
+// loadJSON loads a Song struct from a .json file on disk.
+func loadJSON(path string) (*Song, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var song Song
+	if err := json.Unmarshal(data, &song); err != nil {
+		return nil, err
+	}
+	return &song, nil
+}
+
+// flexSongLoader tries to load a song by name from the song folders (./noteblock/ by default), choosing
+// between NBS or JSON format automatically. NBS files are parsed with ReadNBS, JSON files are decoded into
+// Song. Songs are kept in the song cache, so a song that didn't change since it was last loaded is not
+// parsed again.
+func flexSongLoader(name string) (*Song, error) {
+	return loadSong(name, nil, nil)
+}
+
+// LoadSong loads the song with the name passed from the song folders or song packs like PlayNoteblock does,
+// parsing NBS files with the ParseOptions passed instead of those set with SetParseOptions.
+//
+// Example usage (check a song against the NBS format before playing it):
+//
+//	song, err := noteblockplayer.LoadSong("my_song", noteblockplayer.ParseOptions{Strict: true})
+func LoadSong(name string, opts ParseOptions) (*Song, error) {
+	return loadSongWith(name, nil, nil, opts)
+}
+
+// loadSong loads a song like flexSongLoader, searching the song folders of the world passed (if not nil)
+// first, and calling progress (if not nil) with the number of bytes read so far and the size of the file
+// while the song is parsed. Names of the form "pack:song" are loaded from song packs (see ListPacks).
+// Names starting with "#" are song IDs (see SongID). Names that could reach files outside the song folders result in an error wrapping ErrInvalidName, songs
+// that don't exist in one wrapping ErrSongNotFound, and files that exist but aren't NBS
+// or JSON songs in one wrapping ErrUnsupportedFormat.
+func loadSong(name string, w *world.World, progress func(read, total int64)) (*Song, error) {
+	return loadSongWith(name, w, progress, parseOptions())
+}
+
+// loadSongWith loads a song like loadSong, parsing NBS files with the ParseOptions passed.
+func loadSongWith(name string, w *world.World, progress func(read, total int64), opts ParseOptions) (*Song, error) {
+	if id, ok := strings.CutPrefix(name, songIDPrefix); ok {
+		resolved, err := resolveSongID(id)
+		if err != nil {
+			return nil, err
+		}
+		name = resolved
+	}
+	if hasDriveLetter(name) {
+		// "C:\x" would otherwise be read as the song "\x" of the pack "C".
+		return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	if pack, song, ok := strings.Cut(name, ":"); ok {
+		if err := validSongName(pack); err != nil {
+			return nil, err
+		}
+		if err := validSongName(song); err != nil {
+			return nil, err
+		}
+		s, err := loadPackSong(pack, song, w, progress, opts)
+		if errors.Is(err, ErrSongNotFound) {
+			if suggestion, ok := suggestSong(name, w); ok {
+				return nil, fmt.Errorf("%w (did you mean %s?)", err, suggestion)
+			}
+		}
+		return s, err
+	}
+	if err := validSongName(name); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSuffix(name, ".json")
+	name = strings.TrimSuffix(name, ".nbs")
+	for _, dir := range searchDirs(w) {
+		for _, file := range []string{name + ".nbs", name + ".json"} {
+			full := filepath.Join(dir, file)
+			info, err := os.Stat(full)
+			if err != nil {
+				continue
+			}
+			return cachedSong(cacheKey(full, opts), info, func() (*Song, error) {
+				return loadSongFile(os.DirFS(dir), filepath.ToSlash(file), name, progress, opts)
+			})
+		}
+	}
+	// A file that exists with the exact name passed, but without a song extension, is loaded if its content
+	// is a song.
+	for _, dir := range searchDirs(w) {
+		full := filepath.Join(dir, name)
+		if info, err := os.Stat(full); err == nil && info.Mode().IsRegular() {
+			return cachedSong(cacheKey(full, opts), info, func() (*Song, error) {
+				return loadSongFile(os.DirFS(dir), filepath.ToSlash(name), name, progress, opts)
+			})
+		}
+	}
+	// Names are matched without case as a last resort, so players don't need to type the exact file name.
+	for _, dir := range searchDirs(w) {
+		file, ok := findFileFold(dir, name+".nbs", name+".json", name)
+		if !ok {
+			continue
+		}
+		full := filepath.Join(dir, file)
+		if info, err := os.Stat(full); err == nil {
+			return cachedSong(cacheKey(full, opts), info, func() (*Song, error) {
+				return loadSongFile(os.DirFS(dir), file, name, progress, opts)
+			})
+		}
+	}
+	if suggestion, ok := suggestSong(name, w); ok {
+		return nil, fmt.Errorf("%w: %s (did you mean %s?)", ErrSongNotFound, name, suggestion)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSongNotFound, name)
+}
+
+// cacheKey returns the key in the song cache of the song file with the path passed, parsed with the
+// ParseOptions passed. Songs parsed strictly are cached separately, as a song that loads leniently may
+// still fail to load strictly.
+func cacheKey(p string, opts ParseOptions) string {
+	if opts.Strict {
+		return p + "?strict"
+	}
+	return p
+}
+
+// songFormat is the format of song data, as detected by sniffFormat.
+type songFormat int
+
+const (
+	formatUnknown songFormat = iota
+	formatNBS
+	formatJSON
+)
+
+// sniffLength is the number of bytes looked at to detect the format of song data.
+const sniffLength = 512
+
+// utf8BOM is the byte order mark some editors put at the start of UTF-8 text files.
+const utf8BOM = "\xef\xbb\xbf"
+
+// sniffFormat detects the format of song data by its first bytes. JSON songs are objects, so they start with
+// "{" after any whitespace or byte order mark, and NBS files of version 1 and newer start with two zero bytes.
+// NBS files of the original format have no such marker, so they are reported as formatUnknown.
+func sniffFormat(head []byte) songFormat {
+	text := bytes.TrimLeft(bytes.TrimPrefix(head, []byte(utf8BOM)), " \t\r\n")
+	switch {
+	case len(text) > 0 && text[0] == '{':
+		return formatJSON
+	case len(head) >= 3 && head[0] == 0 && head[1] == 0:
+		return formatNBS
+	}
+	return formatUnknown
+}
+
+// DecodeSong decodes a song in the NBS or JSON format from r, detecting the format by the content. Data in
+// neither format is parsed as an NBS file of the original format, which has no marker to detect it by.
+//
+// Example usage (load a song received over HTTP):
+//
+//	song, err := noteblockplayer.DecodeSong(resp.Body)
+func DecodeSong(r io.Reader) (*Song, error) {
+	return decodeSong(bufio.NewReader(r), "", parseOptions())
+}
+
+// decodeSong decodes a song from r, detecting its format by the content. ext is the extension of the file
+// the song is read from, if any: data in an unknown format is only parsed as an NBS file if the extension
+// is ".nbs" or empty. NBS files are parsed with the ParseOptions passed.
+func decodeSong(r *bufio.Reader, ext string, opts ParseOptions) (*Song, error) {
+	head, _ := r.Peek(sniffLength)
+	format := sniffFormat(head)
+	if format == formatUnknown {
+		if ext != "" && !strings.EqualFold(ext, ".nbs") {
+			return nil, fmt.Errorf("%w: not an NBS or JSON song", ErrUnsupportedFormat)
+		}
+		format = formatNBS
+	}
+	if format == formatNBS {
+		data, err := DecodeNBSWithOptions(r, opts)
+		if err != nil {
+			return nil, err
+		}
+		return nbsConverter(data), nil
+	}
+	if bytes.HasPrefix(head, []byte(utf8BOM)) {
+		// The JSON decoder doesn't skip byte order marks itself.
+		_, _ = r.Discard(len(utf8BOM))
+	}
+	song := &Song{}
+	if err := json.NewDecoder(r).Decode(song); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedFormat, err)
+	}
+	return song, nil
+}
+
+// loadSongFile loads the song at the path passed in fsys along with its lyrics and markers. The format of
+// the song is detected by its content, so NBS and JSON files with the wrong extension load too. name is the
+// name the song was requested by. progress, if not nil, is called while the file is read. NBS files are
+// parsed with the ParseOptions passed.
+func loadSongFile(fsys fs.FS, file, name string, progress func(read, total int64), opts ParseOptions) (*Song, error) {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if progress != nil {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		r = &progressReader{r: f, total: info.Size(), report: progress}
+	}
+
+	song, err := decodeSong(bufio.NewReader(r), path.Ext(file), opts)
+	if err != nil {
+		return nil, err
+	}
+	song.name = name
+	base := strings.TrimSuffix(file, path.Ext(file))
+	if err := loadLyrics(fsys, base, song); err != nil {
+		return nil, err
+	}
+	if err := loadMarkers(fsys, base, song); err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
+// progressReader wraps an io.Reader and reports the number of bytes read from it after every read.
+type progressReader struct {
+	r      io.Reader
+	read   int64
+	total  int64
+	report func(read, total int64)
+}
+
+// Read reads from the wrapped reader and reports the progress.
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	p.report(p.read, p.total)
+	return n, err
+}
@@ -0,0 +1,28 @@
+package noteblockplayer
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSongBOM(t *testing.T) {
+	const song = `{"tempo": 10, "length": 4, "notes": [{"tick": 2, "layer": 0, "instrument": 0, "key": 45, "velocity": 100}]}`
+	tests := map[string]string{
+		"plain":           song,
+		"bom":             utf8BOM + song,
+		"bom, whitespace": utf8BOM + "\r\n  " + song,
+	}
+	for name, data := range tests {
+		for _, ext := range []string{"", ".json", ".nbs"} {
+			got, err := decodeSong(bufio.NewReader(strings.NewReader(data)), ext, ParseOptions{})
+			if err != nil {
+				t.Errorf("%s (%q): decodeSong = %v, want the song", name, ext, err)
+				continue
+			}
+			if got.Tempo != 10 || len(got.Notes) != 1 || got.Notes[0].Tick != 2 {
+				t.Errorf("%s (%q): decodeSong = %+v, want the song decoded", name, ext, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package noteblockplayer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// nbsWriteVersion is the NBS format version written by WriteNBS.
+const nbsWriteVersion = 5
+
+// ==================== Binary Writer Helper ====================
+
+// nbsWriter writes little endian NBS fields to a buffered writer. It keeps the first error that occurred,
+// so that all fields can be written one after another and the error is checked once at the end.
+type nbsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// write writes raw bytes unless an earlier write failed.
+func (w *nbsWriter) write(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+// uint8 writes a uint8.
+func (w *nbsWriter) uint8(v uint8) {
+	w.write([]byte{v})
+}
+
+// uint16 writes a uint16 (little endian).
+func (w *nbsWriter) uint16(v uint16) {
+	w.write(binary.LittleEndian.AppendUint16(nil, v))
+}
+
+// int16 writes an int16 (little endian).
+func (w *nbsWriter) int16(v int16) {
+	w.uint16(uint16(v))
+}
+
+// uint32 writes a uint32 (little endian).
+func (w *nbsWriter) uint32(v uint32) {
+	w.write(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+// string writes a string prefixed with its uint32 length.
+func (w *nbsWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.write([]byte(s))
+}
+
+// clampUint8 clamps an int to the range of a uint8.
+func clampUint8(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+// ==================== NBS & JSON File Writing Functions ====================
+
+// WriteNBS encodes the song in the NBS format (version 5) and writes it to w.
+// Velocities are written as they are, so notes with velocity 0 stay silent like they are in playback, and
+// notes without panning are centred. Notes with a negative tick are never played and are left out, notes on
+// a negative layer are moved to the first layer. Songs with ticks or layers past 65535 can't be encoded and
+// return an error.
+// Custom instruments are written with the names of Song.CustomInstruments. Tempo changes are written as
+// tempo changers on a layer of their own. NBS files have no tempo ramps, so ramps are written as a change at
+// the end of the ramp.
+func WriteNBS(w io.Writer, song *Song) error {
+	notes := make([]Note, 0, len(song.Notes))
+	for _, n := range song.Notes {
+		if n.Tick < 0 {
+			continue
+		}
+		n.Layer = max(n.Layer, 0)
+		notes = append(notes, n)
+	}
+	// customs is the number of custom instruments, which follow the vanilla instruments, so every index up
+	// to the highest one used is written.
+	length, layers, customs := song.Length, 0, 0
+	for _, n := range notes {
+		length = max(length, n.Tick)
+		layers = max(layers, n.Layer+1)
+		customs = max(customs, n.Instrument-len(instrumentSounds)+1)
+	}
+	for index := range song.CustomInstruments {
+		customs = max(customs, index-len(instrumentSounds)+1)
+	}
+	// The tempo changer comes after the other custom instruments, and indices are stored in a byte.
+	customs = min(customs, math.MaxUint8-len(instrumentSounds))
+	tempoChanges := newTempoCurve(song, PlaybackOptions{}).changes
+	for _, ch := range tempoChanges {
+		notes = append(notes, Note{
+			Tick:       ch.Tick,
+			Layer:      layers,
+			Instrument: len(instrumentSounds) + customs,
+			Key:        customInstrumentKey,
+			Pitch:      int(math.Round(min(ch.Tempo*15, math.MaxInt16))),
+		})
+		length = max(length, ch.Tick)
+	}
+	if len(tempoChanges) > 0 {
+		layers++
+	}
+	if length > math.MaxUint16 || layers > math.MaxUint16 {
+		return fmt.Errorf("song too large for NBS: %d ticks, %d layers (at most %d)", length, layers, math.MaxUint16)
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].Tick != notes[j].Tick {
+			return notes[i].Tick < notes[j].Tick
+		}
+		return notes[i].Layer < notes[j].Layer
+	})
+
+	nw := &nbsWriter{w: bufio.NewWriter(w)}
+
+	// Header
+	nw.uint16(0) // New format marker
+	nw.uint8(nbsWriteVersion)
+	nw.uint8(uint8(len(instrumentSounds)))
+	nw.uint16(uint16(length))
+	nw.uint16(uint16(layers))
+	nw.string(song.Title)
+	nw.string(song.Author)
+	nw.string(song.OriginalAuthor)
+	nw.string(song.Description)
+	nw.uint16(uint16(math.Round(min(max(song.Tempo, 0), 655.35) * 100)))
+	nw.uint8(0)                              // Auto-saving
+	nw.uint8(0)                              // Auto-saving duration
+	nw.uint8(clampUint8(song.BeatsPerBar())) // Time signature
+	// Minutes spent, left clicks, right clicks, blocks added, blocks removed
+	for i := 0; i < 5; i++ {
+		nw.uint32(0)
+	}
+	nw.string(song.ImportName)
+	if song.LoopEnabled {
+		nw.uint8(1)
+	} else {
+		nw.uint8(0)
+	}
+	nw.uint8(clampUint8(song.LoopCount))
+	nw.uint16(uint16(min(max(song.LoopStartTick, 0), 65535)))
+
+	// Note blocks: jumps to the next tick, then jumps to the next layer within that tick.
+	tick := -1
+	for i := 0; i < len(notes); {
+		nw.uint16(uint16(notes[i].Tick - tick))
+		tick = notes[i].Tick
+		layer := -1
+		for ; i < len(notes) && notes[i].Tick == tick; i++ {
+			n := notes[i]
+			if n.Layer <= layer {
+				// Two notes on the same tick and layer can't be stored, keep the first one.
+				continue
+			}
+			velocity, panning := n.Velocity, n.Panning
+			if panning == 0 {
+				panning = 100
+			}
+			nw.uint16(uint16(n.Layer - layer))
+			nw.uint8(clampUint8(n.Instrument))
+			nw.uint8(clampUint8(n.Key))
+			nw.uint8(clampUint8(velocity))
+			nw.uint8(clampUint8(panning))
+			nw.int16(int16(n.Pitch))
+			layer = n.Layer
+		}
+		nw.uint16(0)
+	}
+	nw.uint16(0)
+
+	// Layers: name, lock, volume and stereo of every layer.
+	for i := 0; i < layers; i++ {
+		nw.string("")
+		nw.uint8(0)
+		nw.uint8(100)
+		nw.uint8(100)
+	}
+	// Custom instruments: name, sound file, key and press.
+	names := make([]string, customs, customs+1)
+	for i := range names {
+		names[i] = song.CustomInstruments[len(instrumentSounds)+i]
+	}
+	if len(tempoChanges) > 0 {
+		names = append(names, tempoChangerName)
+	}
+	nw.uint8(uint8(len(names)))
+	for _, name := range names {
+		nw.string(name)
+		nw.string("")
+		nw.uint8(customInstrumentKey)
+		nw.uint8(0)
+	}
+
+	if nw.err != nil {
+		return nw.err
+	}
+	return nw.w.Flush()
+}
+
+// saveJSON writes the song as a .json file to the file passed.
+func saveJSON(file *os.File, song *Song) error {
+	data, err := json.MarshalIndent(song, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	return err
+}
+
+// saveFile opens the file at the path passed with the flags passed, and writes the song to it as JSON if the
+// path ends with ".json" and as NBS otherwise.
+func saveFile(path string, song *Song, flag int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = saveJSON(file, song)
+	} else {
+		err = WriteNBS(file, song)
+	}
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// SaveSong writes the song to the path passed, as JSON if the path ends with ".json" and as NBS otherwise.
+func SaveSong(path string, song *Song) error {
+	return saveFile(path, song, os.O_TRUNC)
+}
@@ -6,6 +6,7 @@ require (
 	github.com/df-mc/dragonfly v0.10.8
 	github.com/go-gl/mathgl v1.2.0
 	github.com/sandertv/gophertunnel v1.50.0
+	golang.org/x/net v0.35.0
 )
 
 require (
@@ -21,7 +22,6 @@ require (
 	github.com/sandertv/go-raknet v1.14.3-0.20250305181847-6af3e95113d6 // indirect
 	github.com/segmentio/fasthash v1.0.3 // indirect
 	golang.org/x/exp v0.0.0-20250103183323-7d7fa50e5329 // indirect
-	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/oauth2 v0.25.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 )
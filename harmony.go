@@ -0,0 +1,303 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// pitchClass returns the pitch class of a Note Block Studio key, from 0 for C to 11 for B.
+func pitchClass(key int) int {
+	// Key 0 is A0, which is 9 semitones above C.
+	return ((key+9)%12 + 12) % 12
+}
+
+// isPercussion reports whether the instrument passed is a drum (bass drum, snare or click), whose notes have
+// no pitch that adds to the harmony.
+func isPercussion(instrument int) bool {
+	return instrument >= 1 && instrument <= 3
+}
+
+// pitchProfile returns how much every pitch class sounds in the notes of the song between the ticks from
+// and to (exclusive), weighted by velocity. Drums are left out.
+func pitchProfile(notes []Note, from, to int) (profile [12]float64, total float64) {
+	for _, n := range notes {
+		if n.Tick < from || n.Tick >= to || isPercussion(n.Instrument) {
+			continue
+		}
+		weight := float64(n.Velocity)
+		if weight <= 0 {
+			// Songs converted without velocities play every note at full volume.
+			weight = 100
+		}
+		profile[pitchClass(n.Key)] += weight
+		total += weight
+	}
+	return profile, total
+}
+
+// MusicalKey is the key of a song: its tonic and whether it is major or minor.
+type MusicalKey struct {
+	// Tonic is the pitch class of the tonic, from 0 for C to 11 for B.
+	Tonic int
+	Minor bool
+}
+
+// String returns the name of the key, for example "C major" or "F# minor".
+func (k MusicalKey) String() string {
+	if k.Minor {
+		return keyNames[k.Tonic] + " minor"
+	}
+	return keyNames[k.Tonic] + " major"
+}
+
+// SemitonesTo returns the smallest number of semitones, from -5 to 6, a song in this key must be transposed
+// by to be in the key passed. Major and minor are not changed, so only the tonic of the key passed matters.
+func (k MusicalKey) SemitonesTo(target MusicalKey) int {
+	d := ((target.Tonic-k.Tonic)%12 + 12) % 12
+	if d > 6 {
+		d -= 12
+	}
+	return d
+}
+
+// majorScale and minorScale are the semitones of the degrees of the major and natural minor scales above
+// their tonic.
+var (
+	majorScale = [7]int{0, 2, 4, 5, 7, 9, 11}
+	minorScale = [7]int{0, 2, 3, 5, 7, 8, 10}
+)
+
+// DiatonicInterval returns the number of semitones the Note Block Studio key passed must be moved by to move
+// it the number of scale degrees passed within this key, for harmonies that stay in the key: a third above
+// C in C major is 4 semitones, a third above D is 3. Keys not in the scale are moved as if they were the
+// scale degree below them.
+//
+// Example usage (move a note a diatonic third up):
+//
+//	key, _, _ := song.Key()
+//	note.Key += key.DiatonicInterval(note.Key, 2)
+func (k MusicalKey) DiatonicInterval(key, degrees int) int {
+	scale := majorScale
+	if k.Minor {
+		scale = minorScale
+	}
+	rel := ((pitchClass(key)-k.Tonic)%12 + 12) % 12
+	degree := 0
+	for i, s := range scale {
+		if s <= rel {
+			degree = i
+		}
+	}
+	octaves, target := floorDiv(degree+degrees, 7)
+	return octaves*12 + scale[target] - scale[degree]
+}
+
+// floorDiv divides a by b rounding down, returning the quotient and the non-negative remainder.
+func floorDiv(a, b int) (q, r int) {
+	q, r = a/b, a%b
+	if r < 0 {
+		q, r = q-1, r+b
+	}
+	return q, r
+}
+
+// Key profiles of Krumhansl and Kessler: how well every pitch class fits a major and minor key with its tonic
+// on C.
+var (
+	majorKeyProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorKeyProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// Key estimates the key of the song from the pitches of its notes, and returns it along with the
+// correlation, from -1 to 1, of the notes with the key, which tells how clearly the song is in it. Songs
+// without pitched notes return false.
+func (s *Song) Key() (MusicalKey, float64, bool) {
+	profile, total := pitchProfile(s.Notes, math.MinInt, math.MaxInt)
+	if total == 0 {
+		return MusicalKey{}, 0, false
+	}
+	best, bestScore := MusicalKey{}, math.Inf(-1)
+	for tonic := range 12 {
+		for _, minor := range []bool{false, true} {
+			keyProfile := majorKeyProfile
+			if minor {
+				keyProfile = minorKeyProfile
+			}
+			var rotated [12]float64
+			for pc := range 12 {
+				rotated[pc] = keyProfile[((pc-tonic)%12+12)%12]
+			}
+			if score := correlation(profile, rotated); score > bestScore {
+				best, bestScore = MusicalKey{Tonic: tonic, Minor: minor}, score
+			}
+		}
+	}
+	return best, bestScore, true
+}
+
+// correlation returns the Pearson correlation of a and b.
+func correlation(a, b [12]float64) float64 {
+	var meanA, meanB float64
+	for i := range 12 {
+		meanA += a[i] / 12
+		meanB += b[i] / 12
+	}
+	var cov, varA, varB float64
+	for i := range 12 {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// ChordQuality is the kind of a triad.
+type ChordQuality int
+
+const (
+	Major ChordQuality = iota
+	Minor
+	Diminished
+	Augmented
+)
+
+// String returns the name of the chord quality, for example "minor".
+func (q ChordQuality) String() string {
+	switch q {
+	case Major:
+		return "major"
+	case Minor:
+		return "minor"
+	case Diminished:
+		return "diminished"
+	case Augmented:
+		return "augmented"
+	}
+	return fmt.Sprintf("ChordQuality(%d)", int(q))
+}
+
+// chordIntervals are the semitones of the notes of every ChordQuality above its root, and chordSuffixes the
+// suffixes of chord names with the quality.
+var (
+	chordIntervals = map[ChordQuality][3]int{
+		Major:      {0, 4, 7},
+		Minor:      {0, 3, 7},
+		Diminished: {0, 3, 6},
+		Augmented:  {0, 4, 8},
+	}
+	chordSuffixes = map[ChordQuality]string{Major: "", Minor: "m", Diminished: "dim", Augmented: "aug"}
+)
+
+// Chord is a triad: a root and the quality of the chord built on it.
+type Chord struct {
+	// Root is the pitch class of the root, from 0 for C to 11 for B.
+	Root    int
+	Quality ChordQuality
+}
+
+// String returns the name of the chord, for example "C", "Am" or "Bdim".
+func (c Chord) String() string {
+	return keyNames[c.Root] + chordSuffixes[c.Quality]
+}
+
+// BarChord is the chord detected in a bar of a song.
+type BarChord struct {
+	// Bar is the bar, counted from 1.
+	Bar   int
+	Chord Chord
+	// Found is false for bars without pitched notes, which have no chord.
+	Found bool
+}
+
+// Chords detects the chord played in every bar of the song, based on the pitches sounding in the bar
+// weighted by velocity. Bars follow the time signature of the song (see BeatsPerBar). Only triads are
+// detected, so other chords are reported as the triad closest to them.
+func (s *Song) Chords() []BarChord {
+	ticksPerBar := s.BeatsPerBar() * ticksPerBeat
+	length := s.Length
+	for _, n := range s.Notes {
+		length = max(length, n.Tick)
+	}
+	bars := length/ticksPerBar + 1
+	chords := make([]BarChord, 0, bars)
+	for bar := 1; bar <= bars; bar++ {
+		from := s.TickAtBar(bar)
+		profile, total := pitchProfile(s.Notes, from, from+ticksPerBar)
+		bc := BarChord{Bar: bar}
+		if total > 0 {
+			bc.Chord, bc.Found = bestChord(profile), true
+		}
+		chords = append(chords, bc)
+	}
+	return chords
+}
+
+// bestChord returns the triad that fits the pitch profile passed best: the one whose notes sound the most,
+// minus the notes sounding outside of it. Ties go to the chord with the most weight on its root, then to
+// major and minor chords over diminished and augmented ones.
+func bestChord(profile [12]float64) Chord {
+	var total float64
+	for _, w := range profile {
+		total += w
+	}
+	best, bestScore := Chord{}, math.Inf(-1)
+	for _, quality := range []ChordQuality{Major, Minor, Diminished, Augmented} {
+		for root := range 12 {
+			var in float64
+			for _, interval := range chordIntervals[quality] {
+				in += profile[(root+interval)%12]
+			}
+			score := 2*in - total + profile[root]*0.1
+			if score > bestScore+1e-9 {
+				best, bestScore = Chord{Root: root, Quality: quality}, score
+			}
+		}
+	}
+	return best
+}
+
+// chordsPerLine is the number of bars shown on every line of the nbanalyze command.
+const chordsPerLine = 8
+
+// AnalyzeCmd is the command showing the key and the chords of every bar of a song.
+type AnalyzeCmd struct {
+	Filename string `cmd:"filename"`
+}
+
+// AllowConsole allows this command from the server console.
+func (AnalyzeCmd) AllowConsole() bool { return true }
+
+// Run loads the song in the background and prints its key and chords.
+func (c AnalyzeCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		key, confidence, ok := song.Key()
+		if !ok {
+			output.Printf("%s has no pitched notes to analyze", song.displayName())
+			return
+		}
+		output.Printf("§l%s§r: %s (%.0f%% match)", song.displayName(), key, max(confidence, 0)*100)
+		chords := song.Chords()
+		for i := 0; i < len(chords); i += chordsPerLine {
+			line := chords[i:min(len(chords), i+chordsPerLine)]
+			names := make([]string, len(line))
+			for j, bc := range line {
+				names[j] = "-"
+				if bc.Found {
+					names[j] = bc.Chord.String()
+				}
+			}
+			output.Printf("§7Bars %d-%d:§r %s", line[0].Bar, line[len(line)-1].Bar, strings.Join(names, " "))
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// historyLength is the number of songs kept in the play history of a player.
+const historyLength = 50
+
+// historyPageSize is the number of songs listed by the nbhistory command.
+const historyPageSize = 10
+
+// HistoryEntry is a song in the play history of a player.
+type HistoryEntry struct {
+	// Name is the name the song was played by, which plays it again when passed to PlayNoteblock.
+	Name string
+	// Title is the title of the song, or its name if it has none.
+	Title string
+	// Source is the source of the playback, see PlaybackOptions.Source.
+	Source string
+	// PlayedAt is when the song started playing.
+	PlayedAt time.Time
+}
+
+// histories holds the play histories of players by UUID, oldest song first, so that the history survives
+// rejoining. historiesMtx protects access to histories.
+var (
+	histories    = make(map[string][]HistoryEntry)
+	historiesMtx sync.Mutex
+)
+
+// recordHistory adds the song passed to the play history of the player. Songs that weren't loaded from a
+// file, such as recordings, can't be played again by name and are left out.
+func recordHistory(eh *world.EntityHandle, song *Song, opts PlaybackOptions) {
+	if song.name == "" {
+		return
+	}
+	id := eh.UUID().String()
+	historiesMtx.Lock()
+	defer historiesMtx.Unlock()
+	h := append(histories[id], HistoryEntry{Name: song.name, Title: song.displayName(), Source: opts.Source, PlayedAt: time.Now()})
+	if len(h) > historyLength {
+		h = slices.Clone(h[len(h)-historyLength:])
+	}
+	histories[id] = h
+}
+
+// History returns the songs recently played to the player, most recent first. At most the last 50 songs are
+// kept, and only while the server runs.
+//
+// Example usage:
+//
+//	for _, e := range noteblockplayer.History(p.H()) {
+//	    fmt.Printf("%s played at %s\n", e.Title, e.PlayedAt.Format(time.Kitchen))
+//	}
+func History(eh *world.EntityHandle) []HistoryEntry {
+	historiesMtx.Lock()
+	defer historiesMtx.Unlock()
+	h := slices.Clone(histories[eh.UUID().String()])
+	slices.Reverse(h)
+	return h
+}
+
+// LastPlayed returns the song most recently played to the player, if any.
+func LastPlayed(eh *world.EntityHandle) (HistoryEntry, bool) {
+	historiesMtx.Lock()
+	defer historiesMtx.Unlock()
+	h := histories[eh.UUID().String()]
+	if len(h) == 0 {
+		return HistoryEntry{}, false
+	}
+	return h[len(h)-1], true
+}
+
+// ClearHistory removes all songs from the play history of the player.
+func ClearHistory(eh *world.EntityHandle) {
+	historiesMtx.Lock()
+	defer historiesMtx.Unlock()
+	delete(histories, eh.UUID().String())
+}
+
+// lastSongName is the song name the playnoteblock command replaces with the name of the song played last.
+const lastSongName = "last"
+
+// HistoryCmd is the command listing the songs recently played to the player.
+type HistoryCmd struct{}
+
+// Run lists the most recent songs of the player's play history.
+func (HistoryCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbhistory command is only valid for players")
+		return
+	}
+	h := History(p.H())
+	if len(h) == 0 {
+		output.Print("You haven't played any songs yet")
+		return
+	}
+	output.Printf("Recently played (%d songs):", len(h))
+	for i, e := range h[:min(len(h), historyPageSize)] {
+		line := fmt.Sprintf("%d. §e%s§r", i+1, e.Name)
+		if e.Title != e.Name {
+			line += " §7- " + e.Title + "§r"
+		}
+		output.Printf("%s §8(%s ago)", line, formatAgo(time.Since(e.PlayedAt)))
+	}
+	output.Print("§7/pnb last plays the most recent song again")
+}
+
+// formatAgo formats how long ago something happened in the largest whole unit, for example "5m" or "2h".
+func formatAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// resolveLastSong returns the name of the song played last to the player if name is "last", and name
+// otherwise.
+func resolveLastSong(eh *world.EntityHandle, name string) (string, error) {
+	if !strings.EqualFold(name, lastSongName) {
+		return name, nil
+	}
+	e, ok := LastPlayed(eh)
+	if !ok {
+		return "", fmt.Errorf("%w: you haven't played any songs yet", ErrSongNotFound)
+	}
+	return e.Name, nil
+}
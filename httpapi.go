@@ -0,0 +1,235 @@
+package noteblockplayer
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxUploadSize is the maximum size of a song uploaded through the HTTP API.
+const maxUploadSize = 16 << 20
+
+// maxPackUploadSize is the maximum size of a song pack uploaded through the HTTP API.
+const maxPackUploadSize = 128 << 20
+
+// NewHTTPHandler returns an http.Handler serving a REST API to manage songs and playback, so server owners
+// can manage music without file access to the server:
+//
+//	GET    /songs                  lists the songs in the song folders
+//	PUT    /songs/{name}           uploads a song (the request body is the .nbs or .json file), add
+//	                               ?overwrite=true to replace an existing song
+//	PUT    /packs/{name}           uploads a song pack (the request body is the .zip file)
+//	POST   /players/{name}/play    plays a song to a player, the body is {"song": "my_song"}
+//	POST   /players/{name}/stop    stops the song playing for a player
+//
+// Every request must pass the token as bearer token in the Authorization header, the handler refuses
+// all requests if token is empty. lookup is used to find players by name. If a pack public key is set with
+// SetPackPublicKey, uploaded packs must pass their base64 encoded signature in the X-Signature header.
+//
+// Example usage:
+//
+//	http.Handle("/music/", http.StripPrefix("/music", noteblockplayer.NewHTTPHandler("secret", srv.PlayerByName)))
+func NewHTTPHandler(token string, lookup PlayerLookup) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /songs", handleListSongs)
+	mux.HandleFunc("PUT /songs/{name}", handleUploadSong)
+	mux.HandleFunc("PUT /packs/{name}", handleUploadPack)
+	mux.HandleFunc("POST /players/{name}/play", func(w http.ResponseWriter, r *http.Request) {
+		handlePlay(w, r, lookup)
+	})
+	mux.HandleFunc("POST /players/{name}/stop", func(w http.ResponseWriter, r *http.Request) {
+		handleStop(w, r, lookup)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || !validToken(r, token) {
+			writeHTTPError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as JSON response with the status code passed.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeHTTPError writes an error as JSON response with the status code passed.
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// handleListSongs lists the songs in the song folders.
+func handleListSongs(w http.ResponseWriter, r *http.Request) {
+	names, err := ListSongs()
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"songs": names})
+}
+
+// handleUploadSong stores the uploaded song in the first song folder after checking that it can be parsed.
+// Existing songs, matched ignoring case, are only replaced if the overwrite query parameter is true, and
+// refused with 409 Conflict otherwise.
+func handleUploadSong(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") || !isSongFile(name) {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("song name must be a .nbs or .json file name"))
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if err != nil {
+		writeHTTPError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if _, err := decodeSong(bufio.NewReader(bytes.NewReader(data)), filepath.Ext(name), parseOptions()); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid song file: %w", err))
+		return
+	}
+	dir := saveDir()
+	if r.URL.Query().Get("overwrite") == "true" {
+		if err := writeFileAtomic(filepath.Join(dir, name), data); err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"song": name})
+		return
+	}
+	if existing, found := findFileFold(dir, name); found {
+		writeHTTPError(w, http.StatusConflict, fmt.Errorf("%w: %q, pass overwrite=true to replace it", ErrSongExists, existing))
+		return
+	}
+	if err := createFile(filepath.Join(dir, name), data); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			writeHTTPError(w, http.StatusConflict, fmt.Errorf("%w: %q, pass overwrite=true to replace it", ErrSongExists, name))
+			return
+		}
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"song": name})
+}
+
+// createFile writes the data passed to a new file at the path passed. An error wrapping fs.ErrExist is
+// returned if the file already exists, and a file that could not be written completely is removed again.
+func createFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+// handleUploadPack stores the uploaded song pack in the first song folder after checking that it is a valid
+// zip file and, if a pack public key is set, that its signature is valid. The signature is stored next to the
+// pack, so that it is verified again whenever the pack is loaded.
+func handleUploadPack(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") || !strings.EqualFold(filepath.Ext(name), ".zip") {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("pack name must be a .zip file name"))
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPackUploadSize))
+	if err != nil {
+		writeHTTPError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	sig := []byte(r.Header.Get("X-Signature"))
+	if packPublicKey() != nil {
+		if err := VerifyPack(data, sig); err != nil {
+			writeHTTPError(w, http.StatusForbidden, err)
+			return
+		}
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err == nil {
+		_, err = readPackManifest(strings.TrimSuffix(name, filepath.Ext(name)), zr)
+	}
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid pack file: %w", err))
+		return
+	}
+	// The pack is written before its signature, so a pack that failed to be written never gets the signature of
+	// the new pack. Until the signature is written, the new pack fails verification instead.
+	p := filepath.Join(saveDir(), name)
+	if err := writeFileAtomic(p, data); err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(sig) > 0 {
+		if err := writeFileAtomic(p+packSignatureExt, sig); err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+	} else {
+		// A signature of a pack replaced by this upload no longer matches it.
+		_ = os.Remove(p + packSignatureExt)
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"pack": name})
+}
+
+// handlePlay plays a song to a player.
+func handlePlay(w http.ResponseWriter, r *http.Request, lookup PlayerLookup) {
+	eh, ok := lookup(r.PathValue("name"))
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("player is not online"))
+		return
+	}
+	var body struct {
+		Song string `json:"song"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Song == "" {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("request body must be {\"song\": \"name\"}"))
+		return
+	}
+	if err := PlayNoteblockWithOptions(eh, body.Song, PlaybackOptions{Source: "http"}); err != nil {
+		writeHTTPError(w, playErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"playing": body.Song})
+}
+
+// playErrorStatus returns the HTTP status code for an error returned by PlayNoteblockWithOptions.
+func playErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrSongNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidName):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAlreadyPlaying):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnsupportedFormat), errors.Is(err, ErrCorruptNBS):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleStop stops the song playing for a player.
+func handleStop(w http.ResponseWriter, r *http.Request, lookup PlayerLookup) {
+	eh, ok := lookup(r.PathValue("name"))
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("player is not online"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"stopped": StopNoteblock(eh)})
+}
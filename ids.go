@@ -0,0 +1,76 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// songIDPrefix is put in front of song IDs wherever a song name is accepted, to tell them apart from names.
+const songIDPrefix = "#"
+
+// songIDLength is the number of hex characters of a song hash used as the ID of the song.
+const songIDLength = 8
+
+// songID returns the ID of the song with the content hash passed.
+func songID(hash string) string {
+	return hash[:min(len(hash), songIDLength)]
+}
+
+// SongID returns the ID of the song with the name passed, which can be passed with a "#" in front of it
+// wherever a song name is accepted. IDs are computed from the content of the song, so they keep referring
+// to the song when its file is renamed or moved to another song folder, which makes them suited for
+// playlists and saved queues.
+//
+// Example usage:
+//
+//	id, err := noteblockplayer.SongID("megalovania.nbs")
+//	if err != nil {
+//	    // handle error
+//	}
+//	_ = noteblockplayer.QueueNoteblock(p.H(), "#"+id)
+func SongID(name string) (string, error) {
+	lib, err := hashLibrary()
+	if err != nil {
+		return "", err
+	}
+	for _, s := range lib.Songs {
+		if songNameKey(s.Name) == songNameKey(name) {
+			return s.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrSongNotFound, name)
+}
+
+// ByID returns the song with the ID passed from the library, which may also be the start of an ID or of
+// a Hash. Of songs stored more than once, the first one by name is returned.
+func (l *Library) ByID(id string) (LibrarySong, bool) {
+	id = strings.ToLower(strings.TrimPrefix(id, songIDPrefix))
+	if id == "" {
+		return LibrarySong{}, false
+	}
+	for _, s := range l.Songs {
+		if strings.HasPrefix(s.Hash, id) {
+			return s, true
+		}
+	}
+	return LibrarySong{}, false
+}
+
+// resolveSongID returns the name of the song with the ID passed, without the "#" in front of it. Only the
+// songs in the song folders and song packs are searched, not the song folders of worlds.
+func resolveSongID(id string) (string, error) {
+	lib, err := hashLibrary()
+	if err != nil {
+		return "", err
+	}
+	s, ok := lib.ByID(id)
+	if !ok {
+		return "", fmt.Errorf("%w: no song with ID %s%s", ErrSongNotFound, songIDPrefix, id)
+	}
+	for _, other := range lib.Songs {
+		if strings.HasPrefix(other.Hash, strings.ToLower(id)) && other.Hash != s.Hash {
+			return "", fmt.Errorf("%w: ID %s%s matches multiple songs", ErrSongNotFound, songIDPrefix, id)
+		}
+	}
+	return s.Name, nil
+}
@@ -0,0 +1,348 @@
+package noteblockplayer
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// LibrarySong is a song in the Library.
+type LibrarySong struct {
+	// Name is the name of the song as returned by ListSongs.
+	Name string
+	// Title and Author are the title and author stored in the song, if any. Author includes the author of
+	// the original song for covers.
+	Title, Author string
+	// Size is the size of the song file in bytes.
+	Size int64
+	// Hash is the hex encoded SHA-256 hash of the content of the song file.
+	Hash string
+	// ID is the short ID of the song, the start of its Hash. The ID doesn't change when the song file is
+	// renamed, and can be passed instead of the name with a "#" in front of it, like "#1a2b3c4d".
+	ID string
+	// Duplicates are the names of the other songs in the library with the same content, sorted by name.
+	Duplicates []string
+}
+
+// Library is an index of all songs in the song folders and song packs, created with IndexLibrary.
+type Library struct {
+	// Songs are all songs in the library, sorted by name.
+	Songs []LibrarySong
+}
+
+// hashEntry is the content hash of a song file, valid as long as the file doesn't change.
+type hashEntry struct {
+	hash    string
+	modTime time.Time
+	size    int64
+}
+
+// songHashes holds the content hashes of song files computed so far, by path, or by pack path and file in
+// the pack for songs in packs. songHashesMtx protects access to songHashes.
+var (
+	songHashes    = make(map[string]hashEntry)
+	songHashesMtx sync.Mutex
+)
+
+// cachedHash returns the hash with the key passed, computing it with hash if it is not known yet or the
+// file described by info changed since.
+func cachedHash(key string, info fs.FileInfo, hash func() (string, error)) (string, error) {
+	songHashesMtx.Lock()
+	e, ok := songHashes[key]
+	songHashesMtx.Unlock()
+	if ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.hash, nil
+	}
+	h, err := hash()
+	if err != nil {
+		return "", err
+	}
+	songHashesMtx.Lock()
+	songHashes[key] = hashEntry{hash: h, modTime: info.ModTime(), size: info.Size()}
+	songHashesMtx.Unlock()
+	return h, nil
+}
+
+// hashReader returns the hex encoded SHA-256 hash of everything read from r.
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// IndexLibrary indexes all songs in the song folders and song packs, the same songs listed by ListSongs,
+// and hashes their content to find songs stored more than once under different names. Every song is loaded
+// to read its title and author. Hashes and songs are kept until a file changes, so indexing again is cheap.
+//
+// Example usage:
+//
+//	lib, err := noteblockplayer.IndexLibrary()
+//	if err != nil {
+//	    // handle error
+//	}
+//	for _, names := range lib.DuplicateGroups() {
+//	    log.Printf("duplicate songs: %v", names)
+//	}
+func IndexLibrary() (*Library, error) {
+	lib, err := hashLibrary()
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range lib.Songs {
+		// Songs that fail to load are still listed, only without their title.
+		if song, err := flexSongLoader(s.Name); err == nil {
+			lib.Songs[i].Title, lib.Songs[i].Author = song.Title, song.credits()
+		}
+	}
+
+	byHash := make(map[string][]string)
+	for _, s := range lib.Songs {
+		byHash[s.Hash] = append(byHash[s.Hash], s.Name)
+	}
+	for i, s := range lib.Songs {
+		for _, name := range byHash[s.Hash] {
+			if name != s.Name {
+				lib.Songs[i].Duplicates = append(lib.Songs[i].Duplicates, name)
+			}
+		}
+	}
+	return lib, nil
+}
+
+// hashLibrary lists and hashes all songs in the song folders and song packs, sorted by name, without
+// loading them.
+func hashLibrary() (*Library, error) {
+	lib := &Library{}
+	seen := make(map[string]bool)
+	for i, dir := range searchDirs(nil) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Folders configured in addition to the first one may not exist yet.
+			if i > 0 && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || !isSongFile(e.Name()) || seen[e.Name()] {
+				continue
+			}
+			seen[e.Name()] = true
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			p := filepath.Join(dir, e.Name())
+			h, err := cachedHash(p, info, func() (string, error) {
+				f, err := os.Open(p)
+				if err != nil {
+					return "", err
+				}
+				defer f.Close()
+				return hashReader(f)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", e.Name(), err)
+			}
+			lib.Songs = append(lib.Songs, LibrarySong{Name: e.Name(), Size: info.Size(), Hash: h, ID: songID(h)})
+		}
+	}
+	packs, err := ListPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range packs {
+		songs, err := indexPack(m)
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: %w", m.Name, err)
+		}
+		lib.Songs = append(lib.Songs, songs...)
+	}
+	sort.Slice(lib.Songs, func(i, j int) bool { return lib.Songs[i].Name < lib.Songs[j].Name })
+	return lib, nil
+}
+
+// indexPack hashes the songs in the pack with the manifest passed.
+func indexPack(m *PackManifest) ([]LibrarySong, error) {
+	p, info, err := findPack(m.Name, nil)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	songs := make([]LibrarySong, 0, len(m.Songs))
+	for _, s := range m.Songs {
+		var size int64
+		h, err := cachedHash(p+":"+s.File, info, func() (string, error) {
+			f, err := zr.Open(s.File)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			return hashReader(f)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.File, err)
+		}
+		if fi, err := fs.Stat(zr, s.File); err == nil {
+			size = fi.Size()
+		}
+		songs = append(songs, LibrarySong{Name: m.Name + ":" + s.Name + path.Ext(s.File), Size: size, Hash: h, ID: songID(h)})
+	}
+	return songs, nil
+}
+
+// Song returns the song with the name passed from the library.
+func (l *Library) Song(name string) (LibrarySong, bool) {
+	for _, s := range l.Songs {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return LibrarySong{}, false
+}
+
+// Unique returns the songs in the library with duplicates merged: of all songs with the same content, only
+// the first one by name is returned, with the names of the others in its Duplicates.
+func (l *Library) Unique() []LibrarySong {
+	seen := make(map[string]bool)
+	unique := make([]LibrarySong, 0, len(l.Songs))
+	for _, s := range l.Songs {
+		if seen[s.Hash] {
+			continue
+		}
+		seen[s.Hash] = true
+		unique = append(unique, s)
+	}
+	return unique
+}
+
+// DuplicateGroups returns the names of the songs stored more than once, grouped by content. Each group is
+// sorted by name, and the groups are sorted by their first name.
+func (l *Library) DuplicateGroups() [][]string {
+	var groups [][]string
+	for _, s := range l.Unique() {
+		if len(s.Duplicates) > 0 {
+			groups = append(groups, append([]string{s.Name}, s.Duplicates...))
+		}
+	}
+	return groups
+}
+
+// listPageSize is the number of songs listed on one page of the listnb command.
+const listPageSize = 10
+
+// ListCmd is the command listing the songs in the library, with songs stored under multiple names merged.
+// Every line shows the command playing the song, and long lists are split into pages. Bedrock chat has no
+// clickable text, so the commands are shown to be typed instead.
+type ListCmd struct {
+	Page cmd.Optional[int] `cmd:"page"`
+}
+
+// AllowConsole allows this command from the server console.
+func (ListCmd) AllowConsole() bool { return true }
+
+// Run lists a page of the songs in the library.
+func (c ListCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	runLibraryCmd(src, output, func(lib *Library) []string {
+		unique := lib.Unique()
+		pages := max(1, (len(unique)+listPageSize-1)/listPageSize)
+		page := min(max(c.Page.LoadOr(1), 1), pages)
+		lines := []string{fmt.Sprintf("%d songs (page %d of %d):", len(unique), page, pages)}
+		for _, s := range unique[(page-1)*listPageSize : min(len(unique), page*listPageSize)] {
+			line := "§e/pnb " + s.Name + "§r §8" + songIDPrefix + s.ID + "§r"
+			if s.Title != "" {
+				line += " §7- " + s.Title
+				if s.Author != "" {
+					line += " by " + s.Author
+				}
+				line += "§r"
+			}
+			if len(s.Duplicates) > 0 {
+				line += " §7(also " + strings.Join(s.Duplicates, ", ") + ")"
+			}
+			lines = append(lines, line)
+		}
+		var nav []string
+		if page > 1 {
+			nav = append(nav, fmt.Sprintf("§e/listnb %d§7 for the previous page", page-1))
+		}
+		if page < pages {
+			nav = append(nav, fmt.Sprintf("§e/listnb %d§7 for the next page", page+1))
+		}
+		if len(nav) > 0 {
+			lines = append(lines, "§7"+strings.Join(nav, ", "))
+		}
+		return lines
+	})
+}
+
+// ListDuplicatesCmd is the command listing the songs stored more than once under different names.
+type ListDuplicatesCmd struct {
+	Duplicates cmd.SubCommand `cmd:"duplicates"`
+}
+
+// AllowConsole allows this command from the server console.
+func (ListDuplicatesCmd) AllowConsole() bool { return true }
+
+// Run lists the groups of duplicate songs.
+func (c ListDuplicatesCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	runLibraryCmd(src, output, func(lib *Library) []string {
+		groups := lib.DuplicateGroups()
+		if len(groups) == 0 {
+			return []string{"No duplicate songs found"}
+		}
+		lines := []string{fmt.Sprintf("%d songs are stored more than once:", len(groups))}
+		for _, g := range groups {
+			lines = append(lines, strings.Join(g, " = "))
+		}
+		return lines
+	})
+}
+
+// runLibraryCmd indexes the library and prints the lines returned by f. For players, the library is indexed
+// in the background, as hashing a big library for the first time takes a while.
+func runLibraryCmd(src cmd.Source, output *cmd.Output, f func(lib *Library) []string) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		lib, err := IndexLibrary()
+		if err != nil {
+			output.Errorf("Failed to index songs: %v", err)
+			return
+		}
+		for _, line := range f(lib) {
+			output.Print(line)
+		}
+		return
+	}
+	eh := p.H()
+	go func() {
+		lib, err := IndexLibrary()
+		if err != nil {
+			messagePlayer(eh, fmt.Sprintf("§cFailed to index songs: %v", err))
+			return
+		}
+		messagePlayer(eh, strings.Join(f(lib), "\n"))
+	}()
+}
@@ -0,0 +1,198 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// layerFilter holds the muted and soloed layers of a playback. If any layer is soloed, only soloed
+// layers are played, otherwise all layers except the muted ones are.
+type layerFilter struct {
+	mu     sync.Mutex
+	muted  map[int]struct{}
+	soloed map[int]struct{}
+}
+
+// newLayerFilter returns a layerFilter with the layers passed muted and soloed.
+func newLayerFilter(muted, soloed []int) *layerFilter {
+	f := &layerFilter{muted: make(map[int]struct{}), soloed: make(map[int]struct{})}
+	for _, l := range muted {
+		f.muted[l] = struct{}{}
+	}
+	for _, l := range soloed {
+		f.soloed[l] = struct{}{}
+	}
+	return f
+}
+
+// allows reports whether notes on the layer passed should be played.
+func (f *layerFilter) allows(layer int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.soloed) > 0 {
+		_, ok := f.soloed[layer]
+		return ok
+	}
+	_, muted := f.muted[layer]
+	return !muted
+}
+
+// set adds the layer to or removes it from one of the layer sets.
+func (f *layerFilter) set(set map[int]struct{}, layer int, enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if enabled {
+		set[layer] = struct{}{}
+	} else {
+		delete(set, layer)
+	}
+}
+
+// reset unmutes and unsolos all layers.
+func (f *layerFilter) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clear(f.muted)
+	clear(f.soloed)
+}
+
+// currentPlayback returns the playback currently running for the player on the music channel.
+func currentPlayback(eh *world.EntityHandle) (*playback, bool) {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	pb, ok := playbacks[musicKey(eh)]
+	return pb, ok
+}
+
+// MuteLayer mutes (or unmutes) a layer of the song currently playing for the player.
+// Returns true if a song was playing.
+func MuteLayer(eh *world.EntityHandle, layer int, mute bool) bool {
+	pb, ok := currentPlayback(eh)
+	if ok {
+		pb.layers.set(pb.layers.muted, layer, mute)
+	}
+	return ok
+}
+
+// SoloLayer solos (or unsolos) a layer of the song currently playing for the player. While any layer
+// is soloed, only the soloed layers are played. Returns true if a song was playing.
+func SoloLayer(eh *world.EntityHandle, layer int, solo bool) bool {
+	pb, ok := currentPlayback(eh)
+	if ok {
+		pb.layers.set(pb.layers.soloed, layer, solo)
+	}
+	return ok
+}
+
+// ResetLayers unmutes and unsolos all layers of the song currently playing for the player.
+// Returns true if a song was playing.
+func ResetLayers(eh *world.EntityHandle) bool {
+	pb, ok := currentPlayback(eh)
+	if ok {
+		pb.layers.reset()
+	}
+	return ok
+}
+
+// layerAction is the action of the nblayer command.
+type layerAction string
+
+// Type returns the name of the enum.
+func (layerAction) Type() string { return "LayerAction" }
+
+// Options returns all layer actions.
+func (layerAction) Options(cmd.Source) []string {
+	return []string{"mute", "unmute", "solo", "unsolo"}
+}
+
+// LayerCmd is the command to mute or solo a layer of the song currently playing.
+type LayerCmd struct {
+	Action layerAction `cmd:"action"`
+	Layer  int         `cmd:"layer"`
+}
+
+// Run applies the action to the layer of the player's current song.
+func (c LayerCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nblayer command is only valid for players")
+		return
+	}
+	switch c.Action {
+	case "mute":
+		ok = MuteLayer(p.H(), c.Layer, true)
+	case "unmute":
+		ok = MuteLayer(p.H(), c.Layer, false)
+	case "solo":
+		ok = SoloLayer(p.H(), c.Layer, true)
+	case "unsolo":
+		ok = SoloLayer(p.H(), c.Layer, false)
+	}
+	if !ok {
+		output.Error("No song is currently playing")
+		return
+	}
+	output.Printf("Layer %d: %s", c.Layer, c.Action)
+}
+
+// LayerResetCmd is the command to unmute and unsolo all layers of the song currently playing.
+type LayerResetCmd struct {
+	Reset cmd.SubCommand `cmd:"reset"`
+}
+
+// Run resets the layers of the player's current song.
+func (c LayerResetCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nblayer command is only valid for players")
+		return
+	}
+	if !ResetLayers(p.H()) {
+		output.Error("No song is currently playing")
+		return
+	}
+	output.Print("All layers are playing again")
+}
+
+// LayerPlayCmd is the command to play only a single layer of a song, to learn or practise that part.
+type LayerPlayCmd struct {
+	Play     cmd.SubCommand `cmd:"play"`
+	Filename string         `cmd:"filename"`
+	Layer    int            `cmd:"layer"`
+}
+
+// Run loads the song and plays the layer passed to the player.
+func (c LayerPlayCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nblayer command is only valid for players")
+		return
+	}
+	if !checkCooldown(src, output, "playnoteblock") {
+		return
+	}
+	eh, tw := p.H(), w.World()
+	go func() {
+		song, err := loadSongWithProgress(eh, tw, c.Filename)
+		if err != nil {
+			messagePlayer(eh, fmt.Sprintf("§cFailed to load file: %v", err))
+			return
+		}
+		part := song.ExtractLayers(c.Layer)
+		if len(part.Notes) == 0 {
+			messagePlayer(eh, fmt.Sprintf("§cLayer %d of %s has no notes", c.Layer, song.displayName()))
+			return
+		}
+		if err := checkRequestHandle(eh, part, false); err != nil {
+			messagePlayer(eh, fmt.Sprintf("§cCould not play %s: %v", song.displayName(), err))
+			return
+		}
+		startCooldown(eh, "playnoteblock")
+		messagePlayer(eh, fmt.Sprintf("Playing layer %d of %s", c.Layer, song.displayName()))
+		playSong(eh, part, PlaybackOptions{Source: "command"})
+	}()
+}
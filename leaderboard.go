@@ -0,0 +1,172 @@
+package noteblockplayer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// PlayCountStore persists the number of times every song was played on the server.
+type PlayCountStore interface {
+	// Load returns the play counts of all songs by song name.
+	Load() (map[string]int, error)
+	// Save stores the play counts of all songs.
+	Save(counts map[string]int) error
+}
+
+// FilePlayCountStore is a PlayCountStore keeping the play counts in a JSON file.
+type FilePlayCountStore struct {
+	path string
+}
+
+// NewFilePlayCountStore returns a FilePlayCountStore reading from and writing to the JSON file at the path
+// passed. A file that does not exist yet is created on the first save.
+func NewFilePlayCountStore(path string) *FilePlayCountStore {
+	return &FilePlayCountStore{path: path}
+}
+
+// Load reads the play counts from the file. A file that does not exist yet holds no play counts.
+func (s *FilePlayCountStore) Load() (map[string]int, error) {
+	counts := make(map[string]int)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return counts, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// Save writes the play counts to the file.
+func (s *FilePlayCountStore) Save(counts map[string]int) error {
+	return writeJSONFile(s.path, counts)
+}
+
+// playCounts holds the number of times every song was played by the key returned by songNameKey, and
+// playCountStore the store set with SetPlayCountStore. playCountsMtx protects access to both.
+var (
+	playCounts     = make(map[string]int)
+	playCountStore PlayCountStore
+	playCountsMtx  sync.Mutex
+)
+
+// SetPlayCountStore sets the store that play counts are loaded from and saved to, and loads the play counts
+// stored in it, replacing those counted so far. Without a store, play counts are only kept in memory until
+// the server stops.
+//
+// Example usage:
+//
+//	if err := noteblockplayer.SetPlayCountStore(noteblockplayer.NewFilePlayCountStore("noteblock_plays.json")); err != nil {
+//	    // handle error
+//	}
+func SetPlayCountStore(s PlayCountStore) error {
+	counts := make(map[string]int)
+	if s != nil {
+		loaded, err := s.Load()
+		if err != nil {
+			return err
+		}
+		maps.Copy(counts, loaded)
+	}
+	playCountsMtx.Lock()
+	defer playCountsMtx.Unlock()
+	playCountStore, playCounts = s, counts
+	return nil
+}
+
+// countPlay counts a play of the song passed and saves the play counts to the store, if one is set. Songs
+// that weren't loaded from a file, such as recordings, are not counted.
+func countPlay(song *Song) error {
+	if song.name == "" {
+		return nil
+	}
+	playCountsMtx.Lock()
+	defer playCountsMtx.Unlock()
+	playCounts[songNameKey(song.name)]++
+	if playCountStore != nil {
+		return playCountStore.Save(maps.Clone(playCounts))
+	}
+	return nil
+}
+
+// SongPlays is the number of times a song was played, as returned by TopSongs.
+type SongPlays struct {
+	// Name is the name of the song, in lower case and without extension.
+	Name string
+	// Plays is the number of times the song was played.
+	Plays int
+}
+
+// PlayCount returns the number of times the song with the name passed was played on the server. Names are
+// compared without case and extension.
+func PlayCount(name string) int {
+	playCountsMtx.Lock()
+	defer playCountsMtx.Unlock()
+	return playCounts[songNameKey(name)]
+}
+
+// TopSongs returns the n songs played most often on the server, most played first. Songs played equally
+// often are sorted by name.
+//
+// Example usage:
+//
+//	for i, s := range noteblockplayer.TopSongs(3) {
+//	    fmt.Printf("%d. %s (%d plays)\n", i+1, s.Name, s.Plays)
+//	}
+func TopSongs(n int) []SongPlays {
+	playCountsMtx.Lock()
+	top := make([]SongPlays, 0, len(playCounts))
+	for name, plays := range playCounts {
+		top = append(top, SongPlays{Name: name, Plays: plays})
+	}
+	playCountsMtx.Unlock()
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Plays != top[j].Plays {
+			return top[i].Plays > top[j].Plays
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top[:min(len(top), max(n, 0))]
+}
+
+// topSongsCount is the number of songs listed by the nbtop command if no count is passed.
+const topSongsCount = 10
+
+// TopCmd is the command listing the songs played most often on the server.
+type TopCmd struct {
+	Count cmd.Optional[int] `cmd:"count"`
+}
+
+// AllowConsole allows this command from the server console.
+func (TopCmd) AllowConsole() bool { return true }
+
+// Run lists the most played songs.
+func (c TopCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	top := TopSongs(c.Count.LoadOr(topSongsCount))
+	if len(top) == 0 {
+		output.Print("No songs have been played yet")
+		return
+	}
+	output.Print("Most played songs:")
+	for i, s := range top {
+		output.Printf("%d. §e%s§r §7(%s)", i+1, s.Name, pluralPlays(s.Plays))
+	}
+}
+
+// pluralPlays formats a number of plays, for example "1 play" or "5 plays".
+func pluralPlays(n int) string {
+	if n == 1 {
+		return "1 play"
+	}
+	return fmt.Sprintf("%d plays", n)
+}
@@ -0,0 +1,169 @@
+package noteblockplayer
+
+import (
+	"errors"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// defaultSongDir is the folder, relative to the working directory, that songs are loaded from and saved to
+// unless other folders are set with SetSongDirs.
+const defaultSongDir = "noteblock"
+
+// songDirs holds the folders searched for songs, in order, and worldSongDirs the folders searched first for
+// players in a specific world. songDirsMtx protects access to both.
+var (
+	songDirs      = []string{defaultSongDir}
+	worldSongDirs = make(map[*world.World][]string)
+	songDirsMtx   sync.RWMutex
+)
+
+// SetSongDirs sets the folders songs are searched in, in order, so the first folder holding a song with a
+// name wins. Recordings and uploaded songs are saved to the first folder. Passing no folders restores the
+// default "noteblock" folder.
+//
+// Example usage:
+//
+//	noteblockplayer.SetSongDirs("/srv/music/custom", "/srv/music/shared")
+func SetSongDirs(dirs ...string) {
+	songDirsMtx.Lock()
+	defer songDirsMtx.Unlock()
+	if len(dirs) == 0 {
+		dirs = []string{defaultSongDir}
+	}
+	songDirs = slices.Clone(dirs)
+}
+
+// SetWorldSongDirs sets folders that are searched for songs before the folders set with SetSongDirs when a
+// player in the world passed plays a song with a command. Passing no folders removes the folders of the
+// world.
+func SetWorldSongDirs(w *world.World, dirs ...string) {
+	songDirsMtx.Lock()
+	defer songDirsMtx.Unlock()
+	if len(dirs) == 0 {
+		delete(worldSongDirs, w)
+		return
+	}
+	worldSongDirs[w] = slices.Clone(dirs)
+}
+
+// searchDirs returns the folders searched for songs, in order, for a player in the world passed, which may
+// be nil.
+func searchDirs(w *world.World) []string {
+	songDirsMtx.RLock()
+	defer songDirsMtx.RUnlock()
+	return append(slices.Clone(worldSongDirs[w]), songDirs...)
+}
+
+// saveDir returns the folder new songs are saved to.
+func saveDir() string {
+	songDirsMtx.RLock()
+	defer songDirsMtx.RUnlock()
+	return songDirs[0]
+}
+
+// isSongFile reports whether the file name has one of the supported song extensions. JSON lyrics and marker
+// files (".lyrics.json" and ".markers.json") are not songs.
+func isSongFile(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".lyrics.json") || strings.HasSuffix(lower, ".markers.json") {
+		return false
+	}
+	return strings.HasSuffix(lower, ".nbs") || strings.HasSuffix(lower, ".json")
+}
+
+// ListSongs returns the file names of all songs (.nbs and .json files) in the song folders, sorted by name.
+// If multiple folders hold a song with the same file name, it is listed once. Songs in song packs are
+// listed as "pack:song" followed by the extension of the song file.
+func ListSongs() ([]string, error) {
+	var names []string
+	for i, dir := range searchDirs(nil) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Folders configured in addition to the first one may not exist yet.
+			if i > 0 && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() && isSongFile(e.Name()) && !slices.Contains(names, e.Name()) {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	// Songs in packs are listed as "pack:song".
+	packs, err := ListPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		for _, s := range p.Songs {
+			names = append(names, p.Name+":"+s.Name+path.Ext(s.File))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// songTags holds the names of the songs with a tag by tag.
+// songTagsMtx protects access to songTags.
+var (
+	songTags    = make(map[string][]string)
+	songTagsMtx sync.RWMutex
+)
+
+// TagSongs adds the tag to the songs with the names passed, so they can be picked by tag, for example by an
+// AmbientScheduler. Tags are case-insensitive.
+//
+// Example usage:
+//
+//	noteblockplayer.TagSongs("calm", "sweden", "wet_hands", "mice_on_venus")
+func TagSongs(tag string, names ...string) {
+	tag = strings.ToLower(tag)
+	songTagsMtx.Lock()
+	defer songTagsMtx.Unlock()
+	for _, name := range names {
+		if !slices.Contains(songTags[tag], name) {
+			songTags[tag] = append(songTags[tag], name)
+		}
+	}
+}
+
+// UntagSongs removes the tag from the songs with the names passed.
+func UntagSongs(tag string, names ...string) {
+	tag = strings.ToLower(tag)
+	songTagsMtx.Lock()
+	defer songTagsMtx.Unlock()
+	songTags[tag] = slices.DeleteFunc(songTags[tag], func(name string) bool {
+		return slices.Contains(names, name)
+	})
+	if len(songTags[tag]) == 0 {
+		delete(songTags, tag)
+	}
+}
+
+// Tags returns all tags added with TagSongs, sorted.
+func Tags() []string {
+	songTagsMtx.RLock()
+	defer songTagsMtx.RUnlock()
+	tags := make([]string, 0, len(songTags))
+	for tag := range songTags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// SongsWithTag returns the names of the songs with the tag passed.
+func SongsWithTag(tag string) []string {
+	songTagsMtx.RLock()
+	defer songTagsMtx.RUnlock()
+	return slices.Clone(songTags[strings.ToLower(tag)])
+}
@@ -0,0 +1,150 @@
+package noteblockplayer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/player"
+)
+
+// LyricLine is a line of the lyrics of a song, shown when the tick it belongs to is played.
+type LyricLine struct {
+	Tick int    `json:"tick"`
+	Text string `json:"text"`
+}
+
+// LyricsMode decides where the lyrics of a song are shown while it is playing.
+type LyricsMode int
+
+const (
+	// LyricsOff doesn't show lyrics. This is the default.
+	LyricsOff LyricsMode = iota
+	// LyricsChat sends every lyric line as a chat message.
+	LyricsChat
+	// LyricsActionBar shows every lyric line above the hotbar.
+	LyricsActionBar
+)
+
+// lrcTimestamp matches a single [mm:ss.xx] timestamp of an LRC file.
+var lrcTimestamp = regexp.MustCompile(`^\[(\d+):(\d+(?:\.\d+)?)\]`)
+
+// lrcOffset matches the [offset:±ms] tag of an LRC file.
+var lrcOffset = regexp.MustCompile(`^\[offset:\s*([+-]?\d+)\]`)
+
+// ParseLRC parses lyrics in the LRC format, where every line starts with one or more [mm:ss.xx] timestamps,
+// and converts the timestamps to ticks of a song with the tempo (ticks per second) passed. Metadata tags
+// are ignored, except for [offset:ms], which shifts all lines. The lines returned are sorted by tick.
+func ParseLRC(r io.Reader, tempo float64) ([]LyricLine, error) {
+	return parseLRC(r, newTempoCurve(&Song{Tempo: tempo}, PlaybackOptions{}))
+}
+
+// parseLRC parses lyrics in the LRC format like ParseLRC, converting the timestamps to ticks with the tempo
+// curve passed.
+func parseLRC(r io.Reader, tempo tempoCurve) ([]LyricLine, error) {
+	// timedLine is a line along with the time of one of its timestamps, which is converted to a tick once the
+	// offset is known.
+	type timedLine struct {
+		text string
+		at   time.Duration
+	}
+	var (
+		timed  []timedLine
+		offset time.Duration
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := lrcOffset.FindStringSubmatch(line); m != nil {
+			ms, _ := strconv.Atoi(m[1])
+			offset = time.Duration(ms) * time.Millisecond
+			continue
+		}
+		var times []time.Duration
+		for {
+			m := lrcTimestamp.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			minutes, _ := strconv.Atoi(m[1])
+			secs, _ := strconv.ParseFloat(m[2], 64)
+			times = append(times, secondsDuration(float64(minutes*60)+secs))
+			line = line[len(m[0]):]
+		}
+		text := strings.TrimSpace(line)
+		for _, at := range times {
+			timed = append(timed, timedLine{text: text, at: at})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read lyrics: %w", err)
+	}
+	// The LRC offset is applied after parsing, as it may appear anywhere in the file. A positive offset makes
+	// the lines appear sooner.
+	lines := make([]LyricLine, len(timed))
+	for i, l := range timed {
+		lines[i] = LyricLine{Text: l.text, Tick: tempo.tickAt(l.at - offset)}
+	}
+	slices.SortStableFunc(lines, func(a, b LyricLine) int { return a.Tick - b.Tick })
+	return lines, nil
+}
+
+// loadLyrics loads the sidecar lyrics of the song file with the path (without extension) in fsys passed, if
+// the song has none of its own. Lyrics are read from "<path>.lrc", or from "<path>.lyrics.json" holding a
+// JSON array of LyricLine. A song without lyrics files is left unchanged.
+func loadLyrics(fsys fs.FS, path string, song *Song) error {
+	if len(song.Lyrics) > 0 {
+		return nil
+	}
+	if f, err := fsys.Open(path + ".lrc"); err == nil {
+		defer f.Close()
+		lines, err := parseLRC(f, newTempoCurve(song, PlaybackOptions{}))
+		if err != nil {
+			return err
+		}
+		song.Lyrics = lines
+		return nil
+	}
+	data, err := fs.ReadFile(fsys, path+".lyrics.json")
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &song.Lyrics); err != nil {
+		return fmt.Errorf("decode lyrics: %w", err)
+	}
+	return nil
+}
+
+// lyricsSchedule groups the lyrics of the song by the tick they are shown at. Lines on the same tick are
+// joined.
+func lyricsSchedule(song *Song) map[int]string {
+	lines := make(map[int]string, len(song.Lyrics))
+	for _, l := range song.Lyrics {
+		if prev, ok := lines[l.Tick]; ok {
+			lines[l.Tick] = prev + "\n" + l.Text
+			continue
+		}
+		lines[l.Tick] = l.Text
+	}
+	return lines
+}
+
+// showLyric shows the lyric line to the player, the way the LyricsMode decides.
+func showLyric(pp *player.Player, mode LyricsMode, text string) {
+	if text == "" {
+		return
+	}
+	switch mode {
+	case LyricsChat:
+		pp.Message("§o♪ " + text)
+	case LyricsActionBar:
+		pp.SendTip(text)
+	}
+}
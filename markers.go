@@ -0,0 +1,105 @@
+package noteblockplayer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// Marker is a named position in a song, such as the start of a verse, chorus or drop.
+type Marker struct {
+	Tick int    `json:"tick"`
+	Name string `json:"name"`
+}
+
+// loadMarkers loads the sidecar markers of the song file with the path (without extension) in fsys passed, if
+// the song has none of its own. Markers are read from "<path>.markers.json" holding a JSON array of Marker.
+// A song without a markers file is left unchanged.
+func loadMarkers(fsys fs.FS, path string, song *Song) error {
+	if len(song.Markers) > 0 {
+		return nil
+	}
+	data, err := fs.ReadFile(fsys, path+".markers.json")
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &song.Markers); err != nil {
+		return fmt.Errorf("decode markers: %w", err)
+	}
+	slices.SortStableFunc(song.Markers, func(a, b Marker) int { return a.Tick - b.Tick })
+	return nil
+}
+
+// Marker returns the first marker of the song with the name passed. Names are matched case-insensitively.
+func (s *Song) Marker(name string) (Marker, bool) {
+	for _, m := range s.Markers {
+		if strings.EqualFold(m.Name, name) {
+			return m, true
+		}
+	}
+	return Marker{}, false
+}
+
+// markerSchedule groups the names of the markers of the song by their tick.
+func markerSchedule(song *Song) map[int][]string {
+	markers := make(map[int][]string, len(song.Markers))
+	for _, m := range song.Markers {
+		markers[m.Tick] = append(markers[m.Tick], m.Name)
+	}
+	return markers
+}
+
+// SeekToMarker makes the song currently playing for the player jump to the marker with the name passed.
+// Returns true if a song was playing and it has the marker.
+//
+// Example usage:
+//
+//	noteblockplayer.OnPlaybackEvent(func(e noteblockplayer.PlaybackEvent) {
+//	    if e.Type == noteblockplayer.EventMarker && e.Marker == "drop" {
+//	        // start the fireworks
+//	    }
+//	})
+//	noteblockplayer.SeekToMarker(p.H(), "chorus")
+func SeekToMarker(eh *world.EntityHandle, name string) bool {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	pb, ok := playbacks[musicKey(eh)]
+	if !ok {
+		return false
+	}
+	m, ok := pb.song.Marker(name)
+	if ok {
+		pb.send(control{kind: controlSeek, tick: m.Tick})
+	}
+	return ok
+}
+
+// SeekMarkerCmd is the command to make the song playing jump to one of its markers.
+type SeekMarkerCmd struct {
+	Marker cmd.SubCommand `cmd:"marker"`
+	Name   string         `cmd:"name"`
+}
+
+// Run seeks the song playing for the player to the marker passed.
+func (c SeekMarkerCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbseek command is only valid for players")
+		return
+	}
+	if !isPlaying(p.H()) {
+		output.Error("No song is currently playing")
+		return
+	}
+	if !SeekToMarker(p.H(), c.Name) {
+		output.Errorf("The song has no marker %q", c.Name)
+		return
+	}
+	output.Printf("Jumped to %s", c.Name)
+}
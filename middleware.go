@@ -0,0 +1,126 @@
+package noteblockplayer
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// NoteMiddleware is called for every note of a playback before it is played. It returns the note to play,
+// which may be changed, for example transposed, moved to another instrument or re-routed to another layer,
+// and false to drop the note entirely. Middleware is called from the goroutine running the playback, so it
+// must not block.
+type NoteMiddleware func(note Note, ctx *PlaybackContext) (Note, bool)
+
+// PlaybackContext describes the playback and tick a NoteMiddleware is called for.
+type PlaybackContext struct {
+	// PlaybackID is the ID of the playback, see StopPlayback.
+	PlaybackID int
+	Player     *world.EntityHandle
+	PlayerName string
+	Song       *Song
+	Channel    string
+	Tick       int
+}
+
+// noteMiddleware holds the middleware registered with UseNoteMiddleware by id, and middlewareChain the
+// registered middleware in the order it was registered. The chain is replaced as a whole whenever middleware
+// is registered or removed, so playbacks can read it for every tick without locking. noteMiddlewareMtx
+// protects access to noteMiddleware and nextMiddlewareID.
+var (
+	noteMiddleware    []registeredMiddleware
+	nextMiddlewareID  int
+	noteMiddlewareMtx sync.Mutex
+
+	middlewareChain atomic.Pointer[[]NoteMiddleware]
+)
+
+// registeredMiddleware is middleware registered with UseNoteMiddleware, along with its id.
+type registeredMiddleware struct {
+	id int
+	f  NoteMiddleware
+}
+
+// UseNoteMiddleware registers middleware called for every note of every playback, and returns a function
+// that unregisters it again. Middleware is called in the order it was registered, each with the note
+// returned by the one before it, followed by the middleware of PlaybackOptions.Middleware.
+//
+// Example usage (play every song an octave higher on the jingle channel):
+//
+//	noteblockplayer.UseNoteMiddleware(func(n noteblockplayer.Note, ctx *noteblockplayer.PlaybackContext) (noteblockplayer.Note, bool) {
+//	    if ctx.Channel == noteblockplayer.JingleChannel {
+//	        n.Key += 12
+//	    }
+//	    return n, true
+//	})
+func UseNoteMiddleware(f NoteMiddleware) (cancel func()) {
+	noteMiddlewareMtx.Lock()
+	defer noteMiddlewareMtx.Unlock()
+	id := nextMiddlewareID
+	nextMiddlewareID++
+	noteMiddleware = append(noteMiddleware, registeredMiddleware{id: id, f: f})
+	publishMiddleware()
+	return func() {
+		noteMiddlewareMtx.Lock()
+		defer noteMiddlewareMtx.Unlock()
+		noteMiddleware = slices.DeleteFunc(noteMiddleware, func(m registeredMiddleware) bool { return m.id == id })
+		publishMiddleware()
+	}
+}
+
+// publishMiddleware replaces the middleware chain read by playbacks. noteMiddlewareMtx must be held.
+func publishMiddleware() {
+	chain := make([]NoteMiddleware, len(noteMiddleware))
+	for i, m := range noteMiddleware {
+		chain[i] = m.f
+	}
+	middlewareChain.Store(&chain)
+}
+
+// applyMiddleware passes the notes of a tick through the registered middleware and that of the playback,
+// and returns the notes left to play. The notes passed are left unchanged, as they belong to the schedule
+// of the playback, so the notes returned are kept in pb.filtered.
+func (pb *playback) applyMiddleware(tick int, notes []Note) []Note {
+	var global []NoteMiddleware
+	if chain := middlewareChain.Load(); chain != nil {
+		global = *chain
+	}
+	if len(notes) == 0 || len(global)+len(pb.opts.Middleware) == 0 {
+		return notes
+	}
+	pb.ctx = PlaybackContext{
+		PlaybackID: pb.id,
+		Player:     pb.eh,
+		PlayerName: pb.playerName,
+		Song:       pb.song,
+		Channel:    pb.opts.Channel,
+		Tick:       tick,
+	}
+	filtered := pb.filtered[:0]
+	for _, note := range notes {
+		if note, ok := pb.passMiddleware(note, global); ok {
+			filtered = append(filtered, note)
+		}
+	}
+	pb.filtered = filtered
+	return filtered
+}
+
+// passMiddleware passes a single note through the global middleware passed and that of the playback. It
+// returns false if any of them dropped the note.
+func (pb *playback) passMiddleware(note Note, global []NoteMiddleware) (Note, bool) {
+	ok := true
+	for _, f := range global {
+		if note, ok = f(note, &pb.ctx); !ok {
+			return note, false
+		}
+	}
+	for _, f := range pb.opts.Middleware {
+		if note, ok = f(note, &pb.ctx); !ok {
+			return note, false
+		}
+	}
+	return note, true
+}
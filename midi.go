@@ -0,0 +1,227 @@
+package noteblockplayer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// midiDrumChannel is the MIDI channel (zero-based) reserved for percussion by General MIDI.
+const midiDrumChannel = 9
+
+// MIDIBridge listens for MIDI events on a TCP socket and relays the notes played to its listeners in real
+// time as note block sounds, so a musician can perform live on the server.
+//
+// The protocol is a plain stream of MIDI messages, as they would be read from a MIDI port: a bridge
+// program on the musician's machine only needs to forward the bytes of its MIDI input to the socket.
+// Note On messages are played, all other messages are ignored.
+type MIDIBridge struct {
+	ln net.Listener
+
+	mu          sync.Mutex
+	listeners   map[*world.EntityHandle]struct{}
+	instruments [16]int
+	conns       map[net.Conn]struct{}
+	closed      bool
+}
+
+// ListenMIDI starts a MIDIBridge listening on the TCP address passed, for example "127.0.0.1:5004".
+// Every MIDI channel plays the piano by default, except the General MIDI percussion channel, which plays
+// the drum instruments. Use SetChannelInstrument to change this.
+func ListenMIDI(addr string) (*MIDIBridge, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &MIDIBridge{
+		ln:        ln,
+		listeners: make(map[*world.EntityHandle]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	b.instruments[midiDrumChannel] = -1
+	go b.accept()
+	return b, nil
+}
+
+// Addr returns the address the bridge is listening on.
+func (b *MIDIBridge) Addr() net.Addr {
+	return b.ln.Addr()
+}
+
+// AddListener makes the player hear the notes relayed by the bridge.
+func (b *MIDIBridge) AddListener(eh *world.EntityHandle) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners[eh] = struct{}{}
+}
+
+// RemoveListener stops relaying notes to the player.
+func (b *MIDIBridge) RemoveListener(eh *world.EntityHandle) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.listeners, eh)
+}
+
+// SetChannelInstrument sets the instrument index (see instrumentSounds) played for notes on the MIDI channel
+// passed (0-15). An instrument of -1 maps the notes to the drum instruments, like the percussion channel.
+func (b *MIDIBridge) SetChannelInstrument(channel, instrument int) {
+	if channel < 0 || channel >= len(b.instruments) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.instruments[channel] = instrument
+}
+
+// Close stops listening and disconnects all MIDI sources.
+func (b *MIDIBridge) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	for conn := range b.conns {
+		_ = conn.Close()
+	}
+	b.mu.Unlock()
+	return b.ln.Close()
+}
+
+// accept accepts MIDI sources until the bridge is closed. Like net/http.Server.Serve, accepting is retried
+// after a delay growing up to a second if it fails, for example because the server ran out of file
+// descriptors.
+func (b *MIDIBridge) accept() {
+	var delay time.Duration
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			delay = min(max(delay*2, 5*time.Millisecond), time.Second)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		b.conns[conn] = struct{}{}
+		b.mu.Unlock()
+		go b.handle(conn)
+	}
+}
+
+// handle reads MIDI messages from a single source until it disconnects.
+func (b *MIDIBridge) handle(conn net.Conn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	var status byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		if c >= 0xF8 {
+			// System real-time messages carry no data and don't affect the running status.
+			continue
+		}
+		if c&0x80 != 0 {
+			status = c
+			if c >= 0xF0 {
+				if err := skipSystemMessage(r, c); err != nil {
+					return
+				}
+				status = 0
+			}
+			continue
+		}
+		if status == 0 {
+			// Data byte without a status, ignore it until the next status byte.
+			continue
+		}
+
+		// c is the first data byte of a channel message using the (running) status.
+		data := [2]byte{c}
+		kind := status & 0xF0
+		if kind != 0xC0 && kind != 0xD0 {
+			if data[1], err = r.ReadByte(); err != nil {
+				return
+			}
+		}
+		if kind == 0x90 && data[1] > 0 {
+			b.play(int(status&0x0F), int(data[0]), int(data[1]))
+		}
+	}
+}
+
+// skipSystemMessage skips the data bytes of a system common message with the status passed.
+func skipSystemMessage(r *bufio.Reader, status byte) error {
+	var n int
+	switch status {
+	case 0xF0:
+		// System exclusive: skip until the end of exclusive byte.
+		_, err := r.ReadBytes(0xF7)
+		return err
+	case 0xF1, 0xF3:
+		n = 1
+	case 0xF2:
+		n = 2
+	}
+	_, err := io.CopyN(io.Discard, r, int64(n))
+	return err
+}
+
+// play relays a MIDI Note On to all listeners of the bridge.
+func (b *MIDIBridge) play(channel, midiKey, midiVelocity int) {
+	b.mu.Lock()
+	instrument := b.instruments[channel]
+	listeners := make([]*world.EntityHandle, 0, len(b.listeners))
+	for eh := range b.listeners {
+		listeners = append(listeners, eh)
+	}
+	b.mu.Unlock()
+
+	note := Note{
+		Instrument: instrument,
+		Key:        midiKey - 21, // NBS key 0 is A0, which is MIDI note 21.
+		Velocity:   midiVelocity * 100 / 127,
+	}
+	if instrument < 0 {
+		note.Instrument, note.Key = midiDrum(midiKey)
+	}
+	for _, eh := range listeners {
+		if !playNote(eh, note) {
+			// The player is gone, stop relaying to them.
+			b.RemoveListener(eh)
+			continue
+		}
+		// Listeners that are recording capture the performance, so it can be saved as a song.
+		RecordNote(eh, note.Instrument, note.Key, note.Velocity)
+	}
+}
+
+// midiDrum maps a General MIDI percussion key to a drum instrument index and NBS key.
+func midiDrum(midiKey int) (instrument, key int) {
+	switch midiKey {
+	case 35, 36: // Bass drums
+		return 1, 33
+	case 42, 44, 46: // Hi-hats
+		return 3, 45
+	case 56: // Cowbell
+		return 11, 45
+	default: // Snares, toms and cymbals
+		return 2, 45
+	}
+}
@@ -0,0 +1,172 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// musicSource returns the player running a music subcommand, writing an error to the output if the source
+// is not a player.
+func musicSource(src cmd.Source, output *cmd.Output) (*player.Player, bool) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("This music command is only valid for players")
+	}
+	return p, ok
+}
+
+// MusicPlayCmd is the music subcommand to play a song, like playnoteblock.
+type MusicPlayCmd struct {
+	Play     cmd.SubCommand        `cmd:"play"`
+	Filename string                `cmd:"filename"`
+	Tempo    cmd.Optional[float64] `cmd:"tempo"`
+}
+
+// AllowConsole allows this command from the server console.
+func (MusicPlayCmd) AllowConsole() bool { return true }
+
+// Run plays the song like playnoteblock.
+func (c MusicPlayCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	PlayNoteBlockCmd{Filename: c.Filename, Tempo: c.Tempo}.Run(src, output, w)
+}
+
+// MusicStopCmd is the music subcommand to stop the song playing.
+type MusicStopCmd struct {
+	Stop cmd.SubCommand `cmd:"stop"`
+}
+
+// Run stops the song playing for the player.
+func (c MusicStopCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := musicSource(src, output)
+	if !ok {
+		return
+	}
+	if !StopNoteblock(p.H()) {
+		output.Error("No song is currently playing")
+	}
+}
+
+// MusicPauseCmd is the music subcommand to pause the song playing.
+type MusicPauseCmd struct {
+	Pause cmd.SubCommand `cmd:"pause"`
+}
+
+// Run pauses the song playing for the player.
+func (c MusicPauseCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := musicSource(src, output)
+	if !ok {
+		return
+	}
+	if !PauseNoteblock(p.H()) {
+		output.Error("No song is currently playing")
+		return
+	}
+	output.Print("Song paused, continue it with /music resume")
+}
+
+// MusicResumeCmd is the music subcommand to continue a paused song.
+type MusicResumeCmd struct {
+	Resume cmd.SubCommand `cmd:"resume"`
+}
+
+// Run resumes the song paused for the player.
+func (c MusicResumeCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := musicSource(src, output)
+	if !ok {
+		return
+	}
+	if !ResumeNoteblock(p.H()) {
+		output.Error("No song is currently playing")
+	}
+}
+
+// MusicQueueCmd is the music subcommand to add a song to the queue, like queuenb add.
+type MusicQueueCmd struct {
+	Queue    cmd.SubCommand `cmd:"queue"`
+	Filename string         `cmd:"filename"`
+}
+
+// Run adds the song to the end of the player's queue.
+func (c MusicQueueCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if _, ok := musicSource(src, output); !ok {
+		return
+	}
+	QueueAddCmd{Filename: c.Filename}.Run(src, output, w)
+}
+
+// MusicVolumeCmd is the music subcommand to set the volume music is played to the player at.
+type MusicVolumeCmd struct {
+	Volume cmd.SubCommand        `cmd:"volume"`
+	Level  cmd.Optional[float64] `cmd:"level"`
+}
+
+// Run sets the volume of the player, or shows it if no volume is passed.
+func (c MusicVolumeCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := musicSource(src, output)
+	if !ok {
+		return
+	}
+	level, ok := c.Level.Load()
+	if !ok {
+		output.Printf("Music volume: %d%%", int(PlayerVolume(p.H())*100))
+		return
+	}
+	if level < 0 || level > 1 {
+		output.Error("The volume must be between 0 and 1")
+		return
+	}
+	if err := SetPlayerVolume(p.H(), level); err != nil {
+		output.Errorf("Failed to save your preference: %v", err)
+		return
+	}
+	output.Printf("Music volume set to %d%%", int(level*100))
+}
+
+// MusicListCmd is the music subcommand to list the songs in the library, like listnb.
+type MusicListCmd struct {
+	List cmd.SubCommand    `cmd:"list"`
+	Page cmd.Optional[int] `cmd:"page"`
+}
+
+// AllowConsole allows this command from the server console.
+func (MusicListCmd) AllowConsole() bool { return true }
+
+// Run lists a page of the songs in the library.
+func (c MusicListCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	ListCmd{Page: c.Page}.Run(src, output, w)
+}
+
+// MusicSearchCmd is the music subcommand to search the library for songs by name, title or author.
+type MusicSearchCmd struct {
+	Search cmd.SubCommand `cmd:"search"`
+	Query  cmd.Varargs    `cmd:"query"`
+}
+
+// AllowConsole allows this command from the server console.
+func (MusicSearchCmd) AllowConsole() bool { return true }
+
+// Run lists the songs matching the query.
+func (c MusicSearchCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	filter := musicFilter{query: strings.TrimSpace(string(c.Query))}
+	runLibraryCmd(src, output, func(lib *Library) []string {
+		var lines []string
+		for _, s := range lib.Unique() {
+			if !filter.matches(s, nil, nil) {
+				continue
+			}
+			line := "§e/pnb " + s.Name + "§r"
+			if s.Title != "" {
+				line += " §7- " + s.Title + "§r"
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			return []string{fmt.Sprintf("No songs found for %q", filter.query)}
+		}
+		return append([]string{fmt.Sprintf("%d songs found:", len(lines))}, lines...)
+	})
+}
@@ -0,0 +1,278 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/player/form"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// musicUIPageSize is the number of songs listed on one page of the song browser.
+const musicUIPageSize = 20
+
+// Texts of the navigation buttons of the song browser.
+const (
+	searchButtonText   = "Search and filter"
+	previousButtonText = "« Previous page"
+	nextButtonText     = "Next page »"
+)
+
+// musicFilter selects the songs listed by the song browser.
+type musicFilter struct {
+	// query must be contained in the name, title or author of a song, ignoring case.
+	query string
+	// tag, if not empty, must be a tag of the song.
+	tag string
+	// favorites only lists the songs the player bookmarked.
+	favorites bool
+}
+
+// matches reports whether the song passed is selected by the filter. favorites and tagged are the favorites
+// of the player and the songs with the tag of the filter.
+func (f musicFilter) matches(s LibrarySong, favorites, tagged []string) bool {
+	if f.favorites && !containsSong(favorites, s.Name) {
+		return false
+	}
+	if f.tag != "" && !slices.Contains(tagged, s.Name) && !slices.Contains(tagged, strings.TrimSuffix(s.Name, path.Ext(s.Name))) {
+		return false
+	}
+	if f.query == "" {
+		return true
+	}
+	q := strings.ToLower(f.query)
+	for _, field := range []string{s.Name, s.Title, s.Author} {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenMusicUI opens the song browser for the player: a form listing the songs in the library, which can
+// be searched and filtered by tag, with buttons to play, queue or bookmark every song. The library is
+// indexed in the background, so the form may take a moment to show up the first time.
+func OpenMusicUI(eh *world.EntityHandle) {
+	openMusicUI(eh, musicFilter{}, 0)
+}
+
+// openMusicUI indexes the library in the background and sends the page of the song browser with the
+// filter passed to the player.
+func openMusicUI(eh *world.EntityHandle, filter musicFilter, page int) {
+	go func() {
+		lib, err := IndexLibrary()
+		if err != nil {
+			messagePlayer(eh, fmt.Sprintf("§cFailed to index songs: %v", err))
+			return
+		}
+		var tagged []string
+		if filter.tag != "" {
+			tagged = SongsWithTag(filter.tag)
+		}
+		favorites := Preferences(eh).Favorites
+
+		var songs []LibrarySong
+		for _, s := range lib.Unique() {
+			if filter.matches(s, favorites, tagged) {
+				songs = append(songs, s)
+			}
+		}
+		pages := max(1, (len(songs)+musicUIPageSize-1)/musicUIPageSize)
+		page = min(max(page, 0), pages-1)
+
+		m := musicMenu{filter: filter, page: page, songs: make(map[string]string)}
+		body := fmt.Sprintf("%d songs", len(songs))
+		if pages > 1 {
+			body += fmt.Sprintf(", page %d of %d", page+1, pages)
+		}
+		buttons := []form.Button{form.NewButton(searchButtonText, "")}
+		for _, s := range songs[page*musicUIPageSize : min(len(songs), (page+1)*musicUIPageSize)] {
+			text := s.Name
+			if containsSong(favorites, s.Name) {
+				text = "★ " + text
+			}
+			if s.Title != "" {
+				text += "\n§8" + s.Title
+				if s.Author != "" {
+					text += " by " + s.Author
+				}
+			}
+			m.songs[text] = s.Name
+			buttons = append(buttons, form.NewButton(text, ""))
+		}
+		if page > 0 {
+			buttons = append(buttons, form.NewButton(previousButtonText, ""))
+		}
+		if page < pages-1 {
+			buttons = append(buttons, form.NewButton(nextButtonText, ""))
+		}
+		f := form.NewMenu(m, "§l♪ Music").WithBody(body).WithButtons(buttons...)
+		_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+			if pp, ok := ent.(*player.Player); ok {
+				pp.SendForm(f)
+			}
+		})
+	}()
+}
+
+// musicMenu is a page of the song browser.
+type musicMenu struct {
+	filter musicFilter
+	page   int
+	// songs maps the texts of the song buttons to the names of the songs.
+	songs map[string]string
+}
+
+// Submit opens the search form, another page, or the actions of the song pressed.
+func (m musicMenu) Submit(submitter form.Submitter, pressed form.Button, tx *world.Tx) {
+	pp, ok := submitter.(*player.Player)
+	if !ok {
+		return
+	}
+	switch pressed.Text {
+	case searchButtonText:
+		tags := append([]string{"Any"}, Tags()...)
+		tag := max(slices.Index(tags, m.filter.tag), 0)
+		pp.SendForm(form.New(musicSearch{
+			Query:     form.NewInput("Search", m.filter.query, "Name, title or author"),
+			Tag:       form.NewDropdown("Tag", tags, tag),
+			Favorites: form.NewToggle("Favorites only", m.filter.favorites),
+		}, "§l♪ Search"))
+	case previousButtonText:
+		openMusicUI(pp.H(), m.filter, m.page-1)
+	case nextButtonText:
+		openMusicUI(pp.H(), m.filter, m.page+1)
+	default:
+		if name, ok := m.songs[pressed.Text]; ok {
+			pp.SendForm(songActionsForm(pp.H(), name, m.filter, m.page))
+		}
+	}
+}
+
+// musicSearch is the form to search and filter the songs of the song browser.
+type musicSearch struct {
+	Query     form.Input
+	Tag       form.Dropdown
+	Favorites form.Toggle
+}
+
+// Submit opens the song browser with the filter entered.
+func (s musicSearch) Submit(submitter form.Submitter, tx *world.Tx) {
+	pp, ok := submitter.(*player.Player)
+	if !ok {
+		return
+	}
+	filter := musicFilter{query: strings.TrimSpace(s.Query.Value()), favorites: s.Favorites.Value()}
+	if i := s.Tag.Value(); i > 0 && i < len(s.Tag.Options) {
+		filter.tag = s.Tag.Options[i]
+	}
+	openMusicUI(pp.H(), filter, 0)
+}
+
+// songActions is the form with the actions for a single song of the song browser.
+type songActions struct {
+	Play     form.Button
+	Queue    form.Button
+	Favorite form.Button
+	Back     form.Button
+
+	name   string
+	filter musicFilter
+	page   int
+}
+
+// songActionsForm returns the form with the actions for the song with the name passed, which returns to
+// the page of the song browser passed.
+func songActionsForm(eh *world.EntityHandle, name string, filter musicFilter, page int) form.Menu {
+	favorite := "Add to favorites"
+	if IsFavorite(eh, name) {
+		favorite = "Remove from favorites"
+	}
+	return form.NewMenu(songActions{
+		Play:     form.NewButton("Play", ""),
+		Queue:    form.NewButton("Add to queue", ""),
+		Favorite: form.NewButton(favorite, ""),
+		Back:     form.NewButton("Back", ""),
+		name:     name,
+		filter:   filter,
+		page:     page,
+	}, "§l♪ "+name)
+}
+
+// Submit runs the action pressed for the song.
+func (a songActions) Submit(submitter form.Submitter, pressed form.Button, tx *world.Tx) {
+	pp, ok := submitter.(*player.Player)
+	if !ok {
+		return
+	}
+	eh := pp.H()
+	switch pressed.Text {
+	case a.Play.Text:
+		go func() {
+			song, err := requestSong(eh, a.name, false)
+			if err != nil {
+				messagePlayer(eh, "§c"+err.Error())
+				return
+			}
+			playSong(eh, song, PlaybackOptions{Source: "musicui"})
+		}()
+	case a.Queue.Text:
+		go func() {
+			song, err := requestSong(eh, a.name, true)
+			if err != nil {
+				messagePlayer(eh, "§c"+err.Error())
+				return
+			}
+			queueSong(eh, song, PlaybackOptions{Source: "musicui"})
+			messagePlayer(eh, "Added "+a.name+" to your queue")
+		}()
+	case a.Favorite.Text:
+		favorite := !IsFavorite(eh, a.name)
+		go func() {
+			var err error
+			if favorite {
+				err = AddFavorite(eh, a.name)
+			} else {
+				err = RemoveFavorite(eh, a.name)
+			}
+			if err != nil {
+				messagePlayer(eh, fmt.Sprintf("§cFailed to save your favorites: %v", err))
+				return
+			}
+			openMusicUI(eh, a.filter, a.page)
+		}()
+	case a.Back.Text:
+		openMusicUI(eh, a.filter, a.page)
+	}
+}
+
+// requestSong loads the song with the name passed for a request from the song browser, checks it against the
+// Tier of the player and charges them for it. queue is true if the song is added to the player's queue. The
+// error returned is meant to be shown to the player.
+func requestSong(eh *world.EntityHandle, name string, queue bool) (*Song, error) {
+	song, err := flexSongLoader(name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load file: %w", err)
+	}
+	if err := checkRequestHandle(eh, song, queue); err != nil {
+		return nil, fmt.Errorf("Could not play %s: %w", song.displayName(), err)
+	}
+	return song, nil
+}
+
+// MusicUICmd is the command to open the song browser.
+type MusicUICmd struct{}
+
+// Run opens the song browser for the player.
+func (MusicUICmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The musicui command is only valid for players")
+		return
+	}
+	OpenMusicUI(p.H())
+}
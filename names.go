@@ -0,0 +1,155 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// validSongName checks that the song or pack name passed stays inside the song folders once joined to them.
+// Names may refer to songs in subfolders ("albums/song"), but absolute paths, volume names (also Windows
+// drive letters on other systems, like "C:/x"), backslashes and ".." elements are rejected with an error
+// wrapping ErrInvalidName.
+func validSongName(name string) error {
+	switch {
+	case name == "", strings.ContainsAny(name, "\\\x00"), path.IsAbs(name), filepath.IsAbs(name),
+		filepath.VolumeName(name) != "", hasDriveLetter(name), !filepath.IsLocal(name):
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidName, name)
+		}
+	}
+	return nil
+}
+
+// hasDriveLetter reports whether the name starts with a Windows drive letter, such as "C:".
+func hasDriveLetter(name string) bool {
+	return len(name) >= 2 && name[1] == ':' && ('a' <= name[0]|0x20 && name[0]|0x20 <= 'z')
+}
+
+// findFileFold returns the name of the file in dir matching one of the file names passed, ignoring case, so
+// that "Megalovania" finds "megalovania.nbs" on case-sensitive file systems too.
+func findFileFold(dir string, files ...string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, file := range files {
+		for _, e := range entries {
+			if e.Type().IsRegular() && strings.EqualFold(e.Name(), file) {
+				return e.Name(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// SuggestSong returns the name of the song closest to the name passed, for names that don't match any song.
+// Names are compared without case and extension, and only songs close enough to be a likely typo are
+// suggested.
+//
+// Example usage:
+//
+//	if name, ok := noteblockplayer.SuggestSong("megalovnia"); ok {
+//	    fmt.Printf("Did you mean %s?", name)
+//	}
+func SuggestSong(name string) (string, bool) {
+	return suggestSong(name, nil)
+}
+
+// suggestSong returns the song closest to the name passed, searching the song folders of the world passed
+// (if not nil) too.
+func suggestSong(name string, w *world.World) (string, bool) {
+	candidates := songNames(w)
+	target := songNameKey(name)
+	if target == "" {
+		return "", false
+	}
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		key := songNameKey(c)
+		dist := editDistance(target, key)
+		if strings.Contains(key, target) || strings.Contains(target, key) {
+			// Songs containing the name passed, or contained in it, are likely meant even if they are longer.
+			dist = min(dist, 1+abs(len(key)-len(target))/4)
+		}
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = c, dist
+		}
+	}
+	if bestDist < 0 || bestDist > max(2, len(target)/3) {
+		return "", false
+	}
+	return best, true
+}
+
+// songNames returns the file names of all songs in the song folders of the world passed (which may be nil)
+// and in song packs. Unlike ListSongs, missing folders and broken packs are skipped silently.
+func songNames(w *world.World) []string {
+	var names []string
+	for _, dir := range searchDirs(w) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() && isSongFile(e.Name()) {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	if packs, err := ListPacks(); err == nil {
+		for _, p := range packs {
+			for _, s := range p.Songs {
+				names = append(names, p.Name+":"+s.Name+path.Ext(s.File))
+			}
+		}
+	}
+	return names
+}
+
+// songNameKey returns the form of a song name that names are compared in: lower case, without extension.
+func songNameKey(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if ext := path.Ext(name); ext == ".nbs" || ext == ".json" {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// editDistance returns the Levenshtein distance between a and b: the number of single character insertions,
+// deletions and substitutions needed to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// abs returns the absolute value of n.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,80 @@
+package noteblockplayer
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidSongName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"song", true},
+		{"albums/song", true},
+		{"albums/song.nbs", true},
+		{"../../secret", false},
+		{"a/../../b", false},
+		{"..", false},
+		{"/etc/passwd", false},
+		{`C:\x`, false},
+		{"C:/x", false},
+		{`albums\song`, false},
+		{`..\..\secret`, false},
+		{"song\x00.nbs", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		err := validSongName(tt.name)
+		if tt.valid && err != nil {
+			t.Errorf("validSongName(%q) = %v, want nil", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidName) {
+			t.Errorf("validSongName(%q) = %v, want ErrInvalidName", tt.name, err)
+		}
+	}
+}
+
+func TestLoadSongRejectsTraversal(t *testing.T) {
+	tests := []string{
+		"../../secret",
+		"a/../../b",
+		"/etc/passwd",
+		`C:\x`,
+		`albums\song`,
+		"song\x00",
+		"../packs:song",
+		"a/../../pack:song",
+		"pack:../song",
+	}
+	for _, name := range tests {
+		if _, err := loadSongWith(name, nil, nil, ParseOptions{}); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("loadSongWith(%q) = %v, want ErrInvalidName", name, err)
+		}
+	}
+}
+
+func TestLoadSongCaseFold(t *testing.T) {
+	dir := t.TempDir()
+	SetSongDirs(dir)
+	defer SetSongDirs(defaultSongDir)
+
+	song := &Song{Tempo: 10, Length: 4, Notes: []Note{{Tick: 0, Key: 45, Velocity: 100}}}
+	if err := SaveSong(filepath.Join(dir, "Megalovania.nbs"), song); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Megalovania", "megalovania", "MEGALOVANIA.nbs"} {
+		got, err := loadSongWith(name, nil, nil, ParseOptions{})
+		if err != nil {
+			t.Errorf("loadSongWith(%q) = %v, want the song", name, err)
+			continue
+		}
+		if len(got.Notes) != 1 {
+			t.Errorf("loadSongWith(%q) has %d notes, want 1", name, len(got.Notes))
+		}
+	}
+	if _, err := loadSongWith("megalovania/../../Megalovania", nil, nil, ParseOptions{}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("case-fold lookup accepted a name escaping the song folder: %v", err)
+	}
+}
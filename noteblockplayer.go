@@ -1,339 +1,1018 @@
-package noteblockplayer
-
-import (
-	"fmt"
-	"math"
-	"sync"
-	"time"
-
-	"github.com/df-mc/dragonfly/server/cmd"
-	"github.com/df-mc/dragonfly/server/player"
-	"github.com/df-mc/dragonfly/server/world"
-	"github.com/df-mc/dragonfly/server/world/sound"
-)
-
-// Note represents a single note in a noteblock song.
-// It includes properties like tick (time), layer, instrument, key (pitch), velocity, panning, and pitch bend.
-type Note struct {
-	Tick       int `json:"tick"`
-	Layer      int `json:"layer"`
-	Instrument int `json:"instrument"`
-	Key        int `json:"key"`
-	Velocity   int `json:"velocity,omitempty"`
-	Panning    int `json:"panning,omitempty"`
-	Pitch      int `json:"pitch,omitempty"`
-}
-
-// Song represents the parsed noteblock song file, including meta info and all notes.
-type Song struct {
-	Tempo    float64 `json:"tempo"`              // Song tempo (ticks per second)
-	Length   int     `json:"length"`             // Song length in ticks
-	Notes    []Note  `json:"notes"`              // Notes
-	Title    string  `json:"title,omitempty"`    // Optional song title
-	Author   string  `json:"author,omitempty"`   // Optional song author
-	Duration float64 `json:"duration,omitempty"` // Calculated song duration (seconds)
-}
-
-// instrumentSounds maps instrument indices to dragonfly sound.Instrument types.
-var instrumentSounds = []sound.Instrument{
-	sound.Piano(),           // 0
-	sound.BassDrum(),        // 1
-	sound.Snare(),           // 2
-	sound.ClicksAndSticks(), // 3
-	sound.Bass(),            // 4
-	sound.Flute(),           // 5
-	sound.Bell(),            // 6
-	sound.Guitar(),          // 7
-	sound.Chimes(),          // 8
-	sound.Xylophone(),       // 9
-	sound.IronXylophone(),   // 10
-	sound.CowBell(),         // 11
-	sound.Didgeridoo(),      // 12
-	sound.Bit(),             // 13
-	sound.Banjo(),           // 14
-	sound.Pling(),           // 15
-}
-
-// stopPlayer holds channels for song-control per player for async song stopping.
-// stopPlayerMtx protects access to stopPlayer.
-var (
-	stopPlayer    = make(map[*world.EntityHandle]chan struct{})
-	stopPlayerMtx sync.Mutex
-)
-
-// ---------- Command Structs & Registration ----------
-
-// PlayNoteBlockCmd is the command to play a noteblock song (NBS or JSON-based).
-type PlayNoteBlockCmd struct {
-	Filename string `cmd:"filename"`
-}
-
-// AllowConsole allows this command from the server console.
-func (PlayNoteBlockCmd) AllowConsole() bool { return true }
-
-// Run executes the playnoteblock command: loads the song, and, if a player, plays it to them only.
-func (c PlayNoteBlockCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
-	// If extension is ".nbs" load as NBS, else ".json" or no extension loads as JSON.
-	song, err := flexSongLoader(c.Filename)
-	if err != nil {
-		fmt.Printf("Failed to load file: %v\n", err)
-		return
-	}
-	p, ok := src.(*player.Player)
-	if ok {
-		go playSong(p.H(), song)
-		return
-	}
-	fmt.Printf("Song %s loaded, but playback is only supported for players", c.Filename)
-}
-
-// StopNoteBlockCmd is the command to stop any currently playing noteblock song for the player.
-type StopNoteBlockCmd struct{}
-
-// AllowConsole allows this command from the server console.
-func (StopNoteBlockCmd) AllowConsole() bool { return true }
-
-// Run executes the stopnoteblock command; only works for players.
-func (c StopNoteBlockCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
-	p, ok := src.(*player.Player)
-	if !ok {
-		fmt.Print("The stopnoteblock command is only valid for players")
-		return
-	}
-	if stopSong(p.H()) {
-		// output.Print("Song playback stopped")
-	} else {
-		// output.Print("No song is currently playing")
-	}
-}
-
-// ----------- Song Data Conversion & Control Utilities -----------
-
-// nbsConverter converts NBSData to Song struct for unified usage.
-func nbsConverter(nd *NBSData) *Song {
-	notes := make([]Note, len(nd.Notess))
-	for i, n := range nd.Notess {
-		notes[i] = Note{
-			Tick:       n.Tick,
-			Layer:      n.Layer,
-			Instrument: int(n.Instrument),
-			Key:        int(n.Key),
-			Velocity:   int(n.Velocity),
-			Panning:    int(n.Panning),
-			Pitch:      int(n.Pitch),
-		}
-	}
-	return &Song{
-		Tempo:    float64(nd.Tempo),
-		Length:   int(nd.Length),
-		Notes:    notes,
-		Duration: float64(nd.Duration),
-	}
-}
-
-// stopSong signals the running goroutine (if exists) to stop playing the song for a given player.
-// Returns true if a song was stopped, false if not.
-func stopSong(eh *world.EntityHandle) bool {
-	stopPlayerMtx.Lock()
-	defer stopPlayerMtx.Unlock()
-	ch, ok := stopPlayer[eh]
-	if ok {
-		select {
-		case ch <- struct{}{}:
-		default:
-		}
-		delete(stopPlayer, eh)
-		return true
-	}
-	return false
-}
-
-// ------------ Song Playback Utilities ------------
-
-// playSong plays the given Song asynchronously for the provided EntityHandle (player).
-// Allows controlled stopping, handles tick timing, and message.
-func playSong(eh *world.EntityHandle, song *Song) {
-	stopPlayerMtx.Lock()
-	if ch, ok := stopPlayer[eh]; ok {
-		select {
-		case ch <- struct{}{}:
-		default:
-		}
-	}
-	stopChan := make(chan struct{}, 1)
-	stopPlayer[eh] = stopChan
-	stopPlayerMtx.Unlock()
-
-	tickDuration := time.Second / 20 // Default: 20 ticks per second
-	if song.Tempo > 0 {
-		tickDuration = time.Duration(float64(time.Second) / song.Tempo)
-	}
-
-	currentTick := 0
-	notesPerTick := make(map[int][]Note)
-	for _, note := range song.Notes {
-		notesPerTick[note.Tick] = append(notesPerTick[note.Tick], note)
-	}
-
-	defer func() {
-		stopPlayerMtx.Lock()
-		delete(stopPlayer, eh)
-		stopPlayerMtx.Unlock()
-	}()
-
-	for tick := 0; tick <= song.Length; tick++ {
-		select {
-		case <-stopChan:
-			return
-		default:
-		}
-
-		if tick > currentTick {
-			time.Sleep(time.Duration(tick-currentTick) * tickDuration)
-			currentTick = tick
-		}
-		if notes, found := notesPerTick[tick]; found {
-			for _, note := range notes {
-				_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
-					pp, ok := ent.(*player.Player)
-					if !ok {
-						return
-					}
-					pos := pp.Position()
-					instrument := "note.harp"
-					if note.Instrument >= 0 && note.Instrument < len(instrumentSounds) {
-						switch note.Instrument {
-						case 1:
-							instrument = "note.basedrum"
-						case 2:
-							instrument = "note.snare"
-						case 3:
-							instrument = "note.hat"
-						case 4:
-							instrument = "note.bass"
-						case 5:
-							instrument = "note.flute"
-						case 6:
-							instrument = "note.bell"
-						case 7:
-							instrument = "note.guitar"
-						case 8:
-							instrument = "note.chime"
-						case 9:
-							instrument = "note.xylophone"
-						case 10:
-							instrument = "note.iron_xylophone"
-						case 11:
-							instrument = "note.cow_bell"
-						case 12:
-							instrument = "note.didgeridoo"
-						case 13:
-							instrument = "note.bit"
-						case 14:
-							instrument = "note.banjo"
-						case 15:
-							instrument = "note.pling"
-						}
-					}
-					pitch := Floatkey(note.Key)
-					volume := FloatVel(note.Velocity)
-					PacketPlaySound(pp, instrument, pitch, volume, pos)
-				})
-			}
-		}
-	}
-}
-
-// PitchKey calculates the Bedrock note pitch index based on the NBS note key.
-// Bedrock's base is 33 (F#3).
-func PitchKey(key int) int {
-	base := 33 // F#3 is key 33 in Bedrock
-	return key - base
-}
-
-// Bedrock "note" starts at key 33 (F#3). Each +12 is one octave (double freq/float).
-//
-// F#3 = 0.5, F#4 = 1.0, F#5 = 2.0, etc.
-//
-// So, the formulat is: 0.5 * 2^((key-33)/12)
-func Floatkey(key int) float32 {
-	baseKey := 33
-	return float32(0.5 * math.Pow(2, float64(key-baseKey)/12))
-}
-
-// FloatVel converts NBS/JSON note velocity (0-100) to Bedrock/Dragonfly volume [0.0, 1.0].
-// Values below or equal 0 are muted; above 100 are clamped to 1.0
-func FloatVel(val int) float32 {
-	if val <= 0 {
-		return 0
-	}
-	if val >= 100 {
-		return 1.0
-	}
-	return float32(val) / 100.0
-}
-
-// Pow is a helper function alias for math.Pow (for convenience).
-func Pow(base, exp float64) float64 {
-	return math.Pow(base, exp)
-}
-
-// --------------- Function Call Helper ----------------------
-
-// PlayNoteblock is a helper function to programmatically play a song file for a player.
-//
-// Accepts player handle (EntityHandle) and file name (string, path relative to "noteblock" folder or base folder).
-// Supported formats: ".nbs" (Noteblock Studio), ".json" (custom Song struct).
-//
-// Returns error if loading or playback fails.
-// Example usage (from any Go function with *player.Player object `p`):
-//
-//	err := PlayNoteblock(p.H(), "my_song.nbs")
-//	if err != nil {
-//	    // handle error
-//	}
-//
-// Note: This helper does not send a chat message to the player! (Unlike the command.)
-func PlayNoteblock(eh *world.EntityHandle, filename string) error {
-	song, err := flexSongLoader(filename)
-	if err != nil {
-		return err
-	}
-	go playSong(eh, song)
-	return nil
-}
-
-// StopNoteblock is a helper function to stop the currently playing noteblock song for a player.
-//
-// Accepts player handle (EntityHandle).
-// Returns true if a song was stopped, false if no song was playing.
-//
-// Example usage (from any Go function with *player.Player object `p`):
-//
-//	success := StopNoteblock(p.H())
-//	if success {
-//	    // song stopped
-//	} else {
-//	    // no song was playing
-//	}
-func StopNoteblock(eh *world.EntityHandle) bool {
-	return stopSong(eh)
-}
-
-// --------------- Command Registration ---------------
-
-// init registers all noteblock-related player commands.
-func init() {
-	cmd.Register(cmd.New(
-		"playnoteblock",
-		"Play a noteblock song file (json/nbs)",
-		[]string{"playnb", "pnb"},
-		PlayNoteBlockCmd{},
-	))
-	cmd.Register(cmd.New(
-		"stopnoteblock",
-		"Stop the currently playing noteblock file",
-		[]string{"stopnb", "snb"},
-		StopNoteBlockCmd{},
-	))
-}
+package noteblockplayer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/sound"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Note represents a single note in a noteblock song.
+// It includes properties like tick (time), layer, instrument, key (pitch), velocity, panning, and pitch bend.
+type Note struct {
+	Tick       int `json:"tick"`
+	Layer      int `json:"layer"`
+	Instrument int `json:"instrument"`
+	Key        int `json:"key"`
+	Velocity   int `json:"velocity,omitempty"`
+	Panning    int `json:"panning,omitempty"`
+	Pitch      int `json:"pitch,omitempty"`
+}
+
+// Song represents the parsed noteblock song file, including meta info and all notes.
+type Song struct {
+	Tempo    float64     `json:"tempo"`              // Song tempo (ticks per second)
+	Length   int         `json:"length"`             // Song length in ticks
+	Notes    []Note      `json:"notes"`              // Notes
+	Title    string      `json:"title,omitempty"`    // Optional song title
+	Author   string      `json:"author,omitempty"`   // Optional song author
+	Duration float64     `json:"duration,omitempty"` // Calculated song duration (seconds)
+	Version  int         `json:"version,omitempty"`  // NBS file version the song was converted from
+	Lyrics   []LyricLine `json:"lyrics,omitempty"`   // Optional timed lyrics
+	Markers  []Marker    `json:"markers,omitempty"`  // Optional named positions, like chorus
+	Warnings []string    `json:"-"`                  // Problems of the file the song was loaded despite
+
+	OriginalAuthor string `json:"originalAuthor,omitempty"` // Optional author of the original song, for covers
+	Description    string `json:"description,omitempty"`    // Optional song description
+	ImportName     string `json:"importName,omitempty"`     // Optional file the song was imported from
+	TimeSignature  int    `json:"timeSignature,omitempty"`  // Beats per bar, 4 if not set
+
+	LoopEnabled   bool `json:"loopEnabled,omitempty"`   // Whether the author meant the song to loop once it ends
+	LoopCount     int  `json:"loopCount,omitempty"`     // Times the song loops, 0 loops forever
+	LoopStartTick int  `json:"loopStartTick,omitempty"` // Tick the song continues at when it loops
+
+	TempoChanges []TempoChange `json:"tempoChanges,omitempty"` // Optional changes and ramps of the tempo
+	// CustomInstruments are the optional names of the custom instruments of the song by their index, see
+	// SetInstrumentFallback.
+	CustomInstruments map[int]string `json:"customInstruments,omitempty"`
+
+	name string // File name the song was loaded from
+}
+
+// credits returns the author of the song, along with the author of the original song if it is a cover by
+// someone else, or an empty string if neither is known.
+func (s *Song) credits() string {
+	switch {
+	case s.Author == "":
+		return s.OriginalAuthor
+	case s.OriginalAuthor == "" || strings.EqualFold(s.OriginalAuthor, s.Author):
+		return s.Author
+	default:
+		return s.Author + " (original by " + s.OriginalAuthor + ")"
+	}
+}
+
+// displayName returns the title of the song, or the name of the file it was loaded from if it has no title.
+func (s *Song) displayName() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	if s.name != "" {
+		return s.name
+	}
+	return "Unknown song"
+}
+
+// instrumentSounds maps instrument indices to dragonfly sound.Instrument types.
+var instrumentSounds = []sound.Instrument{
+	sound.Piano(),           // 0
+	sound.BassDrum(),        // 1
+	sound.Snare(),           // 2
+	sound.ClicksAndSticks(), // 3
+	sound.Bass(),            // 4
+	sound.Flute(),           // 5
+	sound.Bell(),            // 6
+	sound.Guitar(),          // 7
+	sound.Chimes(),          // 8
+	sound.Xylophone(),       // 9
+	sound.IronXylophone(),   // 10
+	sound.CowBell(),         // 11
+	sound.Didgeridoo(),      // 12
+	sound.Bit(),             // 13
+	sound.Banjo(),           // 14
+	sound.Pling(),           // 15
+}
+
+// instrumentSoundNames maps instrument indices to the Bedrock sound names sent in PlaySound packets.
+var instrumentSoundNames = []string{
+	"note.harp",           // 0
+	"note.basedrum",       // 1
+	"note.snare",          // 2
+	"note.hat",            // 3
+	"note.bass",           // 4
+	"note.flute",          // 5
+	"note.bell",           // 6
+	"note.guitar",         // 7
+	"note.chime",          // 8
+	"note.xylophone",      // 9
+	"note.iron_xylophone", // 10
+	"note.cow_bell",       // 11
+	"note.didgeridoo",     // 12
+	"note.bit",            // 13
+	"note.banjo",          // 14
+	"note.pling",          // 15
+}
+
+// playbackKey identifies the playback of a player on a channel. See PlaybackOptions.Channel.
+type playbackKey struct {
+	eh      *world.EntityHandle
+	channel string
+}
+
+// musicKey returns the key of the playback of the player on the music channel.
+func musicKey(eh *world.EntityHandle) playbackKey {
+	return playbackKey{eh: eh}
+}
+
+// playbacks holds the running playback per player and channel, used to control it asynchronously.
+// playbacksMtx protects access to playbacks.
+var (
+	playbacks    = make(map[playbackKey]*playback)
+	playbacksMtx sync.Mutex
+)
+
+// lastPlaybackID is the ID of the playback started last. See StopPlayback.
+var lastPlaybackID atomic.Int64
+
+// ---------- Command Structs & Registration ----------
+
+// PlayNoteBlockCmd is the command to play a noteblock song (NBS or JSON-based).
+type PlayNoteBlockCmd struct {
+	Filename string                `cmd:"filename"`
+	Tempo    cmd.Optional[float64] `cmd:"tempo"`
+}
+
+// AllowConsole allows this command from the server console.
+func (PlayNoteBlockCmd) AllowConsole() bool { return true }
+
+// Run executes the playnoteblock command: loads the song, and, if a player, plays it to them only.
+// The optional tempo (ticks per second) overrides the tempo of the song. For players, the song is loaded
+// in the background, showing the progress of big files, and starts playing once it is loaded. Players can
+// pass "last" as file name to play the song they played last again.
+func (c PlayNoteBlockCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	runPlayCmd(src, output, w, c.Filename, c.Tempo.LoadOr(0), "")
+}
+
+// PlayNoteBlockFromCmd is the command to play a noteblock song starting partway into it.
+type PlayNoteBlockFromCmd struct {
+	Filename string                `cmd:"filename"`
+	Start    string                `cmd:"start"`
+	Tempo    cmd.Optional[float64] `cmd:"tempo"`
+}
+
+// Run plays the song like PlayNoteBlockCmd, starting at the offset passed: a time such as "90s" or "1:30",
+// or a tick such as "600t". Plain numbers are taken as the tempo of PlayNoteBlockCmd instead, as that
+// overload comes first, which is why the offset needs its unit. The command description says so too.
+func (c PlayNoteBlockFromCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	runPlayCmd(src, output, w, c.Filename, c.Tempo.LoadOr(0), c.Start)
+}
+
+// runPlayCmd runs the playnoteblock command for the song with the name passed, at the tempo passed (0 for
+// the tempo of the song), starting at the offset passed (see parseOffset), if not empty.
+func runPlayCmd(src cmd.Source, output *cmd.Output, w *world.Tx, filename string, tempo float64, start string) {
+	p, ok := src.(*player.Player)
+	if ok {
+		if !checkCooldown(src, output, "playnoteblock") {
+			return
+		}
+		eh, tw, opts := p.H(), w.World(), PlaybackOptions{Tempo: tempo, Source: "command"}
+		name, err := resolveLastSong(eh, filename)
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		go func() {
+			song, err := loadSongWithProgress(eh, tw, name)
+			if err != nil {
+				messagePlayer(eh, fmt.Sprintf("§cFailed to load file: %v", err))
+				return
+			}
+			if start != "" {
+				if opts.StartTick, err = parseOffset(start, song, opts); err != nil {
+					messagePlayer(eh, fmt.Sprintf("§cCould not play %s: %v", song.displayName(), err))
+					return
+				}
+			}
+			if err := checkRequestHandle(eh, song, false); err != nil {
+				messagePlayer(eh, fmt.Sprintf("§cCould not play %s: %v", song.displayName(), err))
+				return
+			}
+			startCooldown(eh, "playnoteblock")
+			for _, warning := range song.Warnings {
+				messagePlayer(eh, "§eWarning: "+warning)
+			}
+			playSong(eh, song, opts)
+		}()
+		return
+	}
+	loadSongForCmd(src, w, filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		output.Printf("Song %s loaded, but playback is only supported for players", filename)
+	})
+}
+
+// StopNoteBlockCmd is the command to stop any currently playing noteblock song for the player.
+type StopNoteBlockCmd struct{}
+
+// AllowConsole allows this command from the server console.
+func (StopNoteBlockCmd) AllowConsole() bool { return true }
+
+// Run executes the stopnoteblock command; only works for players.
+func (c StopNoteBlockCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		fmt.Print("The stopnoteblock command is only valid for players")
+		return
+	}
+	if stopSong(p.H()) {
+		// output.Print("Song playback stopped")
+	} else {
+		// output.Print("No song is currently playing")
+	}
+}
+
+// ----------- Song Data Conversion & Control Utilities -----------
+
+// nbsConverter converts NBSData to Song struct for unified usage.
+func nbsConverter(nd *NBSData) *Song {
+	notes := make([]Note, len(nd.Notess))
+	for i, n := range nd.Notess {
+		notes[i] = Note{
+			Tick:       n.Tick,
+			Layer:      n.Layer,
+			Instrument: int(n.Instrument),
+			Key:        int(n.Key),
+			Velocity:   int(n.Velocity),
+			Panning:    int(n.Panning),
+			Pitch:      int(n.Pitch),
+		}
+	}
+	notes, tempoChanges := splitTempoChangers(notes, int(nd.VanillaInstruments), nd.CustomInstruments)
+	var instruments map[int]string
+	for i, name := range nd.CustomInstruments {
+		if strings.EqualFold(name, tempoChangerName) {
+			// Tempo changers are not played, they are kept in Song.TempoChanges.
+			continue
+		}
+		if instruments == nil {
+			instruments = make(map[int]string)
+		}
+		instruments[int(nd.VanillaInstruments)+i] = name
+	}
+	song := &Song{
+		Tempo:    float64(nd.Tempo),
+		Length:   int(nd.Length),
+		Notes:    notes,
+		Title:    nd.Title,
+		Author:   nd.Author,
+		Duration: float64(nd.Duration),
+		Version:  int(nd.Version),
+		Warnings: nd.Warnings,
+
+		OriginalAuthor: nd.OriginalAuthor,
+		Description:    nd.Description,
+		ImportName:     nd.ImportName,
+		TimeSignature:  int(nd.TimeSignature),
+
+		LoopEnabled:   nd.Loop,
+		LoopCount:     int(nd.MaxLoopCount),
+		LoopStartTick: int(nd.LoopStartTick),
+
+		TempoChanges:      tempoChanges,
+		CustomInstruments: instruments,
+	}
+	if len(tempoChanges) > 0 {
+		song.Duration = newTempoCurve(song, PlaybackOptions{}).elapsed(song.Length).Seconds()
+	}
+	return song
+}
+
+// stopSong signals the running playback (if exists) of the music channel to stop playing the song for a
+// given player, and clears the player's queue. Returns true if a song was stopped, false if not.
+func stopSong(eh *world.EntityHandle) bool {
+	clearQueue(eh)
+	return stopPlayback(musicKey(eh))
+}
+
+// stopPlayback signals the running playback with the key passed (if exists) to stop playing. Returns true if
+// a song was stopped, false if not.
+func stopPlayback(key playbackKey) bool {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	pb, ok := playbacks[key]
+	if ok {
+		pb.send(control{kind: controlStop})
+		delete(playbacks, key)
+	}
+	return ok
+}
+
+// controlPlayback sends a control message to the playback of the music channel of the player, if any.
+// Returns true if a song was playing.
+func controlPlayback(eh *world.EntityHandle, c control) bool {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	pb, ok := playbacks[musicKey(eh)]
+	if ok {
+		pb.send(c)
+	}
+	return ok
+}
+
+// ------------ Song Playback Utilities ------------
+
+// controlKind is the kind of a control message sent to a running playback.
+type controlKind int
+
+const (
+	controlStop controlKind = iota
+	controlReplace
+	controlPause
+	controlResume
+	controlSeek
+	controlHold
+	controlRelease
+)
+
+// control is a message sent to a running playback to change its state.
+type control struct {
+	kind controlKind
+	tick int // Target tick of controlSeek
+}
+
+// playback is a song being played to a player. Its state is changed by sending control messages,
+// which are handled by the goroutine running playSong.
+type playback struct {
+	// id is the unique ID of the playback, see StopPlayback.
+	id   int
+	eh   *world.EntityHandle
+	song *Song
+	opts PlaybackOptions
+	// control holds the seeks sent to the playback, see send.
+	control chan control
+	// done is closed once the playback ended.
+	done chan struct{}
+	// ending is closed once the playback must end, with endKind (controlStop or controlReplace) set right
+	// before. endOnce makes sure this only happens once.
+	ending  chan struct{}
+	endKind controlKind
+	endOnce sync.Once
+	// wantPaused and wantHeld are the paused and held states requested with control messages, which the
+	// playback applies once it is woken up through wake.
+	wantPaused, wantHeld atomic.Bool
+	wake                 chan struct{}
+
+	// playerName is the name of the player, resolved once when the playback starts.
+	playerName string
+
+	tick   atomic.Int64
+	paused atomic.Bool
+	layers *layerFilter
+
+	// held is true while the playback is paused for a playback of higher priority, and duck holds the bits of
+	// the float32 volume it is ducked to, see applyPriorities. holding is whether it should be held, which is
+	// guarded by playbacksMtx.
+	held    atomic.Bool
+	duck    atomic.Uint32
+	holding bool
+
+	// writers caches the player's session, memberWriters those of the members of their listening party,
+	// blockWriters those of the players hearing the note blocks with PlaybackOptions.NoteBlockPackets,
+	// pks and sounds are reused to batch the packets of every tick. played holds every sound name sent, so they can be
+	// cut off when the song is stopped. They are only used by the goroutine running playSong.
+	writers       writerCache
+	memberWriters map[*world.EntityHandle]*writerCache
+	blockWriters  map[*world.EntityHandle]*writerCache
+	pks           []packet.Packet
+	sounds        soundBuffer
+	played        map[string]struct{}
+	// prefs caches the volume and pitch preferences of the player and everyone else the notes are played to.
+	prefs prefsCache
+
+	// cur is the tick being played, and tickFunc and memberFunc the method values of execTick and
+	// execMember, created once per playback.
+	cur                  tickState
+	tickFunc, memberFunc func(tx *world.Tx, ent world.Entity)
+
+	// instruments holds the sounds the custom instruments of the song are played with.
+	instruments instrumentMap
+
+	// ctx is passed to the note middleware, and filtered holds the notes of the tick the middleware left.
+	// They are reused for every tick.
+	ctx      PlaybackContext
+	filtered []Note
+}
+
+// send sends a control message to the playback without blocking. Stopping, replacing, pausing and holding
+// the playback are never lost, even while the playback is busy: the latest state requested is applied as soon
+// as it waits for the next tick. Seeks are dropped if the playback has too many of them pending.
+func (pb *playback) send(c control) {
+	switch c.kind {
+	case controlStop, controlReplace:
+		pb.endOnce.Do(func() {
+			pb.endKind = c.kind
+			close(pb.ending)
+		})
+		return
+	case controlPause, controlResume:
+		pb.wantPaused.Store(c.kind == controlPause)
+	case controlHold, controlRelease:
+		pb.wantHeld.Store(c.kind == controlHold)
+	default:
+		select {
+		case pb.control <- c:
+		default:
+		}
+		return
+	}
+	select {
+	case pb.wake <- struct{}{}:
+	default:
+		// The playback was already woken up and reads the latest state once it is.
+	}
+}
+
+// playSong plays the given Song asynchronously for the provided EntityHandle (player).
+// Allows controlled stopping, pausing and seeking, handles tick timing, and message.
+// The PlaybackOptions passed decide how and where the notes are played.
+func playSong(eh *world.EntityHandle, song *Song, opts PlaybackOptions) {
+	newPlayback(eh, song, opts).run()
+}
+
+// newPlayback returns the playback of the song for the player, which replaces the song playing on the same
+// channel right away. The song starts playing once run is called.
+func newPlayback(eh *world.EntityHandle, song *Song, opts PlaybackOptions) *playback {
+	pb := &playback{
+		id:      int(lastPlaybackID.Add(1)),
+		eh:      eh,
+		song:    song,
+		opts:    opts,
+		control: make(chan control, 8),
+		done:    make(chan struct{}),
+		ending:  make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		layers:  newLayerFilter(opts.MutedLayers, opts.SoloLayers),
+
+		instruments: resolveInstruments(song),
+
+		memberWriters: make(map[*world.EntityHandle]*writerCache),
+		prefs:         make(prefsCache),
+		played:        make(map[string]struct{}),
+	}
+	pb.tickFunc, pb.memberFunc = pb.execTick, pb.execMember
+	pb.duck.Store(math.Float32bits(1))
+	_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		if pp, ok := ent.(*player.Player); ok {
+			pb.playerName = pp.Name()
+		}
+	})
+	key := pb.key()
+	playbacksMtx.Lock()
+	if old, ok := playbacks[key]; ok {
+		old.send(control{kind: controlReplace})
+	}
+	playbacks[key] = pb
+	playbacksMtx.Unlock()
+	applyPriorities(eh)
+	return pb
+}
+
+// key returns the key of the playback in playbacks.
+func (pb *playback) key() playbackKey {
+	return playbackKey{eh: pb.eh, channel: pb.opts.Channel}
+}
+
+// run plays the song of the playback until it finishes or is stopped or replaced.
+func (pb *playback) run() {
+	defer close(pb.done)
+	eh, song, opts := pb.eh, pb.song, pb.opts
+
+	tempo := newTempoCurve(song, opts) // Default: 20 ticks per second
+	notesPerTick := buildSchedule(song, opts)
+	var lyricsPerTick map[int]string
+	if opts.Lyrics != LyricsOff {
+		lyricsPerTick = lyricsSchedule(song)
+	}
+	markersPerTick := markerSchedule(song)
+	cuesPerTick := opts.Show.schedule(song)
+	automationPerTick := automationSchedule(song)
+
+	if opts.Announce {
+		announceSong(eh, song)
+	}
+	emitPlaybackEvent(pb, EventStart)
+	if opts.Channel == "" {
+		// Only music counts as played, not the jingles and ambience of other channels.
+		recordHistory(eh, song, opts)
+		// A play count that fails to save is still counted, and saved with the next play.
+		_ = countPlay(song)
+	}
+
+	// lastDisplay is when the opt-in displays were last refreshed.
+	var lastDisplay time.Time
+
+	// end is how the playback ended: controlStop, controlReplace, or -1 if the song finished.
+	end := controlKind(-1)
+
+	defer func() {
+		playbacksMtx.Lock()
+		if playbacks[pb.key()] == pb {
+			delete(playbacks, pb.key())
+		}
+		others := len(playbacksOf(eh)) > 0
+		playbacksMtx.Unlock()
+		applyPriorities(eh)
+		// A song replacing this one shows its own displays, so only clear them if that's not the case.
+		if end != controlReplace {
+			clearDisplays(eh, opts)
+		}
+		switch end {
+		case controlStop:
+			// Only cut off the sounds if the song was stopped, not when it was replaced by a new song. Sounds
+			// are cut off by name, so they are left alone while songs on other channels play them too.
+			if !others {
+				cutSounds(eh, pb.played)
+				for _, member := range partyMembers(eh) {
+					cutSounds(member, pb.played)
+				}
+			}
+			emitPlaybackEvent(pb, EventStop)
+		case controlReplace:
+			emitPlaybackEvent(pb, EventStop)
+		default:
+			emitPlaybackEvent(pb, EventFinish)
+			if opts.Channel == "" {
+				// Only the music channel plays the songs of the queue.
+				songFinished(eh, song, opts)
+			}
+		}
+	}()
+
+	// loops is how many more times the song loops, or -1 if it loops until it is stopped.
+	loops := songLoops(song, opts.Loop)
+	// jitter is the offset of the current tick with PlaybackOptions.HumanizeTiming.
+	var jitter time.Duration
+	for tick := min(max(opts.StartTick, 0), song.Length); tick <= song.Length; {
+		pb.tick.Store(int64(tick))
+		notes, line, cues := pb.applyMiddleware(tick, notesPerTick[tick]), lyricsPerTick[tick], cuesPerTick[tick]
+		display := (opts.BossBar || opts.Scoreboard) && time.Since(lastDisplay) >= displayInterval
+		if len(notes) > 0 || line != "" || len(cues) > 0 || display {
+			pb.playTick(tick, notes, line, cues, display)
+		}
+		for _, name := range markersPerTick[tick] {
+			emitMarkerEvent(pb, name)
+		}
+		if automation := automationPerTick[tick]; len(automation) > 0 {
+			emitAutomation(pb, automation)
+		}
+		if time.Since(lastDisplay) >= displayInterval {
+			emitPlaybackEvent(pb, EventProgress)
+			lastDisplay = time.Now()
+		}
+
+		// The duration of every tick follows the tempo changes of the song.
+		tickDuration := tempo.tickDuration(tick)
+		wait := swingDuration(tick, tickDuration, opts.Swing)
+		if opts.HumanizeTiming > 0 {
+			// Every tick is moved by its own offset, so the offsets don't add up over the song.
+			j := timingJitter(opts.HumanizeTiming, tickDuration)
+			wait, jitter = max(wait+j-jitter, 0), j
+		}
+		next, kind := pb.wait(wait, tick+1)
+		if kind == controlStop || kind == controlReplace {
+			end = kind
+			return
+		}
+		if next > song.Length && loops != 0 {
+			// The song continues at its loop start tick, like in Note Block Studio.
+			next = min(max(song.LoopStartTick, 0), song.Length)
+			if loops > 0 {
+				loops--
+			}
+		}
+		tick = next
+	}
+}
+
+// playTick plays the notes and shows the lyric line of a tick, calls the cues of its Show, and refreshes the
+// displays of the player if display is true, all in a single transaction of the player's world. Members of the player's listening
+// party in the same world are handled in that transaction too, so only members in other worlds need one of
+// their own.
+func (pb *playback) playTick(tick int, notes []Note, line string, cues []func(ShowContext), display bool) {
+	members := partyMembers(pb.eh)
+	pb.cur = tickState{
+		tick: tick, notes: notes, line: line, cues: cues, display: display, members: members,
+		// Members are played to separately if the player's entity is gone, so they still hear the song.
+		elsewhere: append(pb.cur.elsewhere[:0], members...),
+	}
+	_ = pb.eh.ExecWorld(pb.tickFunc)
+	for _, member := range pb.cur.elsewhere {
+		_ = member.ExecWorld(pb.memberFunc)
+	}
+}
+
+// tickState is the tick being played by playTick. It is kept in the playback, so that the functions
+// executed in the world don't need a closure allocated for every tick.
+type tickState struct {
+	tick    int
+	notes   []Note
+	line    string
+	cues    []func(ShowContext)
+	display bool
+
+	members, elsewhere []*world.EntityHandle
+}
+
+// execTick plays the current tick to the player and the members of their listening party in the same world,
+// leaving the other members in pb.cur.elsewhere. It is executed in the player's world.
+func (pb *playback) execTick(tx *world.Tx, ent world.Entity) {
+	cur := &pb.cur
+	cur.elsewhere = cur.elsewhere[:0]
+	if len(pb.opts.NoteBlocks) > 0 {
+		for _, note := range cur.notes {
+			if pb.layers.allows(note.Layer) {
+				playNoteBlock(tx, pb.opts.NoteBlocks, note, !pb.opts.NoteBlockPackets)
+			}
+		}
+		if pb.opts.NoteBlockPackets {
+			pb.playNoteBlockSounds(tx, cur.notes)
+		}
+	}
+	if pp, ok := ent.(*player.Player); ok {
+		if cur.display {
+			updateDisplays(pp, pb.song, pb.opts, cur.tick)
+		}
+		showLyric(pp, pb.opts.Lyrics, cur.line)
+		if len(pb.opts.NoteBlocks) == 0 {
+			pb.playNotes(pp, &pb.writers, cur.notes)
+		}
+		for _, cue := range cur.cues {
+			cue(ShowContext{Tx: tx, Player: pp, Song: pb.song, Tick: cur.tick})
+		}
+	}
+	for _, member := range cur.members {
+		if e, ok := member.Entity(tx); ok {
+			if mp, ok := e.(*player.Player); ok {
+				pb.playMember(mp, cur.notes, cur.line)
+			}
+			continue
+		}
+		cur.elsewhere = append(cur.elsewhere, member)
+	}
+}
+
+// execMember plays the current tick to a member of the player's listening party in another world. It is
+// executed in the member's world.
+func (pb *playback) execMember(tx *world.Tx, ent world.Entity) {
+	if mp, ok := ent.(*player.Player); ok {
+		pb.playMember(mp, pb.cur.notes, pb.cur.line)
+	}
+}
+
+// playMember plays the notes and shows the lyric line of a tick to a member of the player's listening
+// party. Members hear the same notes wherever they are.
+func (pb *playback) playMember(mp *player.Player, notes []Note, line string) {
+	c, ok := pb.memberWriters[mp.H()]
+	if !ok {
+		c = &writerCache{}
+		pb.memberWriters[mp.H()] = c
+	}
+	showLyric(mp, pb.opts.Lyrics, line)
+	pb.playNotes(mp, c, notes)
+}
+
+// playNotes writes the PlaySound packets of the notes of a tick to the player all at once, along with
+// the note particles if enabled, and adds the sound names sent to the sounds played.
+func (pb *playback) playNotes(pp *player.Player, c *writerCache, notes []Note) {
+	if len(notes) == 0 {
+		return
+	}
+	w, ok := c.writer(pp)
+	if !ok {
+		return
+	}
+	pos := pp.Position()
+	var right mgl64.Vec3
+	if pb.opts.Stereo != StereoOff {
+		right = stereoRight(pp.Rotation().Yaw())
+	}
+	volume, pitch := pb.prefs.get(pp.H())
+	pack := hasResourcePack(pp)
+	// mix is the volume of the channel, lowered while the playback is ducked.
+	mix := math.Float32frombits(pb.duck.Load()) * channelVolume(pb.opts.Channel)
+	pks := pb.pks[:0]
+	pb.sounds.reset()
+	for _, note := range notes {
+		if !pb.layers.allows(note.Layer) {
+			continue
+		}
+		instrument := pb.instruments.sound(note.Instrument, pack)
+		pks = appendNoteSound(pks, &pb.sounds, pb.opts.Stereo, instrument, pos, right, noteVolume(note)*volume*mix, notePitch(note, pitch), notePan(note))
+		pb.played[instrument] = struct{}{}
+		if pb.opts.Particles {
+			pks = append(pks, noteParticlePacket(note, pos))
+		}
+	}
+	writePackets(w, pks...)
+	logReplay(pp, pb.song, pb.cur.tick, pos, pks)
+	pb.pks = pks
+}
+
+// buildSchedule groups the notes of the song by the tick they are played at, after applying the
+// note changes of the PlaybackOptions passed (transposing, octave folding, instrument remapping). The
+// schedule is indexed by tick and covers at least the length of the song, and the notes of all ticks share
+// a single backing array. Automation notes are left out, as they are not played (see SetAutomationInstrument).
+func buildSchedule(song *Song, opts PlaybackOptions) [][]Note {
+	length := max(song.Length, 0)
+	for _, note := range song.Notes {
+		length = max(length, note.Tick)
+	}
+	echo := newEchoSettings(opts)
+	// The automation instrument is read once, so both passes over the notes leave out the same notes.
+	automation := AutomationInstrument()
+	counts := make([]int, length+1)
+	total := 0
+	for _, note := range song.Notes {
+		if note.Tick < 0 || (automation >= 0 && note.Instrument == automation) {
+			continue
+		}
+		counts[note.Tick]++
+		total++
+		for k := 1; k <= echo.count && note.Tick+k*echo.delay <= length; k++ {
+			counts[note.Tick+k*echo.delay]++
+			total++
+		}
+	}
+	notes := make([]Note, total)
+	notesPerTick := make([][]Note, length+1)
+	offset := 0
+	for tick, n := range counts {
+		notesPerTick[tick] = notes[offset : offset : offset+n]
+		offset += n
+	}
+	for _, note := range song.Notes {
+		if note.Tick < 0 || (automation >= 0 && note.Instrument == automation) {
+			continue
+		}
+		if opts.Transpose != 0 {
+			note.Key = transposeKey(note.Key, opts.Transpose)
+		}
+		if opts.FoldOctaves {
+			note.Key = foldKey(note.Key, minVanillaKey, maxVanillaKey)
+		}
+		if len(opts.Instruments) > 0 {
+			note.Instrument = remapInstrument(note.Instrument, opts.Instruments)
+		}
+		if opts.HumanizeVelocity > 0 {
+			note.Velocity = humanizeVelocity(note.Velocity, opts.HumanizeVelocity)
+		}
+		notesPerTick[note.Tick] = append(notesPerTick[note.Tick], note)
+		for k := 1; k <= echo.count && note.Tick+k*echo.delay <= length; k++ {
+			e, ok := echo.note(note, k)
+			if !ok {
+				break
+			}
+			notesPerTick[e.Tick] = append(notesPerTick[e.Tick], e)
+		}
+	}
+	return notesPerTick
+}
+
+// wait sleeps for the duration of a tick while handling the control messages sent to the playback.
+// It returns the tick to play next, which is normally the tick passed unless the playback was seeked,
+// and controlStop or controlReplace if the playback must end.
+func (pb *playback) wait(d time.Duration, next int) (int, controlKind) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	deadline := time.Now().Add(d)
+
+	var remaining time.Duration
+	for {
+		var timeout <-chan time.Time
+		if !pb.halted() {
+			timeout = timer.C
+		}
+		// Ending the playback comes before any seek still pending.
+		select {
+		case <-pb.ending:
+			return next, pb.endKind
+		default:
+		}
+		select {
+		case <-pb.ending:
+			return next, pb.endKind
+		case <-pb.wake:
+			halted := pb.halted()
+			paused, held := pb.wantPaused.Load(), pb.wantHeld.Load()
+			if pb.paused.Swap(paused) != paused {
+				if paused {
+					emitPlaybackEvent(pb, EventPause)
+				} else {
+					emitPlaybackEvent(pb, EventResume)
+				}
+			}
+			pb.held.Store(held)
+			switch {
+			case !halted && pb.halted():
+				remaining = time.Until(deadline)
+				timer.Stop()
+			case halted && !pb.halted():
+				deadline = time.Now().Add(remaining)
+				timer.Reset(remaining)
+			}
+		case c := <-pb.control:
+			// Seeking keeps the playback paused if it was, the new tick is played once it is resumed.
+			next = min(max(c.tick, 0), pb.song.Length)
+			pb.tick.Store(int64(next))
+			emitPlaybackEvent(pb, EventSeek)
+			if !pb.halted() {
+				return next, controlSeek
+			}
+		case <-timeout:
+			return next, -1
+		}
+	}
+}
+
+// halted reports whether the playback is paused, or held for a playback of higher priority.
+func (pb *playback) halted() bool {
+	return pb.paused.Load() || pb.held.Load()
+}
+
+// playNote plays a single note to the player at their position. Returns false if the player's
+// entity no longer exists.
+func playNote(eh *world.EntityHandle, note Note) bool {
+	return eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		if pp, ok := ent.(*player.Player); ok {
+			PacketPlaySound(pp, instrumentSoundName(note.Instrument), notePitch(note, 0), noteVolume(note), pp.Position())
+		}
+	})
+}
+
+// instrumentSoundName returns the Bedrock sound name for an instrument index: the name set with
+// SetInstrumentSoundName if any, otherwise its vanilla note sound, falling back to the harp for unknown
+// instruments.
+func instrumentSoundName(instrument int) string {
+	if name, ok := customSoundName(instrument); ok {
+		return name
+	}
+	if instrument >= 0 && instrument < len(instrumentSoundNames) {
+		return instrumentSoundNames[instrument]
+	}
+	return instrumentSoundNames[0]
+}
+
+// cutSounds sends a StopSound packet for every sound name passed, so that long-tail sounds
+// (bell, chimes) don't keep ringing after the song was stopped.
+func cutSounds(eh *world.EntityHandle, names map[string]struct{}) {
+	if len(names) == 0 {
+		return
+	}
+	_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		pp, ok := ent.(*player.Player)
+		if !ok {
+			return
+		}
+		for name := range names {
+			PacketStopSound(pp, name)
+		}
+	})
+}
+
+// PitchKey calculates the Bedrock note pitch index based on the NBS note key.
+// Bedrock's base is 33 (F#3).
+func PitchKey(key int) int {
+	base := 33 // F#3 is key 33 in Bedrock
+	return key - base
+}
+
+// Bedrock "note" starts at key 33 (F#3). Each +12 is one octave (double freq/float).
+//
+// F#3 = 0.5, F#4 = 1.0, F#5 = 2.0, etc.
+//
+// So, the formulat is: 0.5 * 2^((key-33)/12)
+func Floatkey(key int) float32 {
+	baseKey := 33
+	return float32(0.5 * math.Pow(2, float64(key-baseKey)/12))
+}
+
+// FloatVel converts NBS/JSON note velocity (0-100) to Bedrock/Dragonfly volume [0.0, 1.0].
+// Values below or equal 0 are muted; above 100 are clamped to 1.0
+func FloatVel(val int) float32 {
+	if val <= 0 {
+		return 0
+	}
+	if val >= 100 {
+		return 1.0
+	}
+	return float32(val) / 100.0
+}
+
+// Pow is a helper function alias for math.Pow (for convenience).
+func Pow(base, exp float64) float64 {
+	return math.Pow(base, exp)
+}
+
+// --------------- Function Call Helper ----------------------
+
+// PlayNoteblock is a helper function to programmatically play a song file for a player.
+//
+// Accepts player handle (EntityHandle) and file name (string, path relative to "noteblock" folder or base folder).
+// Supported formats: ".nbs" (Noteblock Studio), ".json" (custom Song struct).
+//
+// Returns error if loading or playback fails. Errors wrap ErrSongNotFound, ErrUnsupportedFormat or
+// ErrCorruptNBS, so the reason can be checked with errors.Is.
+// Example usage (from any Go function with *player.Player object `p`):
+//
+//	err := PlayNoteblock(p.H(), "my_song.nbs")
+//	if err != nil {
+//	    // handle error
+//	}
+//
+// Note: This helper does not send a chat message to the player! (Unlike the command.)
+func PlayNoteblock(eh *world.EntityHandle, filename string) error {
+	return PlayNoteblockWithOptions(eh, filename, PlaybackOptions{})
+}
+
+// PlayNoteblockWithOptions works like PlayNoteblock, but applies the PlaybackOptions passed to the playback.
+//
+// Example usage (play a song through the note blocks placed between two corners):
+//
+//	blocks, err := FindNoteBlocks(tx, cornerA, cornerB)
+//	if err != nil {
+//	    // handle error
+//	}
+//	_ = PlayNoteblockWithOptions(p.H(), "my_song.nbs", PlaybackOptions{
+//	    NoteBlocks: blocks,
+//	})
+func PlayNoteblockWithOptions(eh *world.EntityHandle, filename string, opts PlaybackOptions) error {
+	if opts.NoReplace && isPlayingOn(eh, opts.Channel) {
+		return ErrAlreadyPlaying
+	}
+	song, err := flexSongLoader(filename)
+	if err != nil {
+		return err
+	}
+	go playSong(eh, song, opts)
+	return nil
+}
+
+// StopNoteblock is a helper function to stop the currently playing noteblock song for a player.
+//
+// Accepts player handle (EntityHandle).
+// Returns true if a song was stopped, false if no song was playing.
+//
+// Example usage (from any Go function with *player.Player object `p`):
+//
+//	success := StopNoteblock(p.H())
+//	if success {
+//	    // song stopped
+//	} else {
+//	    // no song was playing
+//	}
+func StopNoteblock(eh *world.EntityHandle) bool {
+	return stopSong(eh)
+}
+
+// PauseNoteblock pauses the song currently playing for the player. It can be continued with ResumeNoteblock.
+// Returns true if a song was playing.
+func PauseNoteblock(eh *world.EntityHandle) bool {
+	return controlPlayback(eh, control{kind: controlPause})
+}
+
+// ResumeNoteblock resumes the song paused with PauseNoteblock for the player.
+// Returns true if a song was playing.
+func ResumeNoteblock(eh *world.EntityHandle) bool {
+	return controlPlayback(eh, control{kind: controlResume})
+}
+
+// SeekNoteblock makes the song currently playing for the player jump to the tick passed. Ticks outside
+// the song are clamped to its start or end. Returns true if a song was playing.
+func SeekNoteblock(eh *world.EntityHandle, tick int) bool {
+	return controlPlayback(eh, control{kind: controlSeek, tick: tick})
+}
+
+// QueueNoteblock loads a song file and adds it to the end of the player's queue. Queued songs are played
+// one after another once the current song finishes. If no song is playing, it starts playing right away.
+//
+// Returns error if loading fails.
+func QueueNoteblock(eh *world.EntityHandle, filename string) error {
+	song, err := flexSongLoader(filename)
+	if err != nil {
+		return err
+	}
+	queueSong(eh, song, PlaybackOptions{})
+	return nil
+}
@@ -0,0 +1,160 @@
+package noteblockplayer
+
+import (
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+)
+
+// PlaybackOptions holds the optional settings of a single song playback.
+// The zero value plays the song directly to the player, which is what PlayNoteblock does.
+type PlaybackOptions struct {
+	// NoteBlocks, if not empty, plays the song through the note blocks placed at these positions in the
+	// player's world instead of sending the sounds to the player only. Every layer of the song is bound to
+	// one of the note blocks, which is tuned and triggered for each of its notes, so that everyone nearby
+	// can see and hear the performance. Use FindNoteBlocks to collect the note blocks of a region.
+	NoteBlocks []cube.Pos
+	// NoteBlockPackets sends the sounds of the NoteBlocks as PlaySound packets to the players nearby instead
+	// of playing the vanilla note block sound, while the note blocks are still tuned and triggered. Like the
+	// songs played to players, the sounds then follow the velocity and fine pitch of the notes and the sound
+	// names set with SetInstrumentSoundName, and can play custom instruments.
+	NoteBlockPackets bool
+	// Particles shows the vanilla note particle, coloured by pitch, for every note played. Notes played to
+	// the player directly show the particle above the player's head, while notes played through note blocks
+	// always show it above the note block.
+	Particles bool
+	// BossBar shows a boss bar with the song title and the playback progress to the player. It is
+	// refreshed every second and removed once the song finishes or is stopped.
+	BossBar bool
+	// Scoreboard shows a "Now Playing" sidebar with the song title, the elapsed time and the next song of
+	// the queue to the player.
+	// It is refreshed by the playback itself every second and removed once the song finishes or is stopped.
+	Scoreboard bool
+	// Announce shows a "Now Playing" title to the player when the song starts, with the song title and
+	// author as subtitle.
+	Announce bool
+	// Transpose shifts every note of the song by this number of semitones while playing, without changing
+	// the song itself. See Song.Transpose.
+	Transpose int
+	// FoldOctaves moves notes outside of the two octaves a vanilla note block can play (F#3 to F#5) into
+	// that range by whole octaves, like Note Block Studio does, instead of sending pitches the vanilla
+	// sounds were not made for. Notes played through note blocks are always folded.
+	FoldOctaves bool
+	// Tempo, if above zero, overrides the tempo of the song in ticks per second, so a song can be played
+	// faster or slower without editing the file.
+	Tempo float64
+	// Swing delays every off-beat tick (every second tick) by this fraction of a tick, from 0 to 0.9, and
+	// shortens the tick after it by the same amount, so straight songs are played with a swung feel while
+	// their length stays the same. 0.33 gives a triplet feel.
+	Swing float64
+	// HumanizeTiming moves every tick by a random time of up to this duration earlier or later, at most half
+	// a tick, so mechanical songs such as MIDI conversions sound less robotic. The song keeps its length.
+	HumanizeTiming time.Duration
+	// HumanizeVelocity changes the velocity of every note by a random amount of up to this many points
+	// (out of 100) up or down.
+	HumanizeVelocity int
+	// EchoCount plays every note this many times more, each EchoDelay ticks after the previous one and at
+	// EchoDecay times its volume, to simulate the reverb of a cave or arena. Echoes past the end of the song
+	// are not played.
+	EchoCount int
+	// EchoDelay is the number of ticks between the echoes of a note. It defaults to 2 ticks.
+	EchoDelay int
+	// EchoDecay is the fraction of the volume every echo keeps of the one before it, from 0 to 1. It defaults
+	// to 0.5.
+	EchoDecay float64
+	// MutedLayers are the layers of the song that are not played. They can be changed while the song is
+	// playing with MuteLayer.
+	MutedLayers []int
+	// SoloLayers, if not empty, are the only layers of the song that are played. They can be changed while
+	// the song is playing with SoloLayer.
+	SoloLayers []int
+	// Instruments remaps the instruments of the song while playing, without changing the song itself. Keys
+	// and values are instrument indices (0 is Piano, 15 is Pling), so {0: 15} plays every Piano note on
+	// Pling. The AnyInstrument key remaps every instrument that has no entry of its own, so
+	// {AnyInstrument: 13} plays the whole song on Bit.
+	Instruments map[int]int
+	// Stereo decides how the panning of notes is reproduced when the song is played directly to the player.
+	// See StereoMode. Notes played through note blocks always come from the note block itself.
+	Stereo StereoMode
+	// Lyrics shows the lyrics of the song, if it has any, in chat or above the hotbar in sync with the
+	// notes. Lyrics are loaded from a "<name>.lrc" or "<name>.lyrics.json" file next to the song.
+	Lyrics LyricsMode
+	// Source describes what started the playback, for example "command" or "ambient". It is shown by the
+	// /nbactive command and ActivePlaybacks, which report an empty source as "api".
+	Source string
+	// Loop decides whether the song loops once it ends. By default the loop settings of the song are
+	// followed (see Song.LoopEnabled). See LoopMode.
+	Loop LoopMode
+	// StartTick is the tick the song starts playing at, to start partway into it. Ticks past the end of the
+	// song start at its last tick. Loops always continue at the loop start tick of the song.
+	StartTick int
+	// NoReplace makes PlayNoteblockWithOptions return ErrAlreadyPlaying if a song is already playing for the
+	// player on the same channel, instead of replacing it.
+	NoReplace bool
+	// Channel is the channel the song plays on. A player has one playback per channel: a song only replaces
+	// the song playing on its own channel, so songs on different channels, such as background music and a
+	// jingle, play at the same time. The empty default channel is the music channel, which is the one the
+	// commands, the queue, and functions such as PauseNoteblock and SeekNoteblock control. See PlaySong for
+	// controlling the songs of other channels.
+	Channel string
+	// Priority is the priority of the song over the songs playing to the player on other channels. While it
+	// plays, the songs with a lower priority are ducked or paused, as set by LowerChannels, and they are
+	// restored once it ends. Songs have priority 0 by default, so they play alongside each other unchanged.
+	Priority int
+	// LowerChannels decides what happens to the songs with a lower priority while the song plays. See
+	// ChannelAction.
+	LowerChannels ChannelAction
+	// DuckVolume is the volume, from 0 to 1, that songs with a lower priority are ducked to while the song
+	// plays with DuckLower. It defaults to 0.3.
+	DuckVolume float64
+	// Show, if set, calls the effects of the Show at the ticks and markers they are bound to, inside the
+	// world transaction of the player, so light shows stay in sync with the music.
+	Show *Show
+	// Middleware is called for every note of the song before it is played, after the middleware registered
+	// with UseNoteMiddleware. See NoteMiddleware.
+	Middleware []NoteMiddleware
+}
+
+// LoopMode decides whether a song loops once it ends.
+type LoopMode int
+
+const (
+	// LoopAsSong loops the song the way its loop settings say. This is the default.
+	LoopAsSong LoopMode = iota
+	// LoopOff plays the song once, even if it has looping enabled.
+	LoopOff
+	// LoopForever loops the song from its loop start tick until it is stopped, even if it has looping
+	// disabled.
+	LoopForever
+)
+
+// songLoops returns how many times the song loops with the LoopMode passed, or -1 if it loops forever.
+func songLoops(song *Song, mode LoopMode) int {
+	switch {
+	case mode == LoopOff:
+		return 0
+	case mode == LoopForever:
+		return -1
+	case !song.LoopEnabled:
+		return 0
+	case song.LoopCount == 0:
+		return -1
+	default:
+		return song.LoopCount
+	}
+}
+
+// AnyInstrument is the key of PlaybackOptions.Instruments that matches every instrument.
+const AnyInstrument = -1
+
+// remapInstrument returns the instrument that the instrument passed is played on according to the
+// remapping table passed.
+func remapInstrument(instrument int, table map[int]int) int {
+	if to, ok := table[instrument]; ok {
+		return to
+	}
+	if to, ok := table[AnyInstrument]; ok {
+		return to
+	}
+	return instrument
+}
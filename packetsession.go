@@ -1,64 +1,202 @@
-package noteblockplayer
-
-import (
-	"reflect"
-	"unsafe"
-
-	"github.com/df-mc/dragonfly/server/player"
-	"github.com/go-gl/mathgl/mgl64"
-	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
-)
-
-// PacketPlaySound sends a PlaySound packet directly to the player's session connection.
-//
-// This function takes a player pointer (p), the sound name (name), float32 pitch and volume,
-// and a 3D position (pos, mgl64.Vec3). It first converts the position to [3]float32 as required
-// by the network packet.
-//
-// Then, using Go reflection and pointer-unsafe tricks, it accesses the unexported player session
-// field "s" and attempts to invoke the "WritePacket" method on it. If not directly available, it
-// tries to extract the connection object (field "conn") and invoke "WritePacket" on that.
-//
-// Ultimately, this method delivers the PlaySound packet to the player, which makes the sound
-// play at the specified position with the given pitch and volume from the server side.
-// This bypasses higher level APIs and directly calls the underlying session, which is
-// useful for custom, low-level sound triggers in plugins or game logic.
-func PacketPlaySound(p *player.Player, name string, pitch, volume float32, pos mgl64.Vec3) {
-	mgl32Pos := [3]float32{float32(pos[0]), float32(pos[1]), float32(pos[2])}
-
-	val := reflect.ValueOf(p).Elem().FieldByName("s")
-	if !val.IsValid() {
-		return
-	}
-
-	sessionPtr := reflect.NewAt(val.Type(), unsafe.Pointer(val.UnsafeAddr())).Elem()
-
-	method := sessionPtr.MethodByName("WritePacket")
-	if method.IsValid() {
-		method.Call([]reflect.Value{
-			reflect.ValueOf(&packet.PlaySound{
-				SoundName: name,
-				Volume:    volume, // float32
-				Pitch:     pitch,  // float32
-				Position:  mgl32Pos,
-			}),
-		})
-		return
-	}
-
-	connField := sessionPtr.Elem().FieldByName("conn")
-	if connField.IsValid() {
-		conn := reflect.NewAt(connField.Type(), unsafe.Pointer(connField.UnsafeAddr())).Elem()
-		writeMethod := conn.MethodByName("WritePacket")
-		if writeMethod.IsValid() {
-			writeMethod.Call([]reflect.Value{
-				reflect.ValueOf(&packet.PlaySound{
-					SoundName: name,
-					Volume:    volume, // float32
-					Pitch:     pitch,  // float32
-					Position:  mgl32Pos,
-				}),
-			})
-		}
-	}
-}
+package noteblockplayer
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// PacketWriter is anything able to deliver a packet to the client of a single player.
+// A gophertunnel *minecraft.Conn satisfies this interface, as does any wrapper the host keeps around
+// its player connections.
+type PacketWriter interface {
+	WritePacket(pk packet.Packet) error
+}
+
+// packetWriters holds the packet writers registered by the host per player.
+// packetWritersMtx protects access to packetWriters.
+var (
+	packetWriters    = make(map[*world.EntityHandle]PacketWriter)
+	packetWritersMtx sync.RWMutex
+)
+
+// unsafeFallbackDisabled controls whether the reflection-based session access is skipped for players that
+// have no PacketWriter registered. The fallback is enabled by default to stay compatible with hosts that
+// never register one.
+var unsafeFallbackDisabled atomic.Bool
+
+// SetPacketWriter registers the PacketWriter used to send packets to the player behind the given handle.
+// Registered writers always take precedence over the reflection-based fallback.
+//
+// Example usage (from a host that keeps its own connections):
+//
+//	noteblockplayer.SetPacketWriter(p.H(), conn)
+func SetPacketWriter(eh *world.EntityHandle, w PacketWriter) {
+	packetWritersMtx.Lock()
+	defer packetWritersMtx.Unlock()
+	packetWriters[eh] = w
+}
+
+// RemovePacketWriter removes the PacketWriter registered for the player, for example when they quit.
+func RemovePacketWriter(eh *world.EntityHandle) {
+	packetWritersMtx.Lock()
+	defer packetWritersMtx.Unlock()
+	delete(packetWriters, eh)
+}
+
+// SetUnsafeFallback enables or disables the reflection-based session access used for players without a
+// registered PacketWriter. When disabled, packets to such players are dropped.
+func SetUnsafeFallback(enabled bool) {
+	unsafeFallbackDisabled.Store(!enabled)
+}
+
+// registeredWriter returns the PacketWriter registered for the handle, if any.
+func registeredWriter(eh *world.EntityHandle) (PacketWriter, bool) {
+	packetWritersMtx.RLock()
+	defer packetWritersMtx.RUnlock()
+	w, ok := packetWriters[eh]
+	return w, ok
+}
+
+// writePacket delivers a packet to the player, preferring the registered PacketWriter and only
+// falling back to the unsafe session access if allowed. The writer is looked up again for every packet, so
+// code sending many packets to a player keeps a writerCache instead. Returns true if the packet was written.
+func writePacket(p *player.Player, pk packet.Packet) bool {
+	w, ok := lookupWriter(p)
+	if !ok {
+		return false
+	}
+	return w.WritePacket(pk) == nil
+}
+
+// lookupWriter returns the PacketWriter to use for the player: the registered writer if any, otherwise the
+// session of the player accessed through reflection, unless the fallback was disabled.
+func lookupWriter(p *player.Player) (PacketWriter, bool) {
+	if w, ok := registeredWriter(p.H()); ok {
+		return w, true
+	}
+	if unsafeFallbackDisabled.Load() {
+		return nil, false
+	}
+	return unsafeWriter(p)
+}
+
+// writerCache caches the PacketWriter resolved through the unsafe session access for a single player,
+// so the reflection round-trip happens once per playback instead of once per packet. It is kept by the code
+// sending the packets, such as a playback, for as long as it sends packets to the player.
+type writerCache struct {
+	session PacketWriter
+}
+
+// writer returns the PacketWriter to use for the player. Registered writers are looked up every time,
+// so that a writer registered while a song is playing is picked up immediately.
+func (c *writerCache) writer(p *player.Player) (PacketWriter, bool) {
+	if w, ok := registeredWriter(p.H()); ok {
+		return w, true
+	}
+	if unsafeFallbackDisabled.Load() {
+		return nil, false
+	}
+	if c.session == nil {
+		w, ok := unsafeWriter(p)
+		if !ok {
+			return nil, false
+		}
+		c.session = w
+	}
+	return c.session, true
+}
+
+// writePackets writes all packets passed to the writer, one after another. They are not flushed, so the
+// packets of a tick are sent in the next network batch of the session together with its other packets.
+// Returns true if all packets were written.
+func writePackets(w PacketWriter, pks ...packet.Packet) bool {
+	for _, pk := range pks {
+		if err := w.WritePacket(pk); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// unsafeWriter accesses the unexported player session field "s" using reflection and unsafe
+// pointers, and returns either the session itself or its "conn" field as a PacketWriter.
+//
+// Every step is checked, and any panic caused by a changed Dragonfly layout is recovered, so that
+// an incompatible Dragonfly version results in dropped packets rather than a crashed server.
+func unsafeWriter(p *player.Player) (w PacketWriter, ok bool) {
+	defer func() {
+		if recover() != nil {
+			w, ok = nil, false
+		}
+	}()
+
+	val := reflect.ValueOf(p).Elem().FieldByName("s")
+	if !val.IsValid() || val.Kind() != reflect.Pointer || val.IsNil() {
+		return nil, false
+	}
+
+	sessionPtr := reflect.NewAt(val.Type(), unsafe.Pointer(val.UnsafeAddr())).Elem()
+	if w, ok := sessionPtr.Interface().(PacketWriter); ok {
+		return w, true
+	}
+
+	session := sessionPtr.Elem()
+	if session.Kind() != reflect.Struct {
+		return nil, false
+	}
+	connField := session.FieldByName("conn")
+	if !connField.IsValid() {
+		return nil, false
+	}
+	conn := reflect.NewAt(connField.Type(), unsafe.Pointer(connField.UnsafeAddr())).Elem()
+	if conn.Kind() == reflect.Interface && conn.IsNil() {
+		return nil, false
+	}
+	w, ok = conn.Interface().(PacketWriter)
+	return w, ok
+}
+
+// PacketPlaySound sends a PlaySound packet directly to the player's client.
+//
+// This function takes a player pointer (p), the sound name (name), float32 pitch and volume,
+// and a 3D position (pos, mgl64.Vec3). It first converts the position to [3]float32 as required
+// by the network packet.
+//
+// The packet is delivered through the PacketWriter registered for the player with SetPacketWriter.
+// If none is registered, and the unsafe fallback has not been disabled with SetUnsafeFallback, the
+// unexported player session is accessed through reflection instead.
+//
+// Ultimately, this method delivers the PlaySound packet to the player, which makes the sound
+// play at the specified position with the given pitch and volume from the server side.
+func PacketPlaySound(p *player.Player, name string, pitch, volume float32, pos mgl64.Vec3) {
+	TryPacketPlaySound(p, name, pitch, volume, pos)
+}
+
+// TryPacketPlaySound sends a PlaySound packet to the player's client like PacketPlaySound, and returns true
+// if the packet was written, or false if no PacketWriter could be found for the player or writing failed.
+func TryPacketPlaySound(p *player.Player, name string, pitch, volume float32, pos mgl64.Vec3) bool {
+	mgl32Pos := [3]float32{float32(pos[0]), float32(pos[1]), float32(pos[2])}
+	return writePacket(p, &packet.PlaySound{
+		SoundName: name,
+		Volume:    volume, // float32
+		Pitch:     pitch,  // float32
+		Position:  mgl32Pos,
+	})
+}
+
+// PacketStopSound sends a StopSound packet directly to the player's client, cutting off the sound
+// with the given name if it is still playing. Passing an empty name stops all sounds.
+// The packet is delivered the same way as in PacketPlaySound. Returns true if the packet was written.
+func PacketStopSound(p *player.Player, name string) bool {
+	return writePacket(p, &packet.StopSound{
+		SoundName: name,
+		StopAll:   name == "",
+	})
+}
@@ -0,0 +1,161 @@
+package noteblockplayer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// packManifestFile is the name of the manifest file at the root of a song pack.
+const packManifestFile = "pack.json"
+
+// PackManifest describes a song pack: a .zip file in a song folder holding many songs. Songs in a pack are
+// played by "pack:song", where pack is the file name of the pack without .zip and song the name of the
+// song in the manifest.
+type PackManifest struct {
+	// Name is the file name of the pack without .zip. It is not read from the manifest.
+	Name        string `json:"-"`
+	Title       string `json:"title,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+	// Songs are the songs in the pack. Packs without a manifest, or with a manifest without songs, list
+	// every .nbs and .json file in the pack, named by their file name without extension.
+	Songs []PackSong `json:"songs,omitempty"`
+}
+
+// PackSong is a song in a song pack.
+type PackSong struct {
+	// Name is the name the song is played by, after the "pack:" prefix.
+	Name string `json:"name"`
+	// File is the path of the song file in the pack.
+	File string `json:"file"`
+}
+
+// findPack returns the path and file info of the pack with the name passed in the song folders.
+func findPack(name string, w *world.World) (string, fs.FileInfo, error) {
+	for _, dir := range searchDirs(w) {
+		p := filepath.Join(dir, name+".zip")
+		if info, err := os.Stat(p); err == nil {
+			return p, info, nil
+		}
+	}
+	for _, dir := range searchDirs(w) {
+		if file, ok := findFileFold(dir, name+".zip"); ok {
+			p := filepath.Join(dir, file)
+			if info, err := os.Stat(p); err == nil {
+				return p, info, nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("%w: pack %q not found", ErrSongNotFound, name)
+}
+
+// readPackManifest reads the manifest of the pack with the name passed from its zip reader.
+func readPackManifest(name string, zr *zip.Reader) (*PackManifest, error) {
+	m := &PackManifest{}
+	data, err := fs.ReadFile(zr, packManifestFile)
+	if err == nil {
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", packManifestFile, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	m.Name = name
+	if len(m.Songs) == 0 {
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() && isSongFile(f.Name) {
+				base := path.Base(f.Name)
+				m.Songs = append(m.Songs, PackSong{Name: strings.TrimSuffix(base, path.Ext(base)), File: f.Name})
+			}
+		}
+	}
+	return m, nil
+}
+
+// loadPackSong loads the song with the name passed from the pack with the name passed, without extracting
+// the pack to disk. The pack is searched in the song folders of the world passed (if not nil) first. NBS
+// files are parsed with the ParseOptions passed.
+func loadPackSong(pack, name string, w *world.World, progress func(read, total int64), opts ParseOptions) (*Song, error) {
+	name = strings.TrimSuffix(name, ".json")
+	name = strings.TrimSuffix(name, ".nbs")
+	p, info, err := findPack(pack, w)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPackFile(p, info); err != nil {
+		return nil, fmt.Errorf("pack %q: %w", pack, err)
+	}
+	return cachedSong(cacheKey(p+":"+name, opts), info, func() (*Song, error) {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		m, err := readPackManifest(pack, &zr.Reader)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range m.Songs {
+			if strings.EqualFold(s.Name, name) {
+				return loadSongFile(zr, s.File, pack+":"+s.Name, progress, opts)
+			}
+		}
+		return nil, fmt.Errorf("%w: %q not found in pack %q", ErrSongNotFound, name, pack)
+	})
+}
+
+// ListPacks returns the manifests of all song packs in the song folders, sorted by name. If multiple
+// folders hold a pack with the same name, the first one is listed. Packs without a valid signature are left
+// out while a pack public key is set (see SetPackPublicKey).
+func ListPacks() ([]*PackManifest, error) {
+	var packs []*PackManifest
+	seen := make(map[string]bool)
+	for _, dir := range searchDirs(nil) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || !strings.EqualFold(filepath.Ext(e.Name()), ".zip") {
+				continue
+			}
+			name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			p := filepath.Join(dir, e.Name())
+			if info, err := e.Info(); err != nil || verifyPackFile(p, info) != nil {
+				continue
+			}
+			m, err := openPackManifest(p, name)
+			if err != nil {
+				return nil, fmt.Errorf("pack %s: %w", name, err)
+			}
+			packs = append(packs, m)
+		}
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+	return packs, nil
+}
+
+// openPackManifest opens the pack at the path passed and reads its manifest.
+func openPackManifest(p, name string) (*PackManifest, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return readPackManifest(name, &zr.Reader)
+}
@@ -0,0 +1,53 @@
+package noteblockplayer
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// noteParticleName is the name of the vanilla note particle effect.
+const noteParticleName = "minecraft:note_particle"
+
+// noteParticleHeight is how far above the listener's feet the note particle is spawned, just above the head.
+const noteParticleHeight = 2.2
+
+// noteColour returns the RGB colour of the note particle for a note block pitch (0-24), following the
+// vanilla colour wheel: the colour cycles once through all hues over the two octaves.
+func noteColour(pitch int) (r, g, b float64) {
+	f := float64(pitch) / 24
+	channel := func(offset float64) float64 {
+		return math.Max(0, math.Sin((f+offset)*math.Pi*2)*0.65+0.35)
+	}
+	return channel(0), channel(1.0 / 3), channel(2.0 / 3)
+}
+
+// molangColour encodes a MoLang "variable.color" struct variable holding the colour passed.
+func molangColour(r, g, b float64) []byte {
+	member := func(name string, v float64) map[string]any {
+		return map[string]any{"name": name, "value": map[string]any{"type": "float", "value": v}}
+	}
+	data, _ := json.Marshal([]any{map[string]any{
+		"name": "variable.color",
+		"value": map[string]any{
+			"type":  "member_array",
+			"value": []any{member(".r", r), member(".g", g), member(".b", b), member(".a", 1)},
+		},
+	}})
+	return data
+}
+
+// noteParticlePacket returns a packet spawning a note particle, coloured by the note's pitch, above the position passed.
+func noteParticlePacket(note Note, pos mgl64.Vec3) *packet.SpawnParticleEffect {
+	r, g, b := noteColour(noteBlockPitch(note.Key))
+	return &packet.SpawnParticleEffect{
+		EntityUniqueID:  -1,
+		Position:        mgl32.Vec3{float32(pos[0]), float32(pos[1] + noteParticleHeight), float32(pos[2])},
+		ParticleName:    noteParticleName,
+		MoLangVariables: protocol.Option(molangColour(r, g, b)),
+	}
+}
@@ -0,0 +1,327 @@
+package noteblockplayer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// ListeningParty is a shared listening session. Every song played to the host, with PlayNoteblock or any
+// other way, is also heard by all members of the party, wherever they are. The members follow the host's
+// playback, so only the host can pause, seek or stop it.
+type ListeningParty struct {
+	host *world.EntityHandle
+
+	mu       sync.Mutex
+	hostName string
+	members  map[*world.EntityHandle]struct{}
+	invites  map[*world.EntityHandle]struct{}
+}
+
+// parties holds the listening party hosted by a player, and memberParties the party each member belongs to.
+// partiesMtx protects access to both maps.
+var (
+	parties       = make(map[*world.EntityHandle]*ListeningParty)
+	memberParties = make(map[*world.EntityHandle]*ListeningParty)
+	partiesMtx    sync.Mutex
+)
+
+// CreateParty creates a listening party hosted by the player behind the handle passed. If the player
+// already hosts a party, that party is returned. If the player is a member of another party, they leave it.
+// CreateParty may be called from within a transaction.
+func CreateParty(host *world.EntityHandle) *ListeningParty {
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	if p, ok := parties[host]; ok {
+		return p
+	}
+	if other, ok := memberParties[host]; ok {
+		other.remove(host)
+	}
+	p := &ListeningParty{
+		host:    host,
+		members: make(map[*world.EntityHandle]struct{}),
+		invites: make(map[*world.EntityHandle]struct{}),
+	}
+	// The name is resolved asynchronously, as the caller may be in a transaction of the host's world.
+	go host.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		if pp, ok := ent.(*player.Player); ok {
+			p.setHostName(pp.Name())
+		}
+	})
+	parties[host] = p
+	return p
+}
+
+// HostedParty returns the listening party hosted by the player.
+func HostedParty(host *world.EntityHandle) (*ListeningParty, bool) {
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	p, ok := parties[host]
+	return p, ok
+}
+
+// JoinedParty returns the listening party the player is a member of.
+func JoinedParty(member *world.EntityHandle) (*ListeningParty, bool) {
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	p, ok := memberParties[member]
+	return p, ok
+}
+
+// Host returns the handle of the host of the party.
+func (p *ListeningParty) Host() *world.EntityHandle {
+	return p.host
+}
+
+// HostName returns the name of the host of the party.
+func (p *ListeningParty) HostName() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hostName
+}
+
+// setHostName sets the name of the host of the party.
+func (p *ListeningParty) setHostName(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hostName = name
+}
+
+// Members returns the handles of all members of the party, excluding the host.
+func (p *ListeningParty) Members() []*world.EntityHandle {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	members := make([]*world.EntityHandle, 0, len(p.members))
+	for m := range p.members {
+		members = append(members, m)
+	}
+	return members
+}
+
+// Add adds the player to the party, removing them from any other party they are a member of. The host of a
+// party cannot join another one. Returns false if the player could not be added.
+func (p *ListeningParty) Add(member *world.EntityHandle) bool {
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	if parties[p.host] != p || member == p.host {
+		return false
+	}
+	if _, ok := parties[member]; ok {
+		return false
+	}
+	if other, ok := memberParties[member]; ok {
+		other.remove(member)
+	}
+	p.mu.Lock()
+	p.members[member] = struct{}{}
+	delete(p.invites, member)
+	p.mu.Unlock()
+	memberParties[member] = p
+	return true
+}
+
+// Invite invites the player to the party. The invitation is accepted with Join, or declined with Decline.
+func (p *ListeningParty) Invite(eh *world.EntityHandle) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.invites[eh] = struct{}{}
+}
+
+// Invited reports whether the player has a pending invitation to the party.
+func (p *ListeningParty) Invited(eh *world.EntityHandle) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.invites[eh]
+	return ok
+}
+
+// Join accepts the invitation of the player to the party and adds them to it. Returns false if the player
+// was not invited or could not be added.
+func (p *ListeningParty) Join(eh *world.EntityHandle) bool {
+	if !p.Invited(eh) {
+		return false
+	}
+	return p.Add(eh)
+}
+
+// Decline declines the invitation of the player to the party. Returns false if the player was not invited.
+func (p *ListeningParty) Decline(eh *world.EntityHandle) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.invites[eh]
+	delete(p.invites, eh)
+	return ok
+}
+
+// Remove removes the player from the party. Returns false if they were not a member.
+func (p *ListeningParty) Remove(member *world.EntityHandle) bool {
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	if memberParties[member] != p {
+		return false
+	}
+	p.remove(member)
+	return true
+}
+
+// remove removes the member from the party. partiesMtx must be held.
+func (p *ListeningParty) remove(member *world.EntityHandle) {
+	p.mu.Lock()
+	delete(p.members, member)
+	p.mu.Unlock()
+	delete(memberParties, member)
+}
+
+// Disband removes all members from the party and closes it. Songs played to the host afterwards are only
+// heard by the host.
+func (p *ListeningParty) Disband() {
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	if parties[p.host] == p {
+		delete(parties, p.host)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for m := range p.members {
+		delete(memberParties, m)
+	}
+	clear(p.members)
+	clear(p.invites)
+}
+
+// LeaveParties removes the player from every listening party: the party they host is disbanded, they
+// leave the party they are a member of, and their pending invitations are dropped. PartyHandler calls it
+// when a player disconnects.
+func LeaveParties(eh *world.EntityHandle) {
+	if p, ok := HostedParty(eh); ok {
+		p.Disband()
+	}
+	if p, ok := JoinedParty(eh); ok {
+		p.Remove(eh)
+	}
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	for _, p := range parties {
+		p.Decline(eh)
+	}
+}
+
+// invitingParty returns the party with the host name passed that invited the player.
+func invitingParty(eh *world.EntityHandle, hostName string) (*ListeningParty, bool) {
+	partiesMtx.Lock()
+	defer partiesMtx.Unlock()
+	for _, p := range parties {
+		if strings.EqualFold(p.HostName(), hostName) && p.Invited(eh) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// partyMembers returns the members of the party hosted by the player, if any.
+func partyMembers(host *world.EntityHandle) []*world.EntityHandle {
+	p, ok := HostedParty(host)
+	if !ok {
+		return nil
+	}
+	return p.Members()
+}
+
+// messagePlayer sends a chat message to the player behind the handle passed, wherever they are. The message
+// is sent asynchronously, so messagePlayer may be called from within a transaction.
+func messagePlayer(eh *world.EntityHandle, a ...any) {
+	go eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		if pp, ok := ent.(*player.Player); ok {
+			pp.Message(a...)
+		}
+	})
+}
+
+// PartyHandler wraps a player.Handler and removes the player from all listening parties when they
+// disconnect. All events are passed on to the wrapped Handler, which must not be nil.
+//
+// Example usage (when a player joins):
+//
+//	p.Handle(noteblockplayer.PartyHandler{Handler: yourHandler})
+type PartyHandler struct {
+	player.Handler
+}
+
+// HandleQuit removes the player from all listening parties, then passes the event on.
+func (h PartyHandler) HandleQuit(p *player.Player) {
+	LeaveParties(p.H())
+	h.Handler.HandleQuit(p)
+}
+
+// InviteCmd is the command to invite a player to the listening party of the source, which is created if
+// they don't host one yet.
+type InviteCmd struct {
+	Player []cmd.Target `cmd:"player"`
+}
+
+// Run invites the targeted players to the source's listening party.
+func (c InviteCmd) Run(src cmd.Source, output *cmd.Output, tx *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbinvite command is only valid for players")
+		return
+	}
+	party := CreateParty(p.H())
+	party.setHostName(p.Name())
+	for _, t := range c.Player {
+		target, ok := t.(*player.Player)
+		if !ok || target == p {
+			continue
+		}
+		party.Invite(target.H())
+		target.Messagef("%s invited you to their listening party. Use /nbjoin %s to join, or /nbjoin %s deny to decline.", p.Name(), p.Name(), p.Name())
+		output.Printf("Invited %s to your listening party", target.Name())
+	}
+}
+
+// joinAnswer is the answer to an invitation of the nbjoin command.
+type joinAnswer string
+
+// Type returns the name of the enum.
+func (joinAnswer) Type() string { return "JoinAnswer" }
+
+// Options returns all answers.
+func (joinAnswer) Options(cmd.Source) []string {
+	return []string{"accept", "deny"}
+}
+
+// JoinCmd is the command to accept or decline an invitation to a listening party.
+type JoinCmd struct {
+	Host   string                   `cmd:"host"`
+	Answer cmd.Optional[joinAnswer] `cmd:"answer"`
+}
+
+// Run accepts the invitation of the host, or declines it.
+func (c JoinCmd) Run(src cmd.Source, output *cmd.Output, tx *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbjoin command is only valid for players")
+		return
+	}
+	party, ok := invitingParty(p.H(), c.Host)
+	if !ok {
+		output.Errorf("You have no invitation from %s", c.Host)
+		return
+	}
+	if c.Answer.LoadOr("accept") == "deny" {
+		party.Decline(p.H())
+		messagePlayer(party.Host(), p.Name()+" declined your listening party invitation")
+		output.Printf("Declined the invitation of %s", party.HostName())
+		return
+	}
+	if !party.Join(p.H()) {
+		output.Errorf("Could not join the listening party of %s", party.HostName())
+		return
+	}
+	messagePlayer(party.Host(), p.Name()+" joined your listening party")
+	output.Printf("Joined the listening party of %s", party.HostName())
+}
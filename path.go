@@ -0,0 +1,78 @@
+package noteblockplayer
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Keyframe is a position on the path of a moving DJBooth, and the time at which the booth reaches it.
+type Keyframe struct {
+	// At is the time since the path was set at which the booth is at Pos.
+	At  time.Duration
+	Pos mgl64.Vec3
+}
+
+// boothPath is the path a DJBooth moves along, see DJBooth.SetPath.
+type boothPath struct {
+	frames []Keyframe
+	loop   bool
+	start  time.Time
+}
+
+// position returns the position on the path at the time passed. Between two keyframes, the position moves
+// along the straight line between them at a steady speed.
+func (p *boothPath) position(now time.Time) mgl64.Vec3 {
+	t := now.Sub(p.start)
+	if last := p.frames[len(p.frames)-1].At; p.loop && last > 0 {
+		t %= last
+	}
+	i, _ := slices.BinarySearchFunc(p.frames, t, func(k Keyframe, t time.Duration) int {
+		return cmp.Compare(k.At, t)
+	})
+	switch {
+	case i == 0:
+		return p.frames[0].Pos
+	case i == len(p.frames):
+		return p.frames[i-1].Pos
+	}
+	from, to := p.frames[i-1], p.frames[i]
+	f := float64(t-from.At) / float64(to.At-from.At)
+	return from.Pos.Add(to.Pos.Sub(from.Pos).Mul(f))
+}
+
+// SetPath makes the booth move along the path passed, starting now, so that parades and marching bands
+// travel through the world while they play. The booth is at every keyframe at its time, and moves between
+// keyframes in a straight line. Once the last keyframe is reached, the booth stays there, or starts over at
+// the first keyframe if loop is true. Players hear the booth while they are within its radius of its
+// current position. Passing no keyframes returns the booth to the position it was opened at.
+//
+// Example usage (march down a street and back every two minutes):
+//
+//	booth.SetPath([]noteblockplayer.Keyframe{
+//	    {At: 0, Pos: mgl64.Vec3{0, 64, 0}},
+//	    {At: time.Minute, Pos: mgl64.Vec3{0, 64, 200}},
+//	    {At: 2 * time.Minute, Pos: mgl64.Vec3{0, 64, 0}},
+//	}, true)
+func (b *DJBooth) SetPath(keyframes []Keyframe, loop bool) {
+	if len(keyframes) == 0 {
+		b.path.Store(nil)
+		return
+	}
+	frames := slices.Clone(keyframes)
+	slices.SortStableFunc(frames, func(a, b Keyframe) int {
+		return cmp.Compare(a.At, b.At)
+	})
+	b.path.Store(&boothPath{frames: frames, loop: loop, start: time.Now()})
+}
+
+// Position returns the current position of the booth: the position it was opened at, or its position on
+// the path set with SetPath.
+func (b *DJBooth) Position() mgl64.Vec3 {
+	if p := b.path.Load(); p != nil {
+		return p.position(time.Now())
+	}
+	return b.pos
+}
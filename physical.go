@@ -0,0 +1,82 @@
+package noteblockplayer
+
+import (
+	"fmt"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/particle"
+	"github.com/df-mc/dragonfly/server/world/sound"
+)
+
+// maxNoteBlockSearchVolume is the largest number of blocks FindNoteBlocks scans, as every block is read
+// within the world transaction.
+const maxNoteBlockSearchVolume = 64 * 64 * 64
+
+// FindNoteBlocks returns the positions of all note blocks within the box spanned by a and b (inclusive),
+// ordered by y, then z, then x. The result can be passed as PlaybackOptions.NoteBlocks. An error wrapping
+// ErrRegionTooLarge is returned for boxes of more than 64x64x64 blocks.
+func FindNoteBlocks(tx *world.Tx, a, b cube.Pos) ([]cube.Pos, error) {
+	lo := cube.Pos{min(a[0], b[0]), min(a[1], b[1]), min(a[2], b[2])}
+	hi := cube.Pos{max(a[0], b[0]), max(a[1], b[1]), max(a[2], b[2])}
+	volume := int64(1)
+	for i := range 3 {
+		// Every side is checked on its own, so the volume of huge boxes never overflows.
+		side := int64(hi[i]) - int64(lo[i]) + 1
+		if side > maxNoteBlockSearchVolume {
+			return nil, fmt.Errorf("%w: %d blocks wide, at most %d blocks are searched", ErrRegionTooLarge, side, maxNoteBlockSearchVolume)
+		}
+		volume *= side
+	}
+	if volume > maxNoteBlockSearchVolume {
+		return nil, fmt.Errorf("%w: %d blocks, at most %d blocks are searched", ErrRegionTooLarge, volume, maxNoteBlockSearchVolume)
+	}
+
+	var positions []cube.Pos
+	for y := lo[1]; y <= hi[1]; y++ {
+		for z := lo[2]; z <= hi[2]; z++ {
+			for x := lo[0]; x <= hi[0]; x++ {
+				pos := cube.Pos{x, y, z}
+				if _, ok := tx.Block(pos).(block.Note); ok {
+					positions = append(positions, pos)
+				}
+			}
+		}
+	}
+	return positions, nil
+}
+
+// noteBlockPitch converts an NBS key to a vanilla note block pitch (0-24), folding keys outside of the
+// two octaves a note block can play by whole octaves.
+func noteBlockPitch(key int) int {
+	return PitchKey(foldKey(key, minVanillaKey, maxVanillaKey))
+}
+
+// playNoteBlock tunes the note block bound to the note's layer and triggers it, showing the note particle to
+// everyone nearby, and playing the note block sound unless withSound is false. Positions that no longer hold
+// a note block are skipped.
+func playNoteBlock(tx *world.Tx, positions []cube.Pos, note Note, withSound bool) {
+	pos, ok := noteBlockPos(positions, note)
+	if !ok {
+		return
+	}
+	nb, ok := tx.Block(pos).(block.Note)
+	if !ok {
+		return
+	}
+	pitch := noteBlockPitch(note.Key)
+	if nb.Pitch != pitch {
+		nb.Pitch = pitch
+		tx.SetBlock(pos, nb, nil)
+	}
+
+	instrument := sound.Piano()
+	if note.Instrument >= 0 && note.Instrument < len(instrumentSounds) {
+		instrument = instrumentSounds[note.Instrument]
+	}
+	if withSound {
+		tx.PlaySound(pos.Vec3Centre(), sound.Note{Instrument: instrument, Pitch: pitch})
+	}
+	tx.AddParticle(pos.Vec3(), particle.Note{Instrument: instrument, Pitch: pitch})
+}
@@ -0,0 +1,134 @@
+package noteblockplayer
+
+import (
+	"sort"
+
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// Playback is a song playing to a player, returned by PlaySong. It controls that song only, so the songs
+// playing on the other channels of the player are left alone.
+type Playback struct {
+	pb *playback
+}
+
+// PlaySong starts playing a loaded song to the player on the channel of the PlaybackOptions passed (see
+// PlaybackOptions.Channel), replacing the song playing on that channel only, and returns the Playback to
+// control it with. It returns ErrAlreadyPlaying if PlaybackOptions.NoReplace is set and a song is already
+// playing on the channel.
+//
+// Example usage (play a jingle on top of the music):
+//
+//	jingle, err := noteblockplayer.PlaySong(p.H(), song, noteblockplayer.PlaybackOptions{Channel: "jingle"})
+//	if err != nil {
+//	    // handle error
+//	}
+//	<-jingle.Done()
+func PlaySong(eh *world.EntityHandle, song *Song, opts PlaybackOptions) (*Playback, error) {
+	if opts.NoReplace && isPlayingOn(eh, opts.Channel) {
+		return nil, ErrAlreadyPlaying
+	}
+	pb := newPlayback(eh, song, opts)
+	go pb.run()
+	return &Playback{pb: pb}, nil
+}
+
+// Playbacks returns the songs playing to the player on all channels, sorted by channel, so the music
+// channel comes first.
+func Playbacks(eh *world.EntityHandle) []*Playback {
+	playbacksMtx.Lock()
+	all := playbacksOf(eh)
+	playbacksMtx.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].opts.Channel < all[j].opts.Channel })
+
+	handles := make([]*Playback, len(all))
+	for i, pb := range all {
+		handles[i] = &Playback{pb: pb}
+	}
+	return handles
+}
+
+// playbacksOf returns the playbacks of the player on all channels. playbacksMtx must be held.
+func playbacksOf(eh *world.EntityHandle) []*playback {
+	var all []*playback
+	for key, pb := range playbacks {
+		if key.eh == eh {
+			all = append(all, pb)
+		}
+	}
+	return all
+}
+
+// StopChannel stops the song playing to the player on the channel passed. Stopping the music channel ("")
+// clears the queue of the player too, like StopNoteblock. Returns true if a song was playing on the channel.
+func StopChannel(eh *world.EntityHandle, channel string) bool {
+	if channel == "" {
+		return stopSong(eh)
+	}
+	return stopPlayback(playbackKey{eh: eh, channel: channel})
+}
+
+// ID returns the unique ID of the playback, see StopPlayback.
+func (p *Playback) ID() int {
+	return p.pb.id
+}
+
+// Song returns the song of the playback.
+func (p *Playback) Song() *Song {
+	return p.pb.song
+}
+
+// Channel returns the channel the song plays on.
+func (p *Playback) Channel() string {
+	return p.pb.opts.Channel
+}
+
+// Tick returns the tick the song is at.
+func (p *Playback) Tick() int {
+	return int(p.pb.tick.Load())
+}
+
+// Paused reports whether the song is paused.
+func (p *Playback) Paused() bool {
+	return p.pb.paused.Load()
+}
+
+// Done returns a channel that is closed once the song finished, or was stopped or replaced.
+func (p *Playback) Done() <-chan struct{} {
+	return p.pb.done
+}
+
+// Playing reports whether the song is still playing, or paused.
+func (p *Playback) Playing() bool {
+	select {
+	case <-p.pb.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stop stops the song. The songs of the other channels of the player keep playing.
+func (p *Playback) Stop() {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	if playbacks[p.pb.key()] == p.pb {
+		delete(playbacks, p.pb.key())
+	}
+	p.pb.send(control{kind: controlStop})
+}
+
+// Pause pauses the song until Resume is called.
+func (p *Playback) Pause() {
+	p.pb.send(control{kind: controlPause})
+}
+
+// Resume resumes the song after it was paused with Pause.
+func (p *Playback) Resume() {
+	p.pb.send(control{kind: controlResume})
+}
+
+// Seek makes the song jump to the tick passed. Ticks outside the song are clamped to its start or end.
+func (p *Playback) Seek(tick int) {
+	p.pb.send(control{kind: controlSeek, tick: tick})
+}
@@ -0,0 +1,314 @@
+package noteblockplayer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// PlayerPreferences holds the music preferences of a player.
+type PlayerPreferences struct {
+	// Muted excludes the player from all broadcast music, such as DJ booths and ambient music. Songs the
+	// player plays explicitly are still heard.
+	Muted bool `json:"muted,omitempty"`
+	// Favorites are the names of the songs the player bookmarked, in the order they were added.
+	Favorites []string `json:"favorites,omitempty"`
+	// Volume, if set, is the volume from 0 to 1 that every note played to the player is multiplied by.
+	Volume *float64 `json:"volume,omitempty"`
+	// Pitch is the number of semitones every note played to the player is shifted by, from -12 to 12.
+	Pitch int `json:"pitch,omitempty"`
+}
+
+// PreferenceStore persists the PlayerPreferences of players, identified by the string form of their UUID.
+type PreferenceStore interface {
+	// Load returns the preferences of the player. Players without stored preferences get the zero value.
+	Load(id string) (PlayerPreferences, error)
+	// Save stores the preferences of the player.
+	Save(id string, prefs PlayerPreferences) error
+}
+
+// FilePreferenceStore is a PreferenceStore keeping the preferences of all players in a single JSON file.
+type FilePreferenceStore struct {
+	path string
+
+	mu    sync.Mutex
+	prefs map[string]PlayerPreferences
+}
+
+// NewFilePreferenceStore returns a FilePreferenceStore reading from and writing to the JSON file at the path
+// passed. A file that does not exist yet is created on the first save.
+func NewFilePreferenceStore(path string) (*FilePreferenceStore, error) {
+	s := &FilePreferenceStore{path: path, prefs: make(map[string]PlayerPreferences)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.prefs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load returns the preferences of the player.
+func (s *FilePreferenceStore) Load(id string) (PlayerPreferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prefs[id], nil
+}
+
+// Save stores the preferences of the player and writes all preferences to the file.
+func (s *FilePreferenceStore) Save(id string, prefs PlayerPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prefs[id] = prefs
+	return writeJSONFile(s.path, s.prefs)
+}
+
+// writeJSONFile writes v as indented JSON to the file at the path passed, creating its folder if needed.
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes the data passed to the file at the path passed, replacing it if it exists. The data
+// is written to a temporary file first, so a crash while writing never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// preferenceStore is the store set with SetPreferenceStore, and preferences the preferences of the players
+// loaded so far by UUID. preferencesMtx protects access to both.
+var (
+	preferenceStore PreferenceStore
+	preferences     = make(map[string]PlayerPreferences)
+	preferencesMtx  sync.RWMutex
+)
+
+// preferencesGeneration is increased whenever preferences change, so values derived from them can be kept
+// until it changes.
+var preferencesGeneration atomic.Uint64
+
+// prefsCache caches the PlayerVolume and PlayerPitch of every player a song is played to, so that they are
+// only looked up again after preferences changed. It is kept by the playback, and is not safe for
+// concurrent use.
+type prefsCache map[*world.EntityHandle]cachedPrefs
+
+// cachedPrefs are the volume and pitch of a player, as of the preferencesGeneration gen.
+type cachedPrefs struct {
+	volume float32
+	pitch  int
+	gen    uint64
+}
+
+// get returns the PlayerVolume and PlayerPitch of the player behind the handle passed.
+func (c prefsCache) get(eh *world.EntityHandle) (volume float32, pitch int) {
+	// Generations are offset by one, so that the zero value of gen never matches.
+	gen := preferencesGeneration.Load() + 1
+	if p, ok := c[eh]; ok && p.gen == gen {
+		return p.volume, p.pitch
+	}
+	p := cachedPrefs{volume: float32(PlayerVolume(eh)), pitch: Preferences(eh).Pitch, gen: gen}
+	c[eh] = p
+	return p.volume, p.pitch
+}
+
+// SetPreferenceStore sets the store that player preferences are loaded from and saved to. Without a store,
+// preferences are only kept in memory until the server stops.
+//
+// Example usage:
+//
+//	store, err := noteblockplayer.NewFilePreferenceStore("noteblock_preferences.json")
+//	if err != nil {
+//	    // handle error
+//	}
+//	noteblockplayer.SetPreferenceStore(store)
+func SetPreferenceStore(s PreferenceStore) {
+	preferencesMtx.Lock()
+	defer preferencesMtx.Unlock()
+	preferenceStore = s
+	clear(preferences)
+	preferencesGeneration.Add(1)
+}
+
+// Preferences returns the preferences of the player behind the handle passed.
+func Preferences(eh *world.EntityHandle) PlayerPreferences {
+	id := eh.UUID().String()
+	preferencesMtx.RLock()
+	prefs, ok := preferences[id]
+	preferencesMtx.RUnlock()
+	if ok {
+		return prefs
+	}
+
+	preferencesMtx.Lock()
+	defer preferencesMtx.Unlock()
+	return loadPreferences(id)
+}
+
+// loadPreferences returns the preferences of the player with the UUID passed, loading them from the
+// preference store if they were not loaded yet. preferencesMtx must be held for writing.
+func loadPreferences(id string) PlayerPreferences {
+	if prefs, ok := preferences[id]; ok {
+		return prefs
+	}
+	var prefs PlayerPreferences
+	if preferenceStore != nil {
+		// Preferences that fail to load are treated as defaults, so a broken store never stops music.
+		prefs, _ = preferenceStore.Load(id)
+	}
+	preferences[id] = prefs
+	return prefs
+}
+
+// preferencesSaveMtx makes sure preferences are saved one at a time, see UpdatePreferences.
+var preferencesSaveMtx sync.Mutex
+
+// UpdatePreferences changes the preferences of the player with the function passed and saves them to the
+// preference store, if one is set. Concurrent updates are applied one after another, and the store is
+// written to without blocking players whose preferences are read in the meantime.
+func UpdatePreferences(eh *world.EntityHandle, f func(prefs *PlayerPreferences)) error {
+	id := eh.UUID().String()
+	preferencesMtx.Lock()
+	prefs := loadPreferences(id)
+	// The favorites are copied, so appending to them never changes the slice of the preferences read before.
+	prefs.Favorites = slices.Clone(prefs.Favorites)
+	f(&prefs)
+	preferences[id] = prefs
+	preferencesGeneration.Add(1)
+	store := preferenceStore
+	preferencesMtx.Unlock()
+	if store == nil {
+		return nil
+	}
+
+	// Every save writes the latest preferences of the player, so a save finishing late never overwrites the
+	// preferences of an update made after it with older ones.
+	preferencesSaveMtx.Lock()
+	defer preferencesSaveMtx.Unlock()
+	preferencesMtx.RLock()
+	prefs = preferences[id]
+	preferencesMtx.RUnlock()
+	return store.Save(id, prefs)
+}
+
+// SetMuted excludes the player from (or includes them in) all broadcast music, such as DJ booths and
+// ambient music. Songs the player plays explicitly are not affected.
+func SetMuted(eh *world.EntityHandle, muted bool) error {
+	return UpdatePreferences(eh, func(prefs *PlayerPreferences) {
+		prefs.Muted = muted
+	})
+}
+
+// IsMuted reports whether the player muted broadcast music with SetMuted.
+func IsMuted(eh *world.EntityHandle) bool {
+	return Preferences(eh).Muted
+}
+
+// SetPlayerVolume sets the volume, from 0 to 1, that every note played to the player is multiplied by, on
+// top of the master volume. It applies to running playbacks immediately.
+func SetPlayerVolume(eh *world.EntityHandle, volume float64) error {
+	volume = max(0, min(1, volume))
+	return UpdatePreferences(eh, func(prefs *PlayerPreferences) {
+		prefs.Volume = &volume
+	})
+}
+
+// PlayerVolume returns the volume of the player set with SetPlayerVolume, 1 if it was never set.
+func PlayerVolume(eh *world.EntityHandle) float64 {
+	if v := Preferences(eh).Volume; v != nil {
+		return *v
+	}
+	return 1
+}
+
+// maxPitchShift is the largest number of semitones the pitch of a player can be shifted by, up or down.
+const maxPitchShift = 12
+
+// SetPlayerPitch sets the number of semitones, from -12 to 12, that every note played to the player is
+// shifted by, for players who prefer all music a bit lower or higher. It applies to running playbacks
+// immediately.
+func SetPlayerPitch(eh *world.EntityHandle, semitones int) error {
+	semitones = max(-maxPitchShift, min(maxPitchShift, semitones))
+	return UpdatePreferences(eh, func(prefs *PlayerPreferences) {
+		prefs.Pitch = semitones
+	})
+}
+
+// PlayerPitch returns the number of semitones set with SetPlayerPitch, 0 if it was never set.
+func PlayerPitch(eh *world.EntityHandle) int {
+	return Preferences(eh).Pitch
+}
+
+// PitchCmd is the command to shift the pitch of all music the player hears.
+type PitchCmd struct {
+	Semitones cmd.Optional[int] `cmd:"semitones"`
+}
+
+// Run sets the pitch shift of the player, or shows it if no number is passed.
+func (c PitchCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbpitch command is only valid for players")
+		return
+	}
+	semitones, ok := c.Semitones.Load()
+	if !ok {
+		output.Printf("Music pitch: %+d semitones", PlayerPitch(p.H()))
+		return
+	}
+	if semitones < -maxPitchShift || semitones > maxPitchShift {
+		output.Errorf("The pitch must be between %d and %d semitones", -maxPitchShift, maxPitchShift)
+		return
+	}
+	if err := SetPlayerPitch(p.H(), semitones); err != nil {
+		output.Errorf("Failed to save your preference: %v", err)
+		return
+	}
+	output.Printf("Music pitch set to %+d semitones", semitones)
+}
+
+// MuteCmd is the command to opt out of (or back into) broadcast music.
+type MuteCmd struct {
+	Muted cmd.Optional[bool] `cmd:"muted"`
+}
+
+// Run toggles whether the player hears broadcast music, or sets it if an argument is passed.
+func (c MuteCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbmute command is only valid for players")
+		return
+	}
+	muted := c.Muted.LoadOr(!IsMuted(p.H()))
+	if err := SetMuted(p.H(), muted); err != nil {
+		output.Errorf("Failed to save your preference: %v", err)
+		return
+	}
+	if muted {
+		output.Print("Broadcast music muted. Songs you play yourself are still heard.")
+		return
+	}
+	output.Print("Broadcast music unmuted")
+}
@@ -0,0 +1,355 @@
+package noteblockplayer
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// queueEntry is a song waiting in a player's queue, with the options it will be played with.
+type queueEntry struct {
+	song *Song
+	opts PlaybackOptions
+}
+
+// queues holds the songs queued per player, played one after another when the current song finishes.
+// queuesMtx protects access to queues.
+var (
+	queues    = make(map[*world.EntityHandle][]queueEntry)
+	queuesMtx sync.Mutex
+)
+
+// isPlaying reports whether a song is currently playing for the player on the music channel.
+func isPlaying(eh *world.EntityHandle) bool {
+	return isPlayingOn(eh, "")
+}
+
+// isPlayingOn reports whether a song is currently playing for the player on the channel passed.
+func isPlayingOn(eh *world.EntityHandle, channel string) bool {
+	playbacksMtx.Lock()
+	defer playbacksMtx.Unlock()
+	_, ok := playbacks[playbackKey{eh: eh, channel: channel}]
+	return ok
+}
+
+// queueSong adds a song to the end of the player's queue, or plays it right away if nothing is playing.
+func queueSong(eh *world.EntityHandle, song *Song, opts PlaybackOptions) {
+	queuesMtx.Lock()
+	if isPlaying(eh) {
+		queues[eh] = append(queues[eh], queueEntry{song: song, opts: opts})
+		queuesMtx.Unlock()
+		return
+	}
+	queuesMtx.Unlock()
+	go playSong(eh, song, opts)
+}
+
+// RepeatMode decides what happens when a song in a player's queue finishes.
+type RepeatMode int
+
+const (
+	// RepeatOff plays the next song of the queue, and stops once the queue is empty. This is the default.
+	RepeatOff RepeatMode = iota
+	// RepeatOne plays the song that finished again.
+	RepeatOne
+	// RepeatAll adds the song that finished to the end of the queue, so the whole queue loops.
+	RepeatAll
+)
+
+// String returns the name of the repeat mode, as used by the nbrepeat command.
+func (m RepeatMode) String() string {
+	switch m {
+	case RepeatOne:
+		return "one"
+	case RepeatAll:
+		return "all"
+	default:
+		return "off"
+	}
+}
+
+// repeatModes holds the repeat mode per player, if not RepeatOff. queuesMtx protects access to repeatModes.
+var repeatModes = make(map[*world.EntityHandle]RepeatMode)
+
+// SetRepeatMode sets the repeat mode of the player's queue, which is used whenever a song finishes.
+// Stopping a song does not reset it.
+func SetRepeatMode(eh *world.EntityHandle, mode RepeatMode) {
+	queuesMtx.Lock()
+	defer queuesMtx.Unlock()
+	if mode == RepeatOff {
+		delete(repeatModes, eh)
+		return
+	}
+	repeatModes[eh] = mode
+}
+
+// PlayerRepeatMode returns the repeat mode of the player's queue.
+func PlayerRepeatMode(eh *world.EntityHandle) RepeatMode {
+	queuesMtx.Lock()
+	defer queuesMtx.Unlock()
+	return repeatModes[eh]
+}
+
+// songFinished starts playing the song that follows the song that just finished playing with the options
+// passed, following the player's repeat mode.
+func songFinished(eh *world.EntityHandle, song *Song, opts PlaybackOptions) {
+	// A song started partway into it is repeated from its start.
+	opts.StartTick = 0
+	queuesMtx.Lock()
+	switch repeatModes[eh] {
+	case RepeatOne:
+		queuesMtx.Unlock()
+		go playSong(eh, song, opts)
+		return
+	case RepeatAll:
+		queues[eh] = append(queues[eh], queueEntry{song: song, opts: opts})
+	}
+	queuesMtx.Unlock()
+	playNextQueued(eh)
+}
+
+// playNextQueued starts playing the next song in the player's queue, if any.
+func playNextQueued(eh *world.EntityHandle) {
+	queuesMtx.Lock()
+	q := queues[eh]
+	if len(q) == 0 {
+		queuesMtx.Unlock()
+		return
+	}
+	next := q[0]
+	if len(q) == 1 {
+		delete(queues, eh)
+	} else {
+		queues[eh] = q[1:]
+	}
+	queuesMtx.Unlock()
+	go playSong(eh, next.song, next.opts)
+}
+
+// clearQueue removes all songs from the player's queue.
+func clearQueue(eh *world.EntityHandle) {
+	queuesMtx.Lock()
+	defer queuesMtx.Unlock()
+	delete(queues, eh)
+}
+
+// nextQueued returns the song that plays after the current song of the player, if any.
+func nextQueued(eh *world.EntityHandle) (*Song, bool) {
+	queuesMtx.Lock()
+	defer queuesMtx.Unlock()
+	if q := queues[eh]; len(q) > 0 {
+		return q[0].song, true
+	}
+	return nil, false
+}
+
+// QueuedSongs returns the songs in the player's queue, in the order they will be played.
+func QueuedSongs(eh *world.EntityHandle) []*Song {
+	queuesMtx.Lock()
+	defer queuesMtx.Unlock()
+	songs := make([]*Song, len(queues[eh]))
+	for i, e := range queues[eh] {
+		songs[i] = e.song
+	}
+	return songs
+}
+
+// AddToQueue adds the song to the end of the player's queue, to be played with the PlaybackOptions passed.
+// If no song is playing, it starts playing right away.
+func AddToQueue(eh *world.EntityHandle, song *Song, opts PlaybackOptions) {
+	queueSong(eh, song, opts)
+}
+
+// RemoveFromQueue removes the song at the index passed (0 being the next song) from the player's queue and
+// returns it. Returns false if the index is out of range.
+func RemoveFromQueue(eh *world.EntityHandle, index int) (*Song, bool) {
+	queuesMtx.Lock()
+	defer queuesMtx.Unlock()
+	q := queues[eh]
+	if index < 0 || index >= len(q) {
+		return nil, false
+	}
+	song := q[index].song
+	if q = slices.Delete(q, index, index+1); len(q) == 0 {
+		delete(queues, eh)
+	} else {
+		queues[eh] = q
+	}
+	return song, true
+}
+
+// MoveInQueue moves the song at index from to index to in the player's queue, shifting the songs in
+// between. Returns false if either index is out of range.
+func MoveInQueue(eh *world.EntityHandle, from, to int) bool {
+	queuesMtx.Lock()
+	defer queuesMtx.Unlock()
+	q := queues[eh]
+	if from < 0 || from >= len(q) || to < 0 || to >= len(q) {
+		return false
+	}
+	e := q[from]
+	q = slices.Delete(q, from, from+1)
+	queues[eh] = slices.Insert(q, to, e)
+	return true
+}
+
+// ClearQueue removes all songs from the player's queue, without stopping the current song.
+func ClearQueue(eh *world.EntityHandle) {
+	clearQueue(eh)
+}
+
+// repeatArg is the repeat mode argument of the nbrepeat command.
+type repeatArg string
+
+// Type returns the name of the enum.
+func (repeatArg) Type() string { return "RepeatMode" }
+
+// Options returns all repeat modes.
+func (repeatArg) Options(cmd.Source) []string {
+	return []string{"off", "one", "all"}
+}
+
+// RepeatCmd is the command to set or show the repeat mode of the player's queue.
+type RepeatCmd struct {
+	Mode cmd.Optional[repeatArg] `cmd:"mode"`
+}
+
+// Run sets the repeat mode of the player's queue, or shows it if no mode is passed.
+func (c RepeatCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbrepeat command is only valid for players")
+		return
+	}
+	arg, ok := c.Mode.Load()
+	if !ok {
+		output.Printf("Repeat mode: %s", PlayerRepeatMode(p.H()))
+		return
+	}
+	mode := RepeatOff
+	switch arg {
+	case "one":
+		mode = RepeatOne
+	case "all":
+		mode = RepeatAll
+	}
+	SetRepeatMode(p.H(), mode)
+	output.Printf("Repeat mode set to %s", mode)
+}
+
+// queueSource returns the player running a queuenb command, writing an error to the output if the source
+// is not a player.
+func queueSource(src cmd.Source, output *cmd.Output) (*player.Player, bool) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The queuenb command is only valid for players")
+	}
+	return p, ok
+}
+
+// QueueListCmd is the command to list the songs in the player's queue.
+type QueueListCmd struct {
+	List cmd.SubCommand `cmd:"list"`
+}
+
+// Run lists the player's queue.
+func (c QueueListCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := queueSource(src, output)
+	if !ok {
+		return
+	}
+	songs := QueuedSongs(p.H())
+	if len(songs) == 0 {
+		output.Print("Your queue is empty")
+		return
+	}
+	output.Printf("Queue (%d songs):", len(songs))
+	for i, song := range songs {
+		output.Printf("%d. %s", i+1, song.displayName())
+	}
+}
+
+// QueueAddCmd is the command to add a song to the player's queue.
+type QueueAddCmd struct {
+	Add      cmd.SubCommand `cmd:"add"`
+	Filename string         `cmd:"filename"`
+}
+
+// Run loads the song in the background and adds it to the end of the player's queue.
+func (c QueueAddCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	if _, ok := queueSource(src, output); !ok || !checkCooldown(src, output, "queuenb") {
+		return
+	}
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		p := src.(*player.Player)
+		if err := checkRequest(p, song, true); err != nil {
+			output.Errorf("Could not queue %s: %v", song.displayName(), err)
+			return
+		}
+		startCooldown(p.H(), "queuenb")
+		AddToQueue(p.H(), song, PlaybackOptions{Source: "command"})
+		output.Printf("Added %s to your queue", song.displayName())
+	})
+}
+
+// QueueRemoveCmd is the command to remove a song from the player's queue by its position.
+type QueueRemoveCmd struct {
+	Remove   cmd.SubCommand `cmd:"remove"`
+	Position int            `cmd:"position"`
+}
+
+// Run removes the song at the position (starting at 1) from the player's queue.
+func (c QueueRemoveCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := queueSource(src, output)
+	if !ok {
+		return
+	}
+	song, ok := RemoveFromQueue(p.H(), c.Position-1)
+	if !ok {
+		output.Errorf("There is no song at position %d", c.Position)
+		return
+	}
+	output.Printf("Removed %s from your queue", song.displayName())
+}
+
+// QueueMoveCmd is the command to move a song in the player's queue to another position.
+type QueueMoveCmd struct {
+	Move cmd.SubCommand `cmd:"move"`
+	From int            `cmd:"from"`
+	To   int            `cmd:"to"`
+}
+
+// Run moves the song at one position (starting at 1) of the player's queue to another.
+func (c QueueMoveCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := queueSource(src, output)
+	if !ok {
+		return
+	}
+	if !MoveInQueue(p.H(), c.From-1, c.To-1) {
+		output.Error("Invalid queue position")
+		return
+	}
+	output.Printf("Moved song %d to position %d", c.From, c.To)
+}
+
+// QueueClearCmd is the command to clear the player's queue.
+type QueueClearCmd struct {
+	Clear cmd.SubCommand `cmd:"clear"`
+}
+
+// Run removes all songs from the player's queue.
+func (c QueueClearCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := queueSource(src, output)
+	if !ok {
+		return
+	}
+	ClearQueue(p.H())
+	output.Print("Your queue was cleared")
+}
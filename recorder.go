@@ -0,0 +1,365 @@
+package noteblockplayer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/sound"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// defaultRecordTempo is the tempo (ticks per second) recordings are quantized to if their tempo can't be
+// detected.
+const defaultRecordTempo = 10.0
+
+// minDetectTempo and maxDetectTempo are the range of tempos (ticks per second) DetectTempo picks from, and
+// detectTempoStep the steps it tries them in.
+const (
+	minDetectTempo  = 4.0
+	maxDetectTempo  = 20.0
+	detectTempoStep = 0.05
+)
+
+// recordedNote is a single note captured while recording, with the time since the recording started.
+type recordedNote struct {
+	at         time.Duration
+	instrument int
+	key        int
+	velocity   int
+}
+
+// recording holds the notes captured for a player since they started recording.
+type recording struct {
+	start time.Time
+	notes []recordedNote
+}
+
+// recordings holds the active recording per player.
+// recordingsMtx protects access to recordings.
+var (
+	recordings    = make(map[*world.EntityHandle]*recording)
+	recordingsMtx sync.Mutex
+)
+
+// ---------- Recording API ----------
+
+// StartRecording starts (or restarts) recording the notes played by the player.
+func StartRecording(eh *world.EntityHandle) {
+	recordingsMtx.Lock()
+	defer recordingsMtx.Unlock()
+	recordings[eh] = &recording{start: time.Now()}
+}
+
+// CancelRecording discards the player's recording. Returns false if the player was not recording.
+func CancelRecording(eh *world.EntityHandle) bool {
+	recordingsMtx.Lock()
+	defer recordingsMtx.Unlock()
+	_, ok := recordings[eh]
+	delete(recordings, eh)
+	return ok
+}
+
+// IsRecording reports whether the player is currently recording.
+func IsRecording(eh *world.EntityHandle) bool {
+	recordingsMtx.Lock()
+	defer recordingsMtx.Unlock()
+	_, ok := recordings[eh]
+	return ok
+}
+
+// RecordNote adds a note to the player's recording at the current time. It is called automatically
+// for note blocks played by players using RecordingHandler, and can be called by other input sources,
+// such as a custom piano UI. Returns false if the player is not recording.
+func RecordNote(eh *world.EntityHandle, instrument, key, velocity int) bool {
+	recordingsMtx.Lock()
+	defer recordingsMtx.Unlock()
+	rec, ok := recordings[eh]
+	if !ok {
+		return false
+	}
+	rec.notes = append(rec.notes, recordedNote{
+		at:         time.Since(rec.start),
+		instrument: instrument,
+		key:        key,
+		velocity:   velocity,
+	})
+	return true
+}
+
+// StopRecording ends the player's recording and returns it as a Song, quantized to the tempo passed in
+// ticks per second. If tempo <= 0, the tempo that fits the timing of the notes best is detected (see
+// DetectTempo) and the notes are aligned to its ticks; the tempo chosen is the Tempo of the Song returned.
+// Notes landing on the same tick are spread over separate layers, and duplicate notes on the same tick are
+// merged. Returns false if the player was not recording.
+func StopRecording(eh *world.EntityHandle, tempo float64) (*Song, bool) {
+	recordingsMtx.Lock()
+	rec, ok := recordings[eh]
+	delete(recordings, eh)
+	recordingsMtx.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return recordedSong(rec.notes, tempo), true
+}
+
+// recordedSong quantizes the recorded notes passed to a Song, as described in StopRecording.
+func recordedSong(notes []recordedNote, tempo float64) *Song {
+	var offset time.Duration
+	if tempo <= 0 {
+		times := make([]time.Duration, len(notes))
+		for i, rn := range notes {
+			times[i] = rn.at
+		}
+		tempo, offset = detectTempo(times)
+	}
+
+	type noteID struct{ tick, instrument, key int }
+	seen := make(map[noteID]struct{})
+	layers := make(map[int]int)
+
+	song := &Song{Tempo: tempo}
+	for _, rn := range notes {
+		tick := max(int(math.Round((rn.at-offset).Seconds()*tempo)), 0)
+		id := noteID{tick, rn.instrument, rn.key}
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		song.Notes = append(song.Notes, Note{
+			Tick:       tick,
+			Layer:      layers[tick],
+			Instrument: rn.instrument,
+			Key:        rn.key,
+			Velocity:   rn.velocity,
+			Panning:    100,
+		})
+		layers[tick]++
+		song.Length = max(song.Length, tick)
+	}
+	song.Duration = float64(song.Length) / tempo
+	return song
+}
+
+// DetectTempo returns the tempo, in ticks per second from 4 to 20, whose ticks the times passed fit best,
+// for songs recorded or imported without a tempo, such as live MIDI performances. Of the tempos that fit
+// about as well as the best one, the slowest is picked, so a song played in eighth notes isn't given a
+// tempo with ticks for sixteenth notes that are never played. The default tempo of 10 ticks per second is
+// returned if there are too few notes to tell.
+func DetectTempo(times []time.Duration) float64 {
+	tempo, _ := detectTempo(times)
+	return tempo
+}
+
+// detectTempo returns the tempo DetectTempo picks, along with the time of the first tick of that tempo, so
+// that the times passed can be quantized to the nearest ticks.
+func detectTempo(times []time.Duration) (float64, time.Duration) {
+	if len(times) < 2 || slices.Max(times)-slices.Min(times) < time.Duration(float64(time.Second)/minDetectTempo) {
+		return defaultRecordTempo, 0
+	}
+	// Every time is turned into its phase within a tick of the tempo tried, a point on the unit circle. If the
+	// times fall on the ticks of the tempo, their phases are all the same and the length of their mean is
+	// close to 1. If they don't, their phases are spread around the circle and the length is close to 0.
+	type fit struct {
+		tempo, length, phase float64
+	}
+	fits := make([]fit, 0, int((maxDetectTempo-minDetectTempo)/detectTempoStep)+1)
+	best := 0.0
+	for i := 0; minDetectTempo+float64(i)*detectTempoStep <= maxDetectTempo; i++ {
+		tempo := minDetectTempo + float64(i)*detectTempoStep
+		var sin, cos float64
+		for _, t := range times {
+			s, c := math.Sincos(2 * math.Pi * t.Seconds() * tempo)
+			sin, cos = sin+s, cos+c
+		}
+		f := fit{tempo: tempo, length: math.Hypot(sin, cos) / float64(len(times)), phase: math.Atan2(sin, cos)}
+		fits = append(fits, f)
+		best = max(best, f.length)
+	}
+	for i, f := range fits {
+		// Only the tempo at the top of every peak is considered, not the tempos on its slopes.
+		peak := (i == 0 || f.length >= fits[i-1].length) && (i == len(fits)-1 || f.length >= fits[i+1].length)
+		if peak && f.length >= best*0.9 {
+			// Phases are from -π to π, so the first tick is moved up to be at or after the start.
+			offset := f.phase / (2 * math.Pi * f.tempo)
+			if offset < 0 {
+				offset += 1 / f.tempo
+			}
+			return math.Round(f.tempo*100) / 100, time.Duration(offset * float64(time.Second))
+		}
+	}
+	return defaultRecordTempo, 0
+}
+
+// SaveRecording ends the player's recording and writes it to the first song folder under the name passed,
+// as JSON if the name ends with ".json" and as NBS otherwise. See StopRecording for the tempo. Existing songs
+// are never overwritten: if a song with the name passed exists, ignoring case and extension, an error
+// wrapping ErrSongExists is returned. The player keeps recording if the song can't be saved, so it can be
+// saved again under another name.
+func SaveRecording(eh *world.EntityHandle, name string, tempo float64) (*Song, error) {
+	if err := validSongName(name); err != nil {
+		return nil, err
+	}
+	recordingsMtx.Lock()
+	rec, ok := recordings[eh]
+	var notes []recordedNote
+	if ok {
+		notes = slices.Clone(rec.notes)
+	}
+	recordingsMtx.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("not recording")
+	}
+	if !strings.EqualFold(path.Ext(name), ".json") && !strings.EqualFold(path.Ext(name), ".nbs") {
+		name += ".nbs"
+	}
+	base := strings.TrimSuffix(name, path.Ext(name))
+	file := filepath.Join(saveDir(), filepath.FromSlash(name))
+	if existing, found := findFileFold(filepath.Dir(file), path.Base(base)+".nbs", path.Base(base)+".json"); found {
+		return nil, fmt.Errorf("%w: %q", ErrSongExists, existing)
+	}
+	song := recordedSong(notes, tempo)
+	song.Title = path.Base(base)
+	// O_EXCL still refuses the file if it was created since it was looked for.
+	if err := saveFile(file, song, os.O_EXCL); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%w: %q", ErrSongExists, name)
+		}
+		// The file was created by this call, so a half written song doesn't take the name.
+		_ = os.Remove(file)
+		return nil, err
+	}
+
+	recordingsMtx.Lock()
+	if recordings[eh] == rec {
+		delete(recordings, eh)
+	}
+	recordingsMtx.Unlock()
+	return song, nil
+}
+
+// ---------- Note Block Capture ----------
+
+// RecordingHandler wraps a player.Handler and records the note blocks the player plays while they are
+// recording. All events are passed on to the wrapped Handler, which must not be nil.
+//
+// Example usage (when a player joins):
+//
+//	p.Handle(noteblockplayer.RecordingHandler{Handler: yourHandler})
+type RecordingHandler struct {
+	player.Handler
+}
+
+// HandleItemUseOnBlock records the note played if the player activates a note block.
+func (h RecordingHandler) HandleItemUseOnBlock(ctx *player.Context, pos cube.Pos, face cube.Face, clickPos mgl64.Vec3) {
+	h.Handler.HandleItemUseOnBlock(ctx, pos, face, clickPos)
+	if ctx.Cancelled() {
+		return
+	}
+	p := ctx.Val()
+	if !IsRecording(p.H()) {
+		return
+	}
+	tx := p.Tx()
+	nb, ok := tx.Block(pos).(block.Note)
+	if !ok {
+		return
+	}
+	// Note blocks only play if there's air above them, and sneaking with an item doesn't activate them.
+	if _, air := tx.Block(pos.Side(cube.FaceUp)).(block.Air); !air {
+		return
+	}
+	if held, _ := p.HeldItems(); p.Sneaking() && !held.Empty() {
+		return
+	}
+
+	instrument := 0
+	if ib, ok := tx.Block(pos.Side(cube.FaceDown)).(interface{ Instrument() sound.Instrument }); ok {
+		for i, s := range instrumentSounds {
+			if s == ib.Instrument() {
+				instrument = i
+				break
+			}
+		}
+	}
+	// Activating a note block raises its pitch by one before it is played.
+	pitch := (nb.Pitch + 1) % 25
+	RecordNote(p.H(), instrument, pitch+33, 100)
+}
+
+// ---------- Commands ----------
+
+// RecordStartCmd is the command to start recording the note blocks the player plays.
+type RecordStartCmd struct {
+	Start cmd.SubCommand `cmd:"start"`
+}
+
+// Run starts a recording for the player.
+func (c RecordStartCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbrecord command is only valid for players")
+		return
+	}
+	StartRecording(p.H())
+	output.Print("Recording started, play some note blocks!")
+}
+
+// RecordSaveCmd is the command to stop recording and save the recording as a song.
+type RecordSaveCmd struct {
+	Save  cmd.SubCommand        `cmd:"save"`
+	Name  string                `cmd:"name"`
+	Tempo cmd.Optional[float64] `cmd:"tempo"`
+}
+
+// Run saves the player's recording to the first song folder.
+func (c RecordSaveCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbrecord command is only valid for players")
+		return
+	}
+	tempo, set := c.Tempo.Load()
+	song, err := SaveRecording(p.H(), c.Name, tempo)
+	if err != nil {
+		output.Errorf("Failed to save recording: %v", err)
+		return
+	}
+	if !set {
+		output.Printf("Saved recording %s (%d notes, detected tempo %.2f ticks per second)", song.Title, len(song.Notes), song.Tempo)
+		return
+	}
+	output.Printf("Saved recording %s (%d notes)", song.Title, len(song.Notes))
+}
+
+// RecordCancelCmd is the command to discard the current recording.
+type RecordCancelCmd struct {
+	Cancel cmd.SubCommand `cmd:"cancel"`
+}
+
+// Run discards the player's recording.
+func (c RecordCancelCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbrecord command is only valid for players")
+		return
+	}
+	if !CancelRecording(p.H()) {
+		output.Error("You are not recording")
+		return
+	}
+	output.Print("Recording discarded")
+}
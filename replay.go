@@ -0,0 +1,209 @@
+package noteblockplayer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ReplayEntry is a single note sound sent to a player, as written to a replay log.
+type ReplayEntry struct {
+	// Time is when the sound was sent.
+	Time time.Time `json:"time"`
+	// Listener is the name of the player the sound was sent to.
+	Listener string `json:"listener"`
+	// Song is the title of the song playing, and Tick the tick of the song the sound belongs to.
+	Song string `json:"song"`
+	Tick int    `json:"tick"`
+	// Sound is the name of the sound sent, for example "note.harp".
+	Sound string `json:"sound"`
+	// Offset is the position of the sound relative to the listener.
+	Offset [3]float32 `json:"offset"`
+	Volume float32    `json:"volume"`
+	Pitch  float32    `json:"pitch"`
+}
+
+// replayLog is a replay log being written.
+type replayLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+	err error
+}
+
+// activeReplayLog is the replay log written to, if any.
+var activeReplayLog atomic.Pointer[replayLog]
+
+// StartReplayLog starts writing every note sound sent to a player to the file at the path passed, one JSON
+// ReplayEntry per line, so complaints about the timing of songs can be looked into afterwards and played
+// again with PlayReplay. The file is overwritten if it exists. A replay log that was already being written
+// is closed first. Notes played through note blocks are not logged.
+//
+// Example usage:
+//
+//	err := noteblockplayer.StartReplayLog("replays/session.jsonl")
+func StartReplayLog(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if old := activeReplayLog.Swap(&replayLog{f: f, w: w, enc: json.NewEncoder(w)}); old != nil {
+		_ = old.close()
+	}
+	return nil
+}
+
+// StopReplayLog stops writing the replay log started with StartReplayLog and closes its file. It returns
+// the first error writing the log ran into, if any.
+func StopReplayLog() error {
+	if l := activeReplayLog.Swap(nil); l != nil {
+		return l.close()
+	}
+	return nil
+}
+
+// close flushes the replay log and closes its file.
+func (l *replayLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.w.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+	if err := l.f.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// logReplay writes the PlaySound packets of pks sent to the player at the position pos to the replay log, if
+// one is being written. Other packets are skipped.
+func logReplay(pp *player.Player, song *Song, tick int, pos mgl64.Vec3, pks []packet.Packet) {
+	l := activeReplayLog.Load()
+	if l == nil {
+		return
+	}
+	now, name, title := time.Now(), pp.Name(), song.displayName()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pk := range pks {
+		ps, ok := pk.(*packet.PlaySound)
+		if !ok || l.err != nil {
+			continue
+		}
+		l.err = l.enc.Encode(ReplayEntry{
+			Time:     now,
+			Listener: name,
+			Song:     title,
+			Tick:     tick,
+			Sound:    ps.SoundName,
+			Offset:   [3]float32{ps.Position[0] - float32(pos[0]), ps.Position[1] - float32(pos[1]), ps.Position[2] - float32(pos[2])},
+			Volume:   ps.Volume,
+			Pitch:    ps.Pitch,
+		})
+	}
+}
+
+// LoadReplay reads the entries of a replay log written with StartReplayLog, ordered by time.
+func LoadReplay(path string) ([]ReplayEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []ReplayEntry
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e ReplayEntry
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("read replay entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	slices.SortStableFunc(entries, func(a, b ReplayEntry) int {
+		return a.Time.Compare(b.Time)
+	})
+	return entries, nil
+}
+
+// PlayReplay plays the replay entries passed to the player in the background, with the same sounds,
+// volumes and pitches, and the same time between them as when they were logged, so a session can be heard
+// exactly as it happened. Entries of all listeners are played, so filter them by Listener to hear what a
+// single player heard. The function returned stops the replay. The replay stops by itself once all entries
+// were played or the player disconnects.
+//
+// Example usage:
+//
+//	entries, _ := noteblockplayer.LoadReplay("replays/session.jsonl")
+//	entries = slices.DeleteFunc(entries, func(e noteblockplayer.ReplayEntry) bool { return e.Listener != "Steve" })
+//	stop := noteblockplayer.PlayReplay(p.H(), entries)
+func PlayReplay(eh *world.EntityHandle, entries []ReplayEntry) (stop func()) {
+	done := make(chan struct{})
+	go playReplay(eh, entries, done)
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// playReplay plays the replay entries to the player until all were played or done is closed. Entries logged
+// at the same time are sent as a single batch.
+func playReplay(eh *world.EntityHandle, entries []ReplayEntry, done chan struct{}) {
+	if len(entries) == 0 {
+		return
+	}
+	var (
+		c     writerCache
+		pks   []packet.Packet
+		start = time.Now()
+		first = entries[0].Time
+	)
+	for i := 0; i < len(entries); {
+		j := i + 1
+		for j < len(entries) && entries[j].Time.Equal(entries[i].Time) {
+			j++
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Until(start.Add(entries[i].Time.Sub(first)))):
+		}
+		batch := entries[i:j]
+		if !eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+			pp, ok := ent.(*player.Player)
+			if !ok {
+				return
+			}
+			w, ok := c.writer(pp)
+			if !ok {
+				return
+			}
+			pos := pp.Position()
+			pks = pks[:0]
+			for _, e := range batch {
+				pks = append(pks, &packet.PlaySound{
+					SoundName: e.Sound,
+					Position:  [3]float32{float32(pos[0]) + e.Offset[0], float32(pos[1]) + e.Offset[1], float32(pos[2]) + e.Offset[2]},
+					Volume:    e.Volume,
+					Pitch:     e.Pitch,
+				})
+			}
+			writePackets(w, pks...)
+		}) {
+			// The player disconnected.
+			return
+		}
+		i = j
+	}
+}
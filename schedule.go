@@ -0,0 +1,136 @@
+package noteblockplayer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// ScheduledTick is a single tick of a playback schedule with the notes played on it.
+type ScheduledTick struct {
+	Tick  int    `json:"tick"`
+	Notes []Note `json:"notes"`
+}
+
+// Schedule returns the schedule a playback of the song with the options passed would follow: every tick
+// that has notes, in order, with the notes exactly as they would be played. It is meant for inspecting
+// timing problems without adding logging to the playback itself.
+func Schedule(song *Song, opts PlaybackOptions) []ScheduledTick {
+	var schedule []ScheduledTick
+	for tick, notes := range buildSchedule(song, opts) {
+		if len(notes) > 0 {
+			schedule = append(schedule, ScheduledTick{Tick: tick, Notes: notes})
+		}
+	}
+	return schedule
+}
+
+// DumpSchedule returns the Schedule of the song with the options passed, encoded as indented JSON.
+func DumpSchedule(song *Song, opts PlaybackOptions) ([]byte, error) {
+	return json.MarshalIndent(Schedule(song, opts), "", "  ")
+}
+
+// maxSwing is the largest swing a playback can have, as a fraction of a tick.
+const maxSwing = 0.9
+
+// swingDuration returns the time from the tick passed to the next one, for ticks of duration d played with
+// the swing passed (see PlaybackOptions.Swing). Off-beat ticks are odd ticks: the even tick before one is
+// lengthened by the swing, and the off-beat tick itself shortened by it.
+func swingDuration(tick int, d time.Duration, swing float64) time.Duration {
+	swing = min(max(swing, 0), maxSwing)
+	if swing == 0 {
+		return d
+	}
+	shift := time.Duration(float64(d) * swing)
+	if tick%2 == 0 {
+		return d + shift
+	}
+	return d - shift
+}
+
+// timingJitter returns a random offset of up to bound earlier or later, but no more than half of the tick
+// duration d, used to humanize the timing of ticks.
+func timingJitter(bound, d time.Duration) time.Duration {
+	bound = min(bound, d/2)
+	if bound <= 0 {
+		return 0
+	}
+	return rand.N(2*bound+1) - bound
+}
+
+// humanizeVelocity changes the velocity passed by a random amount of up to bound points up or down, keeping
+// it between 1 and 100. Silent notes stay silent.
+func humanizeVelocity(velocity, bound int) int {
+	if velocity <= 0 {
+		return velocity
+	}
+	return min(max(velocity+rand.N(2*bound+1)-bound, 1), 100)
+}
+
+// echoSettings are the echo options of a playback with their defaults applied.
+type echoSettings struct {
+	count, delay int
+	decay        float64
+}
+
+// newEchoSettings returns the echo settings of the PlaybackOptions passed.
+func newEchoSettings(opts PlaybackOptions) echoSettings {
+	e := echoSettings{count: max(opts.EchoCount, 0), delay: opts.EchoDelay, decay: opts.EchoDecay}
+	if e.delay <= 0 {
+		e.delay = 2
+	}
+	if e.decay <= 0 || e.decay > 1 {
+		e.decay = 0.5
+	}
+	return e
+}
+
+// note returns the k-th echo of the note passed, or false if it is too quiet to be heard.
+func (e echoSettings) note(n Note, k int) (Note, bool) {
+	n.Tick += k * e.delay
+	n.Velocity = int(math.Round(float64(n.Velocity) * math.Pow(e.decay, float64(k))))
+	return n, n.Velocity > 0
+}
+
+// defaultDumpTicks is the number of ticks /nbdump prints if no range is given.
+const defaultDumpTicks = 20
+
+// DumpScheduleCmd is the command to print the playback schedule of a song file for a range of ticks.
+type DumpScheduleCmd struct {
+	Filename string            `cmd:"filename"`
+	From     cmd.Optional[int] `cmd:"from"`
+	To       cmd.Optional[int] `cmd:"to"`
+}
+
+// AllowConsole allows this command from the server console.
+func (DumpScheduleCmd) AllowConsole() bool { return true }
+
+// Run loads the song in the background and prints the scheduled notes of every tick in the range.
+func (c DumpScheduleCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		from := c.From.LoadOr(0)
+		to := c.To.LoadOr(from + defaultDumpTicks - 1)
+
+		output.Printf("Schedule of %s, ticks %d-%d:", c.Filename, from, to)
+		for _, st := range Schedule(song, PlaybackOptions{}) {
+			if st.Tick < from || st.Tick > to {
+				continue
+			}
+			parts := make([]string, 0, len(st.Notes))
+			for _, n := range st.Notes {
+				parts = append(parts, fmt.Sprintf("L%d %s k%d v%d", n.Layer, instrumentName(n.Instrument), n.Key, n.Velocity))
+			}
+			output.Printf("%d: %s", st.Tick, strings.Join(parts, ", "))
+		}
+	})
+}
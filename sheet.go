@@ -0,0 +1,175 @@
+package noteblockplayer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/item"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// Limits of a written book shown by Bedrock clients. Lines are counted by the book writer, as longer pages
+// are cut off by the client even if they are below the character limit.
+const (
+	maxBookPages      = 50
+	maxBookPageLength = 256
+	bookPageLines     = 14
+)
+
+// keyNames are the names of the keys within an octave, starting at C.
+var keyNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// keyName returns the name of a Note Block Studio key, for example "A0" for key 0 and "F#4" for key 45.
+func keyName(key int) string {
+	// Key 0 is A0, which is 9 semitones above C0.
+	n := key + 9
+	if n < 0 {
+		return fmt.Sprintf("Key %d", key)
+	}
+	return fmt.Sprintf("%s%d", keyNames[n%12], n/12)
+}
+
+// SheetBook returns a written book summarizing the song: its title, author and length, the instruments
+// played on every layer, and a chart of the notes played by bar, beat and tick within the beat. Songs too
+// long to fit the book have their chart cut off.
+func SheetBook(song *Song) item.WrittenBook {
+	b := &bookWriter{}
+	b.line("§l" + song.displayName() + "§r")
+	if credits := song.credits(); credits != "" {
+		b.line("by " + credits)
+	}
+	b.line("")
+	b.line(fmt.Sprintf("Length: %s (%d ticks)", formatDuration(songElapsed(song, song.Length)), song.Length))
+	b.line(fmt.Sprintf("Tempo: %.2f t/s", song.Tempo))
+	b.line(fmt.Sprintf("Time signature: %d/4", song.BeatsPerBar()))
+	b.line(fmt.Sprintf("Notes: %d", len(song.Notes)))
+	b.page()
+
+	layers := make(map[int]map[int]int)
+	for _, n := range song.Notes {
+		if layers[n.Layer] == nil {
+			layers[n.Layer] = make(map[int]int)
+		}
+		layers[n.Layer][n.Instrument]++
+	}
+	order := make([]int, 0, len(layers))
+	for l := range layers {
+		order = append(order, l)
+	}
+	sort.Ints(order)
+	b.line("§lLayers§r")
+	for _, l := range order {
+		instruments := make([]int, 0, len(layers[l]))
+		for i := range layers[l] {
+			instruments = append(instruments, i)
+		}
+		sort.Ints(instruments)
+		parts := make([]string, 0, len(instruments))
+		for _, i := range instruments {
+			parts = append(parts, fmt.Sprintf("%s %d", instrumentName(i), layers[l][i]))
+		}
+		b.line(fmt.Sprintf("%d: %s", l+1, strings.Join(parts, ", ")))
+	}
+	b.page()
+
+	b.line("§lNotes§r (bar.beat.tick)")
+	for tick, notes := range buildSchedule(song, PlaybackOptions{}) {
+		if len(notes) == 0 {
+			continue
+		}
+		bar, beat := song.BarAtTick(tick)
+		keys := make([]string, len(notes))
+		for i, n := range notes {
+			keys[i] = keyName(n.Key)
+		}
+		if !b.line(fmt.Sprintf("%d.%d.%d %s", bar, beat, tick%ticksPerBeat+1, strings.Join(keys, " "))) {
+			break
+		}
+	}
+	b.page()
+
+	author := song.credits()
+	if author == "" {
+		author = "Unknown"
+	}
+	return item.WrittenBook{
+		Title:      song.displayName(),
+		Author:     author,
+		Generation: item.OriginalGeneration(),
+		Pages:      b.pages,
+	}
+}
+
+// bookWriter fills the pages of a written book line by line, starting a new page once one is full.
+type bookWriter struct {
+	pages []string
+	cur   strings.Builder
+	lines int
+}
+
+// line adds a line to the current page, or to a new page if it doesn't fit. Lines too long for a page are
+// cut off. It returns false if the book is full and the line was dropped.
+func (b *bookWriter) line(s string) bool {
+	if len(s) > maxBookPageLength {
+		s = s[:maxBookPageLength]
+	}
+	if b.lines >= bookPageLines || b.cur.Len()+len(s)+1 > maxBookPageLength {
+		b.page()
+	}
+	if len(b.pages) >= maxBookPages {
+		return false
+	}
+	if b.lines > 0 {
+		b.cur.WriteByte('\n')
+	}
+	b.cur.WriteString(s)
+	b.lines++
+	return true
+}
+
+// page finishes the current page, if it has any lines.
+func (b *bookWriter) page() {
+	if b.lines == 0 || len(b.pages) >= maxBookPages {
+		return
+	}
+	b.pages = append(b.pages, b.cur.String())
+	b.cur.Reset()
+	b.lines = 0
+}
+
+// SheetCmd is the command to get a written book with the sheet music of a song.
+type SheetCmd struct {
+	Song string `cmd:"song"`
+}
+
+// Run loads the song in the background and gives the player its sheet music book.
+func (c SheetCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	p, ok := src.(*player.Player)
+	if !ok {
+		output.Error("The nbsheet command is only valid for players")
+		return
+	}
+	eh, tw := p.H(), w.World()
+	go func() {
+		song, err := loadSongWithProgress(eh, tw, c.Song)
+		if err != nil {
+			messagePlayer(eh, fmt.Sprintf("§cFailed to load file: %v", err))
+			return
+		}
+		book := item.NewStack(SheetBook(song), 1)
+		_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+			pp, ok := ent.(*player.Player)
+			if !ok {
+				return
+			}
+			if _, err := pp.Inventory().AddItem(book); err != nil {
+				pp.Message("§cYour inventory is full")
+				return
+			}
+			pp.Messagef("Here is the sheet music of %s", song.displayName())
+		})
+	}()
+}
@@ -0,0 +1,85 @@
+package noteblockplayer
+
+import (
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// ShowContext is passed to the cues of a Show when a playback reaches them.
+type ShowContext struct {
+	// Tx is the transaction of the world of the player, which the cue changes the world with, for example to
+	// launch fireworks or place blocks.
+	Tx *world.Tx
+	// Player is the player the song is played to.
+	Player *player.Player
+	// Song is the song playing, and Tick the tick it reached.
+	Song *Song
+	Tick int
+}
+
+// Show binds effects to the ticks and markers of a song, so light shows stay locked to the music: every cue
+// is called inside the world transaction that plays the notes of its tick, so the effects happen in the same
+// server tick as the notes they belong to. A Show is played by passing it in PlaybackOptions.Show. Cues
+// must not block, as they hold up the playback and the world.
+//
+// Example usage:
+//
+//	show := noteblockplayer.NewShow().
+//	    OnMarker("drop", func(ctx noteblockplayer.ShowContext) {
+//	        ctx.Tx.AddEntity(entity.NewFirework(world.EntitySpawnOpts{Position: stage}, item.Firework{}))
+//	    }).
+//	    OnTick(640, func(ctx noteblockplayer.ShowContext) {
+//	        ctx.Tx.SetBlock(lamp, block.Glowstone{}, nil)
+//	    })
+//	_ = noteblockplayer.PlayNoteblockWithOptions(p.H(), "finale", noteblockplayer.PlaybackOptions{Show: show})
+type Show struct {
+	mu      sync.Mutex
+	ticks   map[int][]func(ShowContext)
+	markers map[string][]func(ShowContext)
+}
+
+// NewShow returns a Show without cues.
+func NewShow() *Show {
+	return &Show{
+		ticks:   make(map[int][]func(ShowContext)),
+		markers: make(map[string][]func(ShowContext)),
+	}
+}
+
+// OnTick adds a cue called whenever the song reaches the tick passed. It returns the show, so cues can be
+// chained.
+func (s *Show) OnTick(tick int, f func(ShowContext)) *Show {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ticks[tick] = append(s.ticks[tick], f)
+	return s
+}
+
+// OnMarker adds a cue called whenever the song reaches a marker with the name passed (see Song.Markers). It
+// returns the show, so cues can be chained.
+func (s *Show) OnMarker(marker string, f func(ShowContext)) *Show {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markers[marker] = append(s.markers[marker], f)
+	return s
+}
+
+// schedule returns the cues of the show for the song passed, indexed by the tick they are called at. Cues
+// added once the song started playing are not picked up by it.
+func (s *Show) schedule(song *Song) map[int][]func(ShowContext) {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cues := make(map[int][]func(ShowContext), len(s.ticks))
+	for tick, fs := range s.ticks {
+		cues[tick] = append(cues[tick], fs...)
+	}
+	for _, m := range song.Markers {
+		cues[m.Tick] = append(cues[m.Tick], s.markers[m.Name]...)
+	}
+	return cues
+}
@@ -0,0 +1,130 @@
+package noteblockplayer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// packSignatureExt is appended to the file name of a pack to get the name of its signature file, for example
+// "classics.zip.sig".
+const packSignatureExt = ".sig"
+
+// ErrPackSignature is returned for packs without a valid signature while a pack public key is set.
+var ErrPackSignature = errors.New("invalid pack signature")
+
+// packKey is the key set with SetPackPublicKey, and verifiedPacks the packs whose signature was checked,
+// by path. packKeyMtx protects access to both.
+var (
+	packKey       ed25519.PublicKey
+	verifiedPacks = make(map[string]verifiedPack)
+	packKeyMtx    sync.Mutex
+)
+
+// verifiedPack is the result of checking the signature of a pack, valid as long as the pack and signature
+// files don't change.
+type verifiedPack struct {
+	modTime, sigModTime time.Time
+	size                int64
+	err                 error
+}
+
+// SetPackPublicKey sets the ed25519 public key that song packs must be signed with. Once set, packs are
+// only listed and played if a valid signature is stored next to them as "<pack>.zip.sig", holding the 64
+// byte signature of the .zip file, either raw or base64 encoded. Packs uploaded through the HTTP API must
+// pass their signature as well. Passing nil turns verification off again, which is the default.
+//
+// Networks distributing packs to many servers can sign them once, so that a pack altered on its way to a
+// server is never played:
+//
+//	sig := ed25519.Sign(privateKey, packData)
+//	_ = os.WriteFile("classics.zip.sig", []byte(base64.StdEncoding.EncodeToString(sig)), 0644)
+func SetPackPublicKey(key ed25519.PublicKey) {
+	packKeyMtx.Lock()
+	packKey = key
+	clear(verifiedPacks)
+	packKeyMtx.Unlock()
+	// Pack songs loaded with a different key (or without one) must be verified again.
+	ClearSongCache()
+}
+
+// packPublicKey returns the key set with SetPackPublicKey, or nil if packs aren't verified.
+func packPublicKey() ed25519.PublicKey {
+	packKeyMtx.Lock()
+	defer packKeyMtx.Unlock()
+	return packKey
+}
+
+// VerifyPack checks that sig is a valid signature of the pack data passed for the key set with
+// SetPackPublicKey. sig may be raw or base64 encoded. VerifyPack always succeeds if no key is set.
+func VerifyPack(data, sig []byte) error {
+	key := packPublicKey()
+	if key == nil {
+		return nil
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("pack public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	sig, err := decodeSignature(sig)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return ErrPackSignature
+	}
+	return nil
+}
+
+// decodeSignature returns the raw ed25519 signature held by the data passed, which is either the raw
+// signature or its base64 encoding.
+func decodeSignature(data []byte) ([]byte, error) {
+	if len(data) == ed25519.SignatureSize {
+		return data, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: signature must be %d bytes", ErrPackSignature, ed25519.SignatureSize)
+	}
+	return sig, nil
+}
+
+// verifyPackFile checks the signature of the pack at the path passed, with the file info passed, against the
+// key set with SetPackPublicKey. The result is remembered until the pack or its signature changes, so big
+// packs aren't read in full every time a song is played from them.
+func verifyPackFile(p string, info fs.FileInfo) error {
+	if packPublicKey() == nil {
+		return nil
+	}
+	sigInfo, err := os.Stat(p + packSignatureExt)
+	if err != nil {
+		return fmt.Errorf("%w: %s is missing", ErrPackSignature, info.Name()+packSignatureExt)
+	}
+	packKeyMtx.Lock()
+	v, ok := verifiedPacks[p]
+	packKeyMtx.Unlock()
+	if ok && v.modTime.Equal(info.ModTime()) && v.size == info.Size() && v.sigModTime.Equal(sigInfo.ModTime()) {
+		return v.err
+	}
+
+	v = verifiedPack{modTime: info.ModTime(), sigModTime: sigInfo.ModTime(), size: info.Size()}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(p + packSignatureExt)
+	if err != nil {
+		return err
+	}
+	v.err = VerifyPack(data, sig)
+
+	packKeyMtx.Lock()
+	verifiedPacks[p] = v
+	packKeyMtx.Unlock()
+	return v.err
+}
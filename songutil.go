@@ -0,0 +1,248 @@
+package noteblockplayer
+
+import (
+	"math"
+	"slices"
+)
+
+// Key range of Note Block Studio: key 0 is A0 and key 87 is C8.
+const (
+	minNoteKey = 0
+	maxNoteKey = 87
+)
+
+// Key range a vanilla note block can play: key 33 is F#3 and key 57 is F#5.
+const (
+	minVanillaKey = 33
+	maxVanillaKey = 57
+)
+
+// clone returns a copy of the song with its own Notes slice, so the copy can be edited without
+// changing the original.
+func (s *Song) clone() *Song {
+	c := *s
+	c.Notes = make([]Note, len(s.Notes))
+	copy(c.Notes, s.Notes)
+	return &c
+}
+
+// foldKey moves a key into the range [lo, hi] by whole octaves, so out-of-range notes keep their pitch
+// class. Ranges smaller than an octave are clamped instead.
+func foldKey(key, lo, hi int) int {
+	if hi-lo < 11 {
+		return min(max(key, lo), hi)
+	}
+	for key < lo {
+		key += 12
+	}
+	for key > hi {
+		key -= 12
+	}
+	return key
+}
+
+// transposeKey shifts a key by the number of semitones passed, folding the result back into the
+// Note Block Studio key range by octaves if it falls outside of it.
+func transposeKey(key, semitones int) int {
+	return foldKey(key+semitones, minNoteKey, maxNoteKey)
+}
+
+// Transpose returns a copy of the song with every note shifted by the number of semitones passed
+// (negative values shift down). Notes that would fall outside of the Note Block Studio key range
+// (A0 to C8) are folded back into it by octaves.
+func (s *Song) Transpose(semitones int) *Song {
+	c := s.clone()
+	for i := range c.Notes {
+		c.Notes[i].Key = transposeKey(c.Notes[i].Key, semitones)
+	}
+	return c
+}
+
+// Quantize returns a copy of the song with every note tick snapped to the nearest multiple of gridTicks.
+// Notes that end up on the same tick with the same instrument and key are merged into one, keeping the
+// loudest velocity, which cleans up the slightly offset duplicates MIDI imports often contain.
+// Notes sharing a tick and layer after snapping are moved to the next free layer.
+// A gridTicks below 2 returns an unchanged copy.
+func (s *Song) Quantize(gridTicks int) *Song {
+	c := s.clone()
+	if gridTicks < 2 {
+		return c
+	}
+
+	type noteID struct{ tick, instrument, key int }
+	type layerID struct{ tick, layer int }
+	merged := make(map[noteID]int, len(c.Notes))
+	usedLayers := make(map[layerID]struct{}, len(c.Notes))
+
+	notes := c.Notes[:0]
+	for _, n := range c.Notes {
+		n.Tick = (n.Tick + gridTicks/2) / gridTicks * gridTicks
+		id := noteID{n.Tick, n.Instrument, n.Key}
+		if i, dup := merged[id]; dup {
+			notes[i].Velocity = max(notes[i].Velocity, n.Velocity)
+			continue
+		}
+		for {
+			if _, taken := usedLayers[layerID{n.Tick, n.Layer}]; !taken {
+				break
+			}
+			n.Layer++
+		}
+		usedLayers[layerID{n.Tick, n.Layer}] = struct{}{}
+		merged[id] = len(notes)
+		notes = append(notes, n)
+		c.Length = max(c.Length, n.Tick)
+	}
+	c.Notes = notes
+	return c
+}
+
+// Harmonize returns a copy of the song with the notes of the layers passed duplicated once for every
+// interval, transposed by that many semitones, for instant harmonies of simple melodies: intervals of 4
+// and 7 turn every note into a major triad. Passing no layers harmonizes every layer. The harmony of every
+// layer and interval is put on a new layer after the existing ones, so it can be muted on its own. Notes
+// that would fall outside of the Note Block Studio key range are folded back into it by octaves.
+//
+// Example usage:
+//
+//	harmonized := song.Harmonize([]int{4, 7}, []int{0})
+func (s *Song) Harmonize(intervals []int, layers []int) *Song {
+	c := s.clone()
+	next := 0
+	for _, n := range s.Notes {
+		next = max(next, n.Layer+1)
+	}
+	type harmonyID struct{ layer, interval int }
+	harmonyLayers := make(map[harmonyID]int)
+	for i, interval := range intervals {
+		if interval == 0 {
+			continue
+		}
+		for _, n := range s.Notes {
+			if len(layers) > 0 && !slices.Contains(layers, n.Layer) {
+				continue
+			}
+			id := harmonyID{n.Layer, i}
+			layer, ok := harmonyLayers[id]
+			if !ok {
+				layer, next = next, next+1
+				harmonyLayers[id] = layer
+			}
+			n.Key, n.Layer = transposeKey(n.Key, interval), layer
+			c.Notes = append(c.Notes, n)
+		}
+	}
+	return c
+}
+
+// ExtractLayers returns a copy of the song with only the notes of the layers passed, for example to learn
+// or practise a single part of it. The notes keep their layers and the song keeps its length, so the parts
+// stay in time with the full song.
+//
+// Example usage:
+//
+//	melody := song.ExtractLayers(0, 1)
+func (s *Song) ExtractLayers(layers ...int) *Song {
+	c := s.clone()
+	c.Notes = slices.DeleteFunc(c.Notes, func(n Note) bool {
+		return !slices.Contains(layers, n.Layer)
+	})
+	return c
+}
+
+// ConcatSongs returns a new song playing song b after song a, with gapTicks ticks of silence between them, so
+// medleys can be built and saved with SaveSong. Song b is played at the tempo of song a: its notes, lyrics
+// and markers are moved to the ticks that keep their timing at that tempo. Notes of song b that end up on the
+// same tick and layer are moved to the next free layer. The new song keeps the title, author and other
+// details of song a.
+//
+// Example usage:
+//
+//	medley := noteblockplayer.ConcatSongs(intro, chorus, 20)
+//	err := noteblockplayer.SaveSong("noteblock/medley.nbs", medley)
+func ConcatSongs(a, b *Song, gapTicks int) *Song {
+	c := combineBase(a, b)
+	c.addSong(b, max(a.Length, 0)+1+max(gapTicks, 0), 0)
+	return c
+}
+
+// MergeSongs returns a new song playing songs a and b at the same time, for example to add a percussion
+// track to an existing melody. The layers of song b are put after the layers of song a, so either part can
+// still be muted on its own. Like with ConcatSongs, song b is played at the tempo of song a and the new song
+// keeps the title, author and other details of song a.
+//
+// Example usage:
+//
+//	withDrums := noteblockplayer.MergeSongs(melody, drums)
+func MergeSongs(a, b *Song) *Song {
+	c := combineBase(a, b)
+	layers := 0
+	for _, n := range a.Notes {
+		layers = max(layers, n.Layer+1)
+	}
+	c.addSong(b, 0, layers)
+	return c
+}
+
+// combineBase returns the copy of song a that song b is added to by ConcatSongs and MergeSongs.
+func combineBase(a, b *Song) *Song {
+	c := a.clone()
+	c.Lyrics, c.Markers, c.Warnings = slices.Clone(a.Lyrics), slices.Clone(a.Markers), nil
+	c.TempoChanges = slices.Clone(a.TempoChanges)
+	if c.Tempo <= 0 {
+		c.Tempo = b.Tempo
+	}
+	return c
+}
+
+// addSong adds the notes, lyrics, markers and tempo changes of song b to the song, played at the tempo of the
+// song from the tick start onwards, with the layers of its notes moved up by layerOffset. Notes that end up
+// on the same tick and layer are moved to the next free layer.
+func (s *Song) addSong(b *Song, start, layerOffset int) {
+	scale := 1.0
+	if b.Tempo > 0 && s.Tempo > 0 {
+		scale = s.Tempo / b.Tempo
+	}
+	tick := func(t int) int {
+		return start + int(math.Round(float64(t)*scale))
+	}
+
+	type layerID struct{ tick, layer int }
+	usedLayers := make(map[layerID]struct{}, len(s.Notes)+len(b.Notes))
+	for _, n := range s.Notes {
+		usedLayers[layerID{n.Tick, n.Layer}] = struct{}{}
+	}
+	for _, n := range b.Notes {
+		n.Tick, n.Layer = tick(n.Tick), n.Layer+layerOffset
+		for {
+			if _, taken := usedLayers[layerID{n.Tick, n.Layer}]; !taken {
+				break
+			}
+			n.Layer++
+		}
+		usedLayers[layerID{n.Tick, n.Layer}] = struct{}{}
+		s.Notes = append(s.Notes, n)
+	}
+	for _, l := range b.Lyrics {
+		l.Tick = tick(l.Tick)
+		s.Lyrics = append(s.Lyrics, l)
+	}
+	for _, m := range b.Markers {
+		m.Tick = tick(m.Tick)
+		s.Markers = append(s.Markers, m)
+	}
+	if start > 0 && len(s.TempoChanges)+len(b.TempoChanges) > 0 {
+		// Song b starts at the tempo of the song, not at the last tempo the song changed to.
+		s.TempoChanges = append(s.TempoChanges, TempoChange{Tick: start, Tempo: s.Tempo})
+	}
+	for _, ch := range b.TempoChanges {
+		ch.Tick, ch.Tempo = tick(ch.Tick), ch.Tempo*scale
+		s.TempoChanges = append(s.TempoChanges, ch)
+	}
+	s.Length = max(s.Length, tick(max(b.Length, 0)))
+	if len(s.TempoChanges) > 0 {
+		s.Duration = newTempoCurve(s, PlaybackOptions{}).elapsed(s.Length).Seconds()
+	} else if s.Tempo > 0 {
+		s.Duration = float64(s.Length) / s.Tempo
+	}
+}
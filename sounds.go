@@ -0,0 +1,123 @@
+package noteblockplayer
+
+import (
+	"maps"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// soundNames holds the sound names set with SetInstrumentSoundName. It is replaced as a whole whenever a
+// name is set, so playbacks can read it for every note without locking.
+var (
+	soundNames    atomic.Pointer[map[int]string]
+	soundNamesMtx sync.Mutex
+)
+
+// SetInstrumentSoundName sets the Bedrock sound name the notes of the instrument index passed are sent as in
+// PlaySound packets, replacing the vanilla note sound, for example to play the piano with a sound of a
+// resource pack. It also applies to custom instruments without a fallback set with SetInstrumentFallback.
+// Passing an empty name restores the default sound. Songs that are already playing pick up the new name
+// with their next note.
+//
+// Example usage:
+//
+//	noteblockplayer.SetInstrumentSoundName(0, "custom.grand_piano")
+func SetInstrumentSoundName(instrument int, name string) {
+	soundNamesMtx.Lock()
+	defer soundNamesMtx.Unlock()
+	names := make(map[int]string)
+	if old := soundNames.Load(); old != nil {
+		maps.Copy(names, *old)
+	}
+	if name == "" {
+		delete(names, instrument)
+	} else {
+		names[instrument] = name
+	}
+	soundNames.Store(&names)
+}
+
+// InstrumentSoundName returns the Bedrock sound name the notes of the instrument index passed are sent as.
+// Instruments without a sound name set with SetInstrumentSoundName use their vanilla note sound, and unknown
+// instruments the harp.
+func InstrumentSoundName(instrument int) string {
+	return instrumentSoundName(instrument)
+}
+
+// customSoundName returns the sound name set with SetInstrumentSoundName for the instrument passed, if any.
+func customSoundName(instrument int) (string, bool) {
+	if names := soundNames.Load(); names != nil {
+		name, ok := (*names)[instrument]
+		return name, ok
+	}
+	return "", false
+}
+
+// notePitch returns the float pitch a note is played at with PlaySound packets, shifted by the number of
+// semitones passed. Unlike note block pitches, it includes the fine pitch of the note, in cents.
+func notePitch(note Note, semitones int) float32 {
+	return float32(0.5 * math.Pow(2, (float64(note.Key+semitones-33)+float64(note.Pitch)/100)/12))
+}
+
+// noteBlockHearingRange is the distance up to which players are sent the sounds of note blocks played with
+// PlaybackOptions.NoteBlockPackets.
+const noteBlockHearingRange = 48
+
+// playNoteBlockSounds sends the sounds of the notes played through the note blocks of the playback as
+// PlaySound packets to every player within hearing range of them, with the velocity and fine pitch of the
+// notes and the sound names of their instruments. It is executed in the player's world.
+func (pb *playback) playNoteBlockSounds(tx *world.Tx, notes []Note) {
+	positions := pb.opts.NoteBlocks
+	if len(notes) == 0 || len(positions) == 0 {
+		return
+	}
+	if pb.blockWriters == nil {
+		pb.blockWriters = make(map[*world.EntityHandle]*writerCache)
+	}
+	mix := math.Float32frombits(pb.duck.Load()) * channelVolume(pb.opts.Channel)
+	for e := range tx.Players() {
+		p, ok := e.(*player.Player)
+		if !ok || IsMuted(p.H()) {
+			continue
+		}
+		c, ok := pb.blockWriters[p.H()]
+		if !ok {
+			c = &writerCache{}
+			pb.blockWriters[p.H()] = c
+		}
+		w, ok := c.writer(p)
+		if !ok {
+			continue
+		}
+		volume, pitch := pb.prefs.get(p.H())
+		pack := hasResourcePack(p)
+		pks := pb.pks[:0]
+		pb.sounds.reset()
+		for _, note := range notes {
+			pos, ok := noteBlockPos(positions, note)
+			if !ok || !pb.layers.allows(note.Layer) || p.Position().Sub(pos.Vec3Centre()).Len() > noteBlockHearingRange {
+				continue
+			}
+			name := pb.instruments.sound(note.Instrument, pack)
+			pks = append(pks, pb.sounds.sound(name, pos.Vec3Centre(), noteVolume(note)*volume*mix, notePitch(note, pitch)))
+			pb.played[name] = struct{}{}
+		}
+		if len(pks) > 0 {
+			writePackets(w, pks...)
+		}
+		pb.pks = pks
+	}
+}
+
+// noteBlockPos returns the position of the note block the note is played through, bound to its layer.
+func noteBlockPos(positions []cube.Pos, note Note) (cube.Pos, bool) {
+	if len(positions) == 0 || note.Layer < 0 {
+		return cube.Pos{}, false
+	}
+	return positions[note.Layer%len(positions)], true
+}
@@ -0,0 +1,90 @@
+package noteblockplayer
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// StereoMode decides how the panning of notes played directly to the player is reproduced. Bedrock has no
+// stereo panning for sounds, so it can only be approximated by where the sounds are played.
+type StereoMode int
+
+const (
+	// StereoOff plays every note at the player's position, ignoring its panning. This is the default.
+	StereoOff StereoMode = iota
+	// StereoDual plays heavily panned notes from two positions to the left and right of the player, with
+	// the volume split between them by the note's panning, which approximates stereo width.
+	StereoDual
+)
+
+// stereoThreshold is how far from the centre (0 to 1) a note must be panned for StereoDual to split it.
+// Lightly panned notes are played at the player's position, so they keep their full volume.
+const stereoThreshold = 0.25
+
+// stereoOffset is the distance in blocks from the player at which the left and right sounds are played.
+const stereoOffset = 2.0
+
+// notePan returns the panning of the note from -1 (left) to 1 (right). NBS panning goes from 0 (left) to
+// 200 (right), with 100 being the centre. A panning of 0 is treated as centred, since songs that don't
+// store panning leave it out.
+func notePan(note Note) float64 {
+	if note.Panning == 0 {
+		return 0
+	}
+	return max(-1, min(1, float64(note.Panning-100)/100))
+}
+
+// stereoRight returns the unit vector pointing to the right of a player with the yaw passed.
+func stereoRight(yaw float64) mgl64.Vec3 {
+	yawRad := mgl64.DegToRad(yaw)
+	return mgl64.Vec3{-math.Cos(yawRad), 0, -math.Sin(yawRad)}
+}
+
+// appendNoteSound appends the PlaySound packets of a note played at the listener position pos to pks, taking
+// the packets from buf. With StereoDual, heavily panned notes are split into a left and right sound using
+// constant-power weighting, where right is the listener's right vector.
+func appendNoteSound(pks []packet.Packet, buf *soundBuffer, mode StereoMode, name string, pos, right mgl64.Vec3, volume, pitch float32, pan float64) []packet.Packet {
+	if mode != StereoDual || math.Abs(pan) < stereoThreshold {
+		return append(pks, buf.sound(name, pos, volume, pitch))
+	}
+	angle := (pan + 1) * math.Pi / 4
+	if l := volume * float32(math.Cos(angle)); l > 0.01 {
+		pks = append(pks, buf.sound(name, pos.Sub(right.Mul(stereoOffset)), l, pitch))
+	}
+	if r := volume * float32(math.Sin(angle)); r > 0.01 {
+		pks = append(pks, buf.sound(name, pos.Add(right.Mul(stereoOffset)), r, pitch))
+	}
+	return pks
+}
+
+// soundBuffer hands out reusable PlaySound packets, so that once it has grown to the largest batch of a
+// song, playing a tick doesn't allocate a packet per note. Packets are written synchronously, so they can be
+// reused for the next batch as soon as the current one was written.
+type soundBuffer struct {
+	sounds []*packet.PlaySound
+	n      int
+}
+
+// reset makes all packets of the buffer available again. The packets handed out before must no longer be
+// used.
+func (b *soundBuffer) reset() {
+	b.n = 0
+}
+
+// sound returns a PlaySound packet of the buffer playing the sound passed at pos.
+func (b *soundBuffer) sound(name string, pos mgl64.Vec3, volume, pitch float32) *packet.PlaySound {
+	if b.n == len(b.sounds) {
+		b.sounds = append(b.sounds, &packet.PlaySound{})
+	}
+	pk := b.sounds[b.n]
+	b.n++
+	*pk = packet.PlaySound{
+		SoundName: name,
+		Position:  [3]float32{float32(pos[0]), float32(pos[1]), float32(pos[2])},
+		Volume:    volume,
+		Pitch:     pitch,
+	}
+	return pk
+}
@@ -0,0 +1,58 @@
+package noteblockplayer
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Surround places speakers around a stage, so that large venues sound like they have a speaker setup: every
+// note is played from the front left and front right speakers, with the volume split between them by the
+// panning of the note, and centred notes are played from the rear speaker too. Like with StereoDual, the
+// sounds are played close to every listener, in the direction of each speaker, so the direction can be heard
+// from anywhere in the venue.
+type Surround struct {
+	// FrontLeft, FrontRight and Rear are the positions of the speakers.
+	FrontLeft, FrontRight, Rear mgl64.Vec3
+	// RearVolume is the volume, from 0 to 1, of the rear speaker for centred notes, relative to the front
+	// speakers. The more a note is panned, the quieter it is on the rear speaker. It defaults to 0.5.
+	RearVolume float64
+}
+
+// defaultRearVolume is the volume of the rear speaker if Surround.RearVolume is not set.
+const defaultRearVolume = 0.5
+
+// appendSounds appends the PlaySound packets of a note played through the speakers to the listener at the
+// position passed to pks, taking the packets from buf. The volume of every speaker is lowered by its distance
+// to the listener following the Attenuation passed.
+func (s *Surround) appendSounds(pks []packet.Packet, buf *soundBuffer, name string, listener mgl64.Vec3, volume, pitch float32, pan float64, a Attenuation) []packet.Packet {
+	rear := s.RearVolume
+	if rear <= 0 {
+		rear = defaultRearVolume
+	}
+	angle := (pan + 1) * math.Pi / 4
+	speakers := [3]struct {
+		pos  mgl64.Vec3
+		gain float64
+	}{
+		{s.FrontLeft, math.Cos(angle)},
+		{s.FrontRight, math.Sin(angle)},
+		{s.Rear, min(rear, 1) * (1 - math.Abs(pan))},
+	}
+	for _, speaker := range speakers {
+		d := speaker.pos.Sub(listener)
+		dist := d.Len()
+		v := volume * float32(speaker.gain*a.Volume(dist))
+		if v <= 0.01 {
+			continue
+		}
+		// Speakers further away are played close to the listener, in their direction.
+		pos := speaker.pos
+		if dist > stereoOffset {
+			pos = listener.Add(d.Mul(stereoOffset / dist))
+		}
+		pks = append(pks, buf.sound(name, pos, v, pitch))
+	}
+	return pks
+}
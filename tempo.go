@@ -0,0 +1,151 @@
+package noteblockplayer
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TempoChange is a point of the tempo automation of a song: from its tick on, the song plays at its tempo.
+// Tempo changes are read from the tempo changer notes of NBS files, or set in the `tempoChanges` field of a
+// JSON song.
+type TempoChange struct {
+	Tick int `json:"tick"`
+	// Tempo is the tempo in ticks per second.
+	Tempo float64 `json:"tempo"`
+	// Ramp changes the tempo smoothly from the previous point (or the tempo of the song) up to this one, for
+	// an accelerando or ritardando, instead of changing it at the tick of the point.
+	Ramp bool `json:"ramp,omitempty"`
+}
+
+// tempoChangerName is the name of the custom instrument Note Block Studio uses for tempo changers. The pitch
+// of their notes holds the tempo in beats per minute, 15 times the tempo in ticks per second.
+const tempoChangerName = "Tempo Changer"
+
+// customInstrumentKey is the key custom instruments, such as tempo changers, are written with: F#4, like in
+// Note Block Studio.
+const customInstrumentKey = 45
+
+// TempoAt returns the tempo (ticks per second) of the song at the tick passed, following its TempoChanges.
+func (s *Song) TempoAt(tick int) float64 {
+	return newTempoCurve(s, PlaybackOptions{}).at(tick)
+}
+
+// tempoCurve is the tempo of a song over its ticks, as played with a set of PlaybackOptions.
+type tempoCurve struct {
+	// base is the tempo before the first change, and scale the factor PlaybackOptions.Tempo changes all
+	// tempos by.
+	base, scale float64
+	// changes are the tempo changes of the song, sorted by tick.
+	changes []TempoChange
+}
+
+// newTempoCurve returns the tempo curve of the song played with the PlaybackOptions passed. A tempo set in
+// the options replaces the tempo of the song, and the tempo changes are scaled along with it.
+func newTempoCurve(song *Song, opts PlaybackOptions) tempoCurve {
+	c := tempoCurve{base: song.Tempo, scale: 1}
+	if c.base <= 0 {
+		c.base = 20
+	}
+	if opts.Tempo > 0 {
+		c.scale = opts.Tempo / c.base
+	}
+	for _, ch := range song.TempoChanges {
+		if ch.Tempo > 0 && ch.Tick >= 0 {
+			c.changes = append(c.changes, ch)
+		}
+	}
+	slices.SortStableFunc(c.changes, func(a, b TempoChange) int { return cmp.Compare(a.Tick, b.Tick) })
+	return c
+}
+
+// at returns the tempo at the tick passed.
+func (c tempoCurve) at(tick int) float64 {
+	from, tempo := 0, c.base
+	for _, ch := range c.changes {
+		if ch.Tick > tick {
+			if ch.Ramp && ch.Tick > from {
+				tempo += (ch.Tempo - tempo) * float64(tick-from) / float64(ch.Tick-from)
+			}
+			break
+		}
+		from, tempo = ch.Tick, ch.Tempo
+	}
+	return tempo * c.scale
+}
+
+// tickDuration returns how long the tick passed lasts.
+func (c tempoCurve) tickDuration(tick int) time.Duration {
+	return ticksDuration(1, c.at(tick))
+}
+
+// elapsed returns how long it takes to play the first ticks of the song.
+func (c tempoCurve) elapsed(ticks int) time.Duration {
+	if len(c.changes) == 0 {
+		return ticksDuration(ticks, c.base*c.scale)
+	}
+	var d time.Duration
+	for tick := range max(ticks, 0) {
+		d += c.tickDuration(tick)
+	}
+	return d
+}
+
+// tickStarts returns the time every tick from 0 up to and including the last tick passed starts at.
+func (c tempoCurve) tickStarts(last int) []time.Duration {
+	starts := make([]time.Duration, last+1)
+	for tick := 1; tick <= last; tick++ {
+		starts[tick] = starts[tick-1] + c.tickDuration(tick-1)
+	}
+	return starts
+}
+
+// tickAt returns the tick the song is at after playing for the duration passed, rounded to the nearest tick.
+// It is the inverse of elapsed.
+func (c tempoCurve) tickAt(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	if len(c.changes) == 0 {
+		return int(math.Round(d.Seconds() * c.base * c.scale))
+	}
+	// Up to the last change, the duration of every tick is added up. The tempo stays the same after it.
+	last := c.changes[len(c.changes)-1].Tick
+	var elapsed time.Duration
+	for tick := 0; tick < last; tick++ {
+		next := elapsed + c.tickDuration(tick)
+		if next >= d {
+			if d-elapsed < next-d {
+				return tick
+			}
+			return tick + 1
+		}
+		elapsed = next
+	}
+	return last + int(math.Round((d-elapsed).Seconds()*c.at(last)))
+}
+
+// splitTempoChangers removes the notes of the tempo changer instrument from the notes passed, and returns
+// the tempo changes they stand for. instruments are the names of the custom instruments of the NBS file,
+// which follow the vanilla instruments.
+func splitTempoChangers(notes []Note, vanilla int, instruments []string) ([]Note, []TempoChange) {
+	i := slices.IndexFunc(instruments, func(name string) bool { return strings.EqualFold(name, tempoChangerName) })
+	if i < 0 {
+		return notes, nil
+	}
+	changer := vanilla + i
+	var changes []TempoChange
+	notes = slices.DeleteFunc(notes, func(n Note) bool {
+		if n.Instrument != changer {
+			return false
+		}
+		// Of several tempo changers on the same tick, the one on the lowest layer wins.
+		if len(changes) == 0 || changes[len(changes)-1].Tick != n.Tick {
+			changes = append(changes, TempoChange{Tick: n.Tick, Tempo: math.Abs(float64(n.Pitch)) / 15})
+		}
+		return true
+	})
+	return notes, changes
+}
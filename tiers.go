@@ -0,0 +1,115 @@
+package noteblockplayer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// Tier holds the limits of the song requests of a group of players, for example donors or default players.
+// Zero values mean no limit.
+type Tier struct {
+	// Name is the name of the tier, shown to players when a request exceeds its limits.
+	Name string
+	// MaxDuration is the longest song, at its own tempo, players of the tier may request.
+	MaxDuration time.Duration
+	// MaxQueue is the number of songs players of the tier may have waiting in their queue.
+	MaxQueue int
+	// Tags, if not empty, limits the songs players of the tier may request to the songs with one of these
+	// tags (see TagSongs).
+	Tags []string
+}
+
+// tierFunc holds the function set with SetTierFunc.
+var tierFunc atomic.Pointer[func(p *player.Player) Tier]
+
+// SetTierFunc sets the function returning the Tier of a player, which limits the songs they may request
+// with commands and the song browser. The function is called for every request, with the world
+// transaction of the player open. Passing nil removes all limits, which is the default.
+//
+// Example usage (donors play songs up to 10 minutes, everyone else up to 2 minutes):
+//
+//	donor := noteblockplayer.Tier{Name: "Donor", MaxDuration: 10 * time.Minute, MaxQueue: 10}
+//	normal := noteblockplayer.Tier{Name: "Default", MaxDuration: 2 * time.Minute, MaxQueue: 3}
+//	noteblockplayer.SetTierFunc(func(p *player.Player) noteblockplayer.Tier {
+//	    if donors[p.UUID()] {
+//	        return donor
+//	    }
+//	    return normal
+//	})
+func SetTierFunc(f func(p *player.Player) Tier) {
+	if f == nil {
+		tierFunc.Store(nil)
+		return
+	}
+	tierFunc.Store(&f)
+}
+
+// PlayerTier returns the Tier of the player set with SetTierFunc, or a Tier without limits if none is set.
+// It must be called with the world transaction of the player open.
+func PlayerTier(p *player.Player) Tier {
+	if f := tierFunc.Load(); f != nil {
+		return (*f)(p)
+	}
+	return Tier{}
+}
+
+// Allows checks whether a player of the tier may request the song passed. queued is the number of songs the
+// player has in their queue if the song is added to it, or -1 if the song plays right away. The error
+// returned wraps ErrNotAllowed.
+func (t Tier) Allows(song *Song, queued int) error {
+	if d := songElapsed(song, song.Length); t.MaxDuration > 0 && d > t.MaxDuration {
+		return fmt.Errorf("%w: songs of %s are limited to %s, this song takes %s", ErrNotAllowed, t.name(), formatDuration(t.MaxDuration), formatDuration(d))
+	}
+	if t.MaxQueue > 0 && queued >= t.MaxQueue {
+		return fmt.Errorf("%w: queues of %s are limited to %d songs", ErrNotAllowed, t.name(), t.MaxQueue)
+	}
+	if len(t.Tags) > 0 && !slices.ContainsFunc(t.Tags, func(tag string) bool {
+		return containsSong(SongsWithTag(tag), song.name)
+	}) {
+		return fmt.Errorf("%w: %s may only play songs tagged %v", ErrNotAllowed, t.name(), t.Tags)
+	}
+	return nil
+}
+
+// name returns the name of the tier as shown to players.
+func (t Tier) name() string {
+	if t.Name == "" {
+		return "your rank"
+	}
+	return t.Name
+}
+
+// checkRequest checks the song requested by the player against their Tier, and charges them for it if it is
+// allowed. queue is true if the song is added to the player's queue. It must be called with the world
+// transaction of the player open.
+func checkRequest(p *player.Player, song *Song, queue bool) error {
+	queued := -1
+	if queue {
+		queued = len(QueuedSongs(p.H()))
+	}
+	if err := PlayerTier(p).Allows(song, queued); err != nil {
+		return err
+	}
+	return chargeSong(p, song)
+}
+
+// checkRequestHandle checks the song requested by the player behind the handle passed like checkRequest, from
+// outside a world transaction.
+func checkRequestHandle(eh *world.EntityHandle, song *Song, queue bool) error {
+	if tierFunc.Load() == nil && chargeFunc.Load() == nil {
+		return nil
+	}
+	err := errors.New("player is not online")
+	_ = eh.ExecWorld(func(tx *world.Tx, ent world.Entity) {
+		if pp, ok := ent.(*player.Player); ok {
+			err = checkRequest(pp, song, queue)
+		}
+	})
+	return err
+}
@@ -0,0 +1,117 @@
+package noteblockplayer
+
+import (
+	"fmt"
+
+	"github.com/df-mc/dragonfly/server/cmd"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// maxNotesPerTick is the number of notes on a single tick above which Validate reports the tick,
+// as clients start dropping sounds when too many play at once.
+const maxNotesPerTick = 24
+
+// SongProblem is a kind of problem found in a song by Validate.
+type SongProblem struct {
+	// Message describes the problem.
+	Message string
+	// Count is how many notes (or ticks) have the problem, 0 for problems of the song itself.
+	Count int
+	// FirstTick is the first tick the problem occurs at, -1 for problems of the song itself.
+	FirstTick int
+}
+
+// String returns a readable description of the problem.
+func (p SongProblem) String() string {
+	if p.FirstTick < 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %d (first at tick %d)", p.Message, p.Count, p.FirstTick)
+}
+
+// Validate checks the song for problems that make it sound wrong or not play at all: notes past the song
+// length, keys outside of the Note Block Studio range, unknown instruments, a missing tempo and ticks with
+// more notes than clients can play at once. Warnings found while loading the song, such as a truncated
+// file, are reported too. It returns nil if no problems were found.
+func Validate(song *Song) []SongProblem {
+	var problems []SongProblem
+	if song.Tempo <= 0 {
+		problems = append(problems, SongProblem{Message: "tempo is zero, playback falls back to 20 ticks per second", FirstTick: -1})
+	}
+	if len(song.Notes) == 0 {
+		problems = append(problems, SongProblem{Message: "song has no notes", FirstTick: -1})
+	}
+	for _, warning := range song.Warnings {
+		problems = append(problems, SongProblem{Message: warning, FirstTick: -1})
+	}
+
+	found := make(map[string]*SongProblem)
+	var order []string
+	report := func(msg string, tick int) {
+		p, ok := found[msg]
+		if !ok {
+			p = &SongProblem{Message: msg, FirstTick: tick}
+			found[msg] = p
+			order = append(order, msg)
+		}
+		p.Count++
+		p.FirstTick = min(p.FirstTick, tick)
+	}
+
+	perTick := make(map[int]int)
+	for _, n := range song.Notes {
+		perTick[n.Tick]++
+		switch {
+		case n.Tick < 0:
+			report("notes with a negative tick", n.Tick)
+		case n.Tick > song.Length:
+			report("notes past the song length", n.Tick)
+		}
+		if n.Key < minNoteKey || n.Key > maxNoteKey {
+			report("notes with a key outside of A0-C8", n.Tick)
+		}
+		if _, custom := song.CustomInstruments[n.Instrument]; (n.Instrument < 0 || n.Instrument >= len(instrumentSounds)) && !custom && !isAutomation(n.Instrument) {
+			report("notes with an unknown instrument", n.Tick)
+		}
+		if n.Velocity < 0 || n.Velocity > 100 {
+			report("notes with a velocity outside of 0-100", n.Tick)
+		}
+	}
+	for tick, count := range perTick {
+		if count > maxNotesPerTick {
+			report(fmt.Sprintf("ticks with more than %d notes", maxNotesPerTick), tick)
+		}
+	}
+
+	for _, msg := range order {
+		problems = append(problems, *found[msg])
+	}
+	return problems
+}
+
+// ValidateCmd is the command to check a song file for problems before playing it.
+type ValidateCmd struct {
+	Filename string `cmd:"filename"`
+}
+
+// AllowConsole allows this command from the server console.
+func (ValidateCmd) AllowConsole() bool { return true }
+
+// Run loads the song in the background and reports all problems found.
+func (c ValidateCmd) Run(src cmd.Source, output *cmd.Output, w *world.Tx) {
+	loadSongForCmd(src, w, c.Filename, func(src cmd.Source, output *cmd.Output, tx *world.Tx, song *Song, err error) {
+		if err != nil {
+			output.Errorf("Failed to load file: %v", err)
+			return
+		}
+		problems := Validate(song)
+		if len(problems) == 0 {
+			output.Printf("%s: no problems found", c.Filename)
+			return
+		}
+		output.Printf("%s: %d problem(s) found", c.Filename, len(problems))
+		for _, p := range problems {
+			output.Printf("- %s", p)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package noteblockplayer
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// VelocityCurve maps the velocity of a note, from 0 to 1, to the volume it is played at, from 0 to 1.
+type VelocityCurve func(velocity float64) float64
+
+// CurvePoint is a breakpoint of a curve created with BreakpointCurve.
+type CurvePoint struct {
+	Velocity float64 // Velocity of the note, from 0 to 1
+	Volume   float64 // Volume the velocity is played at, from 0 to 1
+}
+
+// LinearCurve returns the default VelocityCurve, which plays notes at their velocity unchanged.
+func LinearCurve() VelocityCurve {
+	return func(velocity float64) float64 { return velocity }
+}
+
+// ExponentialCurve returns a VelocityCurve raising the velocity to the power passed. Exponents below 1
+// make quiet notes louder (0.5 is a good starting point for songs that sound too quiet on Bedrock), while
+// exponents above 1 make them quieter.
+func ExponentialCurve(exponent float64) VelocityCurve {
+	return func(velocity float64) float64 { return math.Pow(velocity, exponent) }
+}
+
+// BreakpointCurve returns a VelocityCurve that interpolates linearly between the points passed. Velocities
+// below the first point or above the last point take the volume of that point. Without points the curve
+// is linear.
+func BreakpointCurve(points ...CurvePoint) VelocityCurve {
+	if len(points) == 0 {
+		return LinearCurve()
+	}
+	points = slices.Clone(points)
+	slices.SortFunc(points, func(a, b CurvePoint) int {
+		switch {
+		case a.Velocity < b.Velocity:
+			return -1
+		case a.Velocity > b.Velocity:
+			return 1
+		}
+		return 0
+	})
+	return func(velocity float64) float64 {
+		if velocity <= points[0].Velocity {
+			return points[0].Volume
+		}
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			if velocity <= b.Velocity {
+				return a.Volume + (b.Volume-a.Volume)*(velocity-a.Velocity)/(b.Velocity-a.Velocity)
+			}
+		}
+		return points[len(points)-1].Volume
+	}
+}
+
+// velocityCurve holds the VelocityCurve set with SetVelocityCurve. A nil value means linear.
+var velocityCurve atomic.Pointer[VelocityCurve]
+
+// SetVelocityCurve sets the curve used to turn note velocities into volumes for every note played directly
+// to players. Passing nil restores the linear default.
+//
+// Example usage:
+//
+//	noteblockplayer.SetVelocityCurve(noteblockplayer.ExponentialCurve(0.5))
+func SetVelocityCurve(c VelocityCurve) {
+	if c == nil {
+		velocityCurve.Store(nil)
+		return
+	}
+	velocityCurve.Store(&c)
+}
+
+// masterVolume holds the bits of the float64 master volume set with SetMasterVolume.
+var masterVolume atomic.Uint64
+
+func init() {
+	masterVolume.Store(math.Float64bits(1))
+}
+
+// SetMasterVolume sets the volume, from 0 to 1, that every note played directly to players is multiplied
+// by. It applies to all running playbacks immediately, so music can be made quieter server-wide, for
+// example during an event, without touching individual playbacks. The default is 1.
+func SetMasterVolume(volume float64) {
+	masterVolume.Store(math.Float64bits(max(0, min(1, volume))))
+}
+
+// MasterVolume returns the master volume set with SetMasterVolume.
+func MasterVolume() float64 {
+	return math.Float64frombits(masterVolume.Load())
+}
+
+// instrumentGains holds the gains set with SetInstrumentGain by instrument index.
+// instrumentGainsMtx protects access to instrumentGains.
+var (
+	instrumentGains    = make(map[int]float64)
+	instrumentGainsMtx sync.RWMutex
+)
+
+// SetInstrumentGain sets the gain that the volume of every note played with the instrument is multiplied
+// by. Some Bedrock instrument sounds, like Bass Drum (1) and Cow Bell (11), are much louder than others and
+// can drown out the melody, which can be balanced by lowering their gain. Every instrument has a gain of 1
+// by default, and the resulting volume never exceeds 1.
+//
+// Example usage:
+//
+//	noteblockplayer.SetInstrumentGain(1, 0.6)  // Bass Drum
+//	noteblockplayer.SetInstrumentGain(11, 0.5) // Cow Bell
+func SetInstrumentGain(instrument int, gain float64) {
+	instrumentGainsMtx.Lock()
+	defer instrumentGainsMtx.Unlock()
+	if gain == 1 {
+		delete(instrumentGains, instrument)
+		return
+	}
+	instrumentGains[instrument] = max(0, gain)
+}
+
+// InstrumentGain returns the gain of the instrument set with SetInstrumentGain.
+func InstrumentGain(instrument int) float64 {
+	instrumentGainsMtx.RLock()
+	defer instrumentGainsMtx.RUnlock()
+	if gain, ok := instrumentGains[instrument]; ok {
+		return gain
+	}
+	return 1
+}
+
+// noteVolume returns the volume the note is played at, from 0 to 1, after applying the velocity curve,
+// the gain of its instrument and the master volume.
+func noteVolume(note Note) float32 {
+	v := float64(FloatVel(note.Velocity))
+	if c := velocityCurve.Load(); c != nil && v > 0 {
+		v = (*c)(v)
+	}
+	v *= InstrumentGain(note.Instrument) * MasterVolume()
+	return float32(max(0, min(1, v)))
+}
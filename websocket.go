@@ -0,0 +1,236 @@
+package noteblockplayer
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/world"
+	"golang.org/x/net/websocket"
+)
+
+// PlayerLookup finds the handle of an online player by name. *server.Server's PlayerByName method
+// satisfies this type.
+type PlayerLookup func(name string) (*world.EntityHandle, bool)
+
+// remoteRequest is a command sent by a WebSocket client.
+type remoteRequest struct {
+	ID     int    `json:"id"`
+	Op     string `json:"op"`
+	Player string `json:"player"`
+	Song   string `json:"song,omitempty"`
+	Tick   int    `json:"tick,omitempty"`
+	Bar    int    `json:"bar,omitempty"`
+	Marker string `json:"marker,omitempty"`
+}
+
+// remoteResult is the reply to a remoteRequest.
+type remoteResult struct {
+	Type  string `json:"type"`
+	ID    int    `json:"id"`
+	Op    string `json:"op"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// remoteEvent is a PlaybackEvent streamed to WebSocket clients.
+type remoteEvent struct {
+	Type   string            `json:"type"`
+	Event  PlaybackEventType `json:"event"`
+	Player string            `json:"player"`
+	Song   string            `json:"song"`
+	Tick   int               `json:"tick"`
+	Length int               `json:"length"`
+	Paused bool              `json:"paused"`
+	Marker string            `json:"marker,omitempty"`
+}
+
+// NewWebSocketHandler returns an http.Handler serving a WebSocket API to control playback and stream
+// playback events, for external dashboards and stream overlays.
+//
+// Clients send JSON requests such as {"id": 1, "op": "play", "player": "Steve", "song": "my_song"}, where op is
+// one of play, stop, pause, resume, seek (with "tick", "bar" or "marker") or queue, and receive a {"type": "result"}
+// reply for each.
+// Every PlaybackEvent is streamed to all clients as {"type": "event"} messages.
+//
+// Clients must pass the token as "token" query parameter or as bearer token in the Authorization header, the
+// handler refuses all clients if token is empty. Browsers may only connect from pages of the same host as
+// the handler, or from the origins allowed with SetWebSocketOrigins, so that other websites a player opens
+// can't control playback with the player's token. lookup is used to find players by name.
+//
+// Example usage:
+//
+//	http.Handle("/music", noteblockplayer.NewWebSocketHandler("secret", srv.PlayerByName))
+//	go http.ListenAndServe("127.0.0.1:8080", nil)
+func NewWebSocketHandler(token string, lookup PlayerLookup) http.Handler {
+	return websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			if !validToken(r, token) {
+				return fmt.Errorf("invalid token")
+			}
+			origin, err := websocket.Origin(config, r)
+			if err != nil {
+				return err
+			}
+			config.Origin = origin
+			if !allowedOrigin(origin, r) {
+				return fmt.Errorf("origin %s not allowed", origin)
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			serveRemoteControl(ws, lookup)
+		},
+	}
+}
+
+// webSocketOrigins holds the origins set with SetWebSocketOrigins. webSocketOriginsMtx protects access to
+// webSocketOrigins.
+var (
+	webSocketOrigins    []string
+	webSocketOriginsMtx sync.RWMutex
+)
+
+// SetWebSocketOrigins sets the origins of the web pages allowed to connect to the handlers returned by
+// NewWebSocketHandler besides pages of the same host, such as "https://overlay.example.com". Clients that
+// aren't browsers send no origin and are always allowed.
+//
+// Example usage:
+//
+//	noteblockplayer.SetWebSocketOrigins("https://dashboard.example.com")
+func SetWebSocketOrigins(origins ...string) {
+	webSocketOriginsMtx.Lock()
+	defer webSocketOriginsMtx.Unlock()
+	webSocketOrigins = slices.Clone(origins)
+}
+
+// allowedOrigin reports whether a WebSocket client with the origin passed may connect with the request
+// passed: clients without an origin, pages of the same host and the origins set with SetWebSocketOrigins.
+func allowedOrigin(origin *url.URL, r *http.Request) bool {
+	if origin == nil || strings.EqualFold(origin.Host, r.Host) {
+		return true
+	}
+	webSocketOriginsMtx.RLock()
+	defer webSocketOriginsMtx.RUnlock()
+	return slices.ContainsFunc(webSocketOrigins, func(allowed string) bool {
+		return strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin.Scheme+"://"+origin.Host)
+	})
+}
+
+// validToken checks the token passed with a request against the token expected. An empty expected token
+// accepts no request.
+func validToken(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	got := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// serveRemoteControl handles a single WebSocket client until it disconnects.
+func serveRemoteControl(ws *websocket.Conn, lookup PlayerLookup) {
+	defer ws.Close()
+
+	// All messages are written by a single goroutine. Events are dropped for clients that can't keep up,
+	// so that a slow client never blocks a playback.
+	out := make(chan any, 64)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case msg := <-out:
+				if websocket.JSON.Send(ws, msg) != nil {
+					_ = ws.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	cancel := OnPlaybackEvent(func(e PlaybackEvent) {
+		select {
+		case out <- remoteEvent{
+			Type:   "event",
+			Event:  e.Type,
+			Player: e.PlayerName,
+			Song:   e.Song.displayName(),
+			Tick:   e.Tick,
+			Length: e.Song.Length,
+			Paused: e.Paused,
+			Marker: e.Marker,
+		}:
+		default:
+		}
+	})
+	defer cancel()
+
+	for {
+		var req remoteRequest
+		if err := websocket.JSON.Receive(ws, &req); err != nil {
+			return
+		}
+		res := remoteResult{Type: "result", ID: req.ID, Op: req.Op, OK: true}
+		if err := handleRemoteRequest(req, lookup); err != nil {
+			res.OK, res.Error = false, err.Error()
+		}
+		select {
+		case out <- res:
+		case <-done:
+			return
+		}
+	}
+}
+
+// handleRemoteRequest executes a single remoteRequest.
+func handleRemoteRequest(req remoteRequest, lookup PlayerLookup) error {
+	eh, ok := lookup(req.Player)
+	if !ok {
+		return fmt.Errorf("player %q is not online", req.Player)
+	}
+	var playing bool
+	switch req.Op {
+	case "play":
+		return PlayNoteblockWithOptions(eh, req.Song, PlaybackOptions{Source: "websocket"})
+	case "queue":
+		song, err := flexSongLoader(req.Song)
+		if err != nil {
+			return err
+		}
+		AddToQueue(eh, song, PlaybackOptions{Source: "websocket"})
+		return nil
+	case "stop":
+		playing = StopNoteblock(eh)
+	case "pause":
+		playing = PauseNoteblock(eh)
+	case "resume":
+		playing = ResumeNoteblock(eh)
+	case "seek":
+		switch {
+		case req.Marker != "":
+			playing = isPlaying(eh)
+			if playing && !SeekToMarker(eh, req.Marker) {
+				return fmt.Errorf("the song has no marker %q", req.Marker)
+			}
+		case req.Bar > 0:
+			playing = SeekNoteblockToBar(eh, req.Bar)
+		default:
+			playing = SeekNoteblock(eh, req.Tick)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", req.Op)
+	}
+	if !playing {
+		return fmt.Errorf("no song is currently playing")
+	}
+	return nil
+}